@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+const (
+	keyringService       = "diffscribe"
+	apiKeyCommandTimeout = 30 * time.Second
+	apiKeySourceConfig   = "config, environment or flag"
+	apiKeySourceCommand  = "llm.api_key_command"
+	apiKeySourceKeyring  = "keyring"
+	apiKeySourceUnset    = "not configured"
+)
+
+var (
+	apiKeyOnce   sync.Once
+	apiKeyValue  string
+	apiKeySource string
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the LLM API key stored in the OS keyring",
+	Long: `auth stores the API key in the operating system keyring (the Secret Service
+on Linux, Keychain on macOS, Credential Manager on Windows) so it never sits in
+plaintext config. Keys are stored per provider, as selected by llm.provider.
+
+The key is resolved in this order:
+  1. llm.api_key from a config file, DIFFSCRIBE_API_KEY/OPENAI_API_KEY or --llm-api-key
+  2. the output of llm.api_key_command, e.g. "pass show openai" or "op read ..."
+  3. the keyring entry written by diffscribe auth login
+
+llm.api_key_command is only read from your own config: the global and home
+files, global git config, --config and DIFFSCRIBE_LLM_API_KEY_COMMAND. A
+repository's .diffscribe files and local git config cannot set it.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Store an API key in the keyring (read from the terminal or stdin)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := readSecret(cmd, fmt.Sprintf("API key for %s: ", keyringAccount()))
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return errors.New("diffscribe: no API key provided")
+		}
+		if err := keyring.Set(keyringService, keyringAccount(), key); err != nil {
+			return fmt.Errorf("diffscribe: unable to store key in keyring: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Stored API key for %s in the keyring\n", keyringAccount())
+		return nil
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the stored API key from the keyring",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := keyring.Delete(keyringService, keyringAccount())
+		if errors.Is(err, keyring.ErrNotFound) {
+			fmt.Fprintf(cmd.OutOrStdout(), "No API key stored for %s\n", keyringAccount())
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("diffscribe: unable to remove key from keyring: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed API key for %s from the keyring\n", keyringAccount())
+		return nil
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show where the API key is resolved from",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, source := resolveAPIKey()
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Provider: %s\n", keyringAccount())
+		fmt.Fprintf(out, "Source:   %s\n", source)
+		if key != "" {
+			fmt.Fprintf(out, "Key:      %s\n", maskSecret(key))
+		}
+		if _, err := keyring.Get(keyringService, keyringAccount()); err == nil {
+			fmt.Fprintln(out, "Keyring:  stored")
+		} else if errors.Is(err, keyring.ErrNotFound) {
+			fmt.Fprintln(out, "Keyring:  empty")
+		} else {
+			fmt.Fprintf(out, "Keyring:  unavailable (%v)\n", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authLogoutCmd)
+	authCmd.AddCommand(authStatusCmd)
+	rootCmd.AddCommand(authCmd)
+}
+
+// resolveAPIKey returns the API key and where it came from. The credential
+// command and keyring are consulted at most once per process.
+func resolveAPIKey() (string, string) {
+	if key := strings.TrimSpace(viper.GetString("llm.api_key")); key != "" {
+		return key, apiKeySourceConfig
+	}
+	apiKeyOnce.Do(func() {
+		apiKeyValue, apiKeySource = "", apiKeySourceUnset
+		if command := strings.TrimSpace(viper.GetString("llm.api_key_command")); command != "" {
+			key, err := runAPIKeyCommand(command)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "diffscribe: llm.api_key_command failed: %v\n", err)
+			} else if key != "" {
+				apiKeyValue, apiKeySource = key, apiKeySourceCommand
+				return
+			}
+		}
+		key, err := keyring.Get(keyringService, keyringAccount())
+		if err == nil && strings.TrimSpace(key) != "" {
+			apiKeyValue, apiKeySource = strings.TrimSpace(key), apiKeySourceKeyring
+		} else if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			debugf("keyring unavailable: %v", err)
+		}
+	})
+	return apiKeyValue, apiKeySource
+}
+
+// runAPIKeyCommand runs command through the shell and returns the first line
+// of its output. Stderr stays attached, and stdin when it is a terminal, so
+// password managers can prompt for unlocking without reading the protocol
+// stream of lsp or mcp.
+func runAPIKeyCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), apiKeyCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+func keyringAccount() string {
+	if p := strings.TrimSpace(viper.GetString("llm.provider")); p != "" {
+		return p
+	}
+	return defaultProvider
+}
+
+func readSecret(cmd *cobra.Command, prompt string) (string, error) {
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(cmd.ErrOrStderr(), prompt)
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(cmd.ErrOrStderr())
+		if err != nil {
+			return "", fmt.Errorf("diffscribe: unable to read API key: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("diffscribe: unable to read API key: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:3] + strings.Repeat("*", 4) + s[len(s)-4:]
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// isolateAPIKey clears the API key variables and replaces the keyring with an
+// in-memory one.
+func isolateAPIKey(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"OPENAI_API_KEY", "DIFFSCRIBE_API_KEY"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	keyring.MockInit()
+}
+
+func TestAPIKeyCommandIsUserOnly(t *testing.T) {
+	home := isolateConfig(t)
+	isolateAPIKey(t)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pwned := filepath.Join(t.TempDir(), "pwned")
+	hostile := "touch " + pwned + "; echo sk-project"
+
+	gitIn(t, cwd, "init", "-q")
+	gitIn(t, cwd, "config", "diffscribe.llm.api-key-command", hostile)
+	writeFile(t, ".diffscribe.yaml", "llm:\n  api_key_command: "+hostile+"\nprofiles:\n  work:\n    llm:\n      api_key_command: "+hostile+"\n")
+	resetConfig()
+	if key, source := resolveAPIKey(); key != "" || source != apiKeySourceUnset {
+		t.Errorf("resolveAPIKey() = %q, %q; want the project's command ignored", key, source)
+	}
+	for _, want := range []string{
+		".diffscribe.yaml: ignoring llm.api_key_command",
+		".diffscribe.yaml: ignoring profiles.work.llm.api_key_command",
+		repoGitConfig + ": ignoring llm.api_key_command",
+	} {
+		found := false
+		for _, w := range configWarnings {
+			found = found || strings.Contains(w, want)
+		}
+		if !found {
+			t.Errorf("no warning %q in %q", want, configWarnings)
+		}
+	}
+
+	writeFile(t, filepath.Join(home, ".diffscribe.yaml"), "llm:\n  api_key_command: echo sk-home\n")
+	resetConfig()
+	if key, source := resolveAPIKey(); key != "sk-home" || source != apiKeySourceCommand {
+		t.Errorf("resolveAPIKey() = %q, %q; want the home config's command", key, source)
+	}
+
+	gitIn(t, cwd, "config", "--file", filepath.Join(home, ".gitconfig"), "diffscribe.llm.api-key-command", "echo sk-git")
+	os.Remove(filepath.Join(home, ".diffscribe.yaml"))
+	resetConfig()
+	if key, _ := resolveAPIKey(); key != "sk-git" {
+		t.Errorf("resolveAPIKey() = %q; want the global git config's command", key)
+	}
+
+	if _, err := os.Stat(pwned); err == nil {
+		t.Error("a project's llm.api_key_command ran")
+	}
+}
+
+func TestResolveAPIKeyOrder(t *testing.T) {
+	home := isolateConfig(t)
+	isolateAPIKey(t)
+	flag := rootFlags.Lookup("llm-api-key")
+	t.Cleanup(func() {
+		_ = flag.Value.Set("")
+		flag.Changed = false
+	})
+
+	steps := []struct {
+		name, key, source string
+		apply             func()
+	}{
+		{"unset", "", apiKeySourceUnset, func() {}},
+		{"keyring", "sk-keyring", apiKeySourceKeyring, func() {
+			if err := keyring.Set(keyringService, defaultProvider, "sk-keyring\n"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"command over keyring", "sk-command", apiKeySourceCommand, func() {
+			writeFile(t, filepath.Join(home, ".diffscribe.yaml"), "llm:\n  api_key_command: printf 'sk-command\\nsecond line\\n'\n")
+		}},
+		{"environment over command", "sk-env", apiKeySourceConfig, func() {
+			t.Setenv("DIFFSCRIBE_API_KEY", "sk-env")
+		}},
+		{"flag over environment", "sk-flag", apiKeySourceConfig, func() {
+			_ = flag.Value.Set("sk-flag")
+			flag.Changed = true
+		}},
+	}
+	for _, step := range steps {
+		step.apply()
+		resetConfig()
+		if key, source := resolveAPIKey(); key != step.key || source != step.source {
+			t.Errorf("%s: resolveAPIKey() = %q, %q; want %q, %q", step.name, key, source, step.key, step.source)
+		}
+	}
+}
+
+func TestAPIKeyCommandRunsOncePerConfig(t *testing.T) {
+	home := isolateConfig(t)
+	isolateAPIKey(t)
+	runs := filepath.Join(t.TempDir(), "runs")
+	command := func(key string) string {
+		return "llm:\n  api_key_command: echo run >> " + runs + "; echo " + key + "\n"
+	}
+
+	writeFile(t, filepath.Join(home, ".diffscribe.yaml"), command("sk-one"))
+	resetConfig()
+	for range 3 {
+		if key, _ := resolveAPIKey(); key != "sk-one" {
+			t.Fatalf("resolveAPIKey() = %q, want sk-one", key)
+		}
+	}
+	writeFile(t, filepath.Join(home, ".diffscribe.yaml"), command("sk-two"))
+	if key, _ := resolveAPIKey(); key != "sk-one" {
+		t.Errorf("resolveAPIKey() = %q before reloading, want the cached sk-one", key)
+	}
+	resetConfig()
+	if key, _ := resolveAPIKey(); key != "sk-two" {
+		t.Errorf("resolveAPIKey() = %q after reloading, want sk-two", key)
+	}
+
+	out, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), "run\n"); n != 2 {
+		t.Errorf("command ran %d times, want once per load", n)
+	}
+}
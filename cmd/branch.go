@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/rogwilco/diffscribe/internal/llm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defaultBranchFormat = "type/TICKET-short-desc"
+
+// maxBranchNameLength caps slugified names; longer ones are cut at a word.
+const maxBranchNameLength = 60
+
+const defaultBranchSystemPrompt = `You name git branches for the changes a developer is about to commit.
+Always apply these rules:
+- Follow the requested branch name format exactly as described by the user.
+- Use a conventional change type (feat, fix, chore, docs, refactor, test, perf, ci, build).
+- Keep the description to a few lowercase words separated by hyphens.
+- Only include a ticket identifier when the user provides one.
+- Never use spaces, uppercase words, or characters that git rejects in branch names.`
+
+const defaultBranchUserPrompt = `Current branch: {{ .Branch }}
+Files ({{ .FileCount }}):
+{{- range .Files }}
+- {{ . }}
+{{- else }}
+{{- range .Paths }}
+- {{ . }}
+{{- end }}
+{{- end }}
+
+Desired branch name format:
+{{ .BranchFormat }}
+{{- if .Ticket }}
+Ticket: {{ .Ticket }}
+{{- else }}
+No ticket was provided; omit the ticket portion.
+{{- end }}
+{{- if .Prefix }}
+Hint from the user: {{ .Prefix }}
+{{- end }}
+
+Truncated diff:
+{{ .Diff }}
+
+Generate {{ .Quantity }} branch name candidates. Return only a JSON array of strings.`
+
+var (
+	branchTicket string
+	branchCreate bool
+	branchPick   int
+)
+
+var branchCmd = &cobra.Command{
+	Use:   "branch [hint]",
+	Short: "Suggest branch names for staged or working-tree changes",
+	Long: `branch asks the LLM for branch names describing your staged changes (or
+the working tree when nothing is staged). Candidates are converted into
+slug-safe names and validated with git check-ref-format before printing.
+
+The naming convention defaults to type/TICKET-short-desc and can be changed
+with the branch.format config key. Pass --create to create and check out one
+of the candidates instead of printing them.`,
+	Example: `  # print branch name suggestions
+  diffscribe branch
+
+  # include a ticket and a hint about the change
+  diffscribe branch --ticket ABC-123 "login form"
+
+  # create and check out the second suggestion
+  diffscribe branch --create --pick 2`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := collectContext()
+		if err != nil {
+			return err
+		}
+		if len(c.Paths) == 0 && !cmd.Flags().Changed("source") {
+			if c, err = collectSource(sourceUnstaged); err != nil {
+				return err
+			}
+		}
+		hint := ""
+		if len(args) > 0 {
+			hint = args[0]
+		}
+
+		names, err := generateBranchNames(c, hint, branchTicket)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return errNoSuggestions
+		}
+
+		if !branchCreate {
+			for _, n := range names {
+				fmt.Println(n)
+			}
+			return nil
+		}
+
+		if branchPick < 1 || branchPick > len(names) {
+			return fmt.Errorf("diffscribe: --pick must be between 1 and %d", len(names))
+		}
+		return createBranch(names[branchPick-1])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(branchCmd)
+
+	branchCmd.Flags().StringVar(&branchTicket, "ticket", "", "ticket identifier to embed in the branch name")
+	branchCmd.Flags().BoolVar(&branchCreate, "create", false, "create and check out the chosen branch")
+	branchCmd.Flags().IntVar(&branchPick, "pick", 1, "which candidate to use with --create (1-based)")
+
+	setDefault("branch.format", defaultBranchFormat)
+	setDefault("branch.system_prompt", defaultBranchSystemPrompt)
+	setDefault("branch.user_prompt", defaultBranchUserPrompt)
+}
+
+type branchPromptData struct {
+	userPromptData
+	BranchFormat string
+	Ticket       string
+}
+
+func generateBranchNames(c gitContext, hint, ticket string) ([]string, error) {
+	if len(c.Paths) == 0 {
+		return nil, nil
+	}
+
+	cfg := baseLLMConfig()
+	sysData, userData := newPromptData(cfg, newTemplateData(c, hint))
+	var err error
+	if cfg.SystemPrompt, err = renderPrompt("branch.system_prompt", sysData); err != nil {
+		return nil, err
+	}
+	cfg.UserPrompt, err = renderPrompt("branch.user_prompt", branchPromptData{
+		userPromptData: userData,
+		BranchFormat:   viper.GetString("branch.format"),
+		Ticket:         strings.TrimSpace(ticket),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := requireLLMConfig(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, nil
+	}
+
+	res, err := llm.GenerateBranchNames(context.Background(), llm.Context{
+		Branch:       c.Branch,
+		Source:       c.Source,
+		Paths:        c.Paths,
+		Files:        c.Files,
+		Declarations: c.Declarations,
+		Diff:         c.Diff,
+		Prefix:       hint,
+	}, cfg)
+	recordUsage("branch", cfg, res.Usage)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "diffscribe: LLM error:", err)
+		return nil, nil
+	}
+
+	seen := make(map[string]struct{})
+	var names []string
+	for _, r := range res.Suggestions {
+		name := slugifyBranch(r, ticket)
+		if name == "" || !validBranchName(name) {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+var (
+	branchInvalidChars = regexp.MustCompile(`[^a-z0-9._/-]+`)
+	branchRepeatedDash = regexp.MustCompile(`-{2,}`)
+	branchRepeatedDot  = regexp.MustCompile(`\.{2,}`)
+)
+
+// slugifyBranch turns free-form model output into a conservative branch name
+// of at most maxBranchNameLength characters. Everything is lowercased except
+// the ticket identifier, which keeps the case the user supplied.
+func slugifyBranch(raw, ticket string) string {
+	name := strings.ToLower(strings.TrimSpace(raw))
+	name = strings.Trim(name, "`'\"")
+	name = strings.Join(strings.Fields(name), "-")
+	name = branchInvalidChars.ReplaceAllString(name, "-")
+	name = branchRepeatedDash.ReplaceAllString(name, "-")
+	name = branchRepeatedDot.ReplaceAllString(name, ".")
+	if len(name) > maxBranchNameLength {
+		name = name[:maxBranchNameLength]
+		if i := strings.LastIndexAny(name, "-/"); i > 0 {
+			name = name[:i]
+		}
+	}
+
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		part = strings.Trim(part, ".-")
+		part = strings.TrimSuffix(part, ".lock")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	name = strings.Join(parts, "/")
+
+	if t := strings.TrimSpace(ticket); t != "" {
+		name = strings.ReplaceAll(name, strings.ToLower(t), t)
+	}
+	return name
+}
+
+func validBranchName(name string) bool {
+	return exec.Command("git", "check-ref-format", "--branch", name).Run() == nil
+}
+
+func createBranch(name string) error {
+	cmd := exec.Command("git", "checkout", "-b", name)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("diffscribe: unable to create branch %s: %w", name, err)
+	}
+	return nil
+}
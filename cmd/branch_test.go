@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSlugifyBranch(t *testing.T) {
+	cases := []struct {
+		name, raw, ticket, want string
+	}{
+		{"plain", "feat/add-login-form", "", "feat/add-login-form"},
+		{"spaces and case", "  Feat/Add Login Form ", "", "feat/add-login-form"},
+		{"quotes", "`fix/typo`", "", "fix/typo"},
+		{"punctuation runs", "fix/handle: empty!!  diffs (again)", "", "fix/handle-empty-diffs-again"},
+		{"repeated dots", "docs/v1...2", "", "docs/v1.2"},
+		{"unicode", "feat/café-menü-ünïcode", "", "feat/caf-men-n-code"},
+		{"only unicode", "日本語", "", ""},
+		{"empty segments", "/feat//-login-/", "", "feat/login"},
+		{"lock suffix", "chore/refs.lock", "", "chore/refs"},
+		{"leading dots", "feat/.hidden", "", "feat/hidden"},
+		{"ticket keeps its case", "feat/abc-123-login", "ABC-123", "feat/ABC-123-login"},
+		{"ticket in model case", "FEAT/ABC-123-LOGIN", " ABC-123 ", "feat/ABC-123-login"},
+		{"ticket not present", "feat/login", "ABC-123", "feat/login"},
+		{
+			"length cap at a word",
+			"feat/add-a-very-long-description-that-keeps-going-well-past-the-limit",
+			"",
+			"feat/add-a-very-long-description-that-keeps-going-well-past",
+		},
+		{
+			"length cap without a word break",
+			"feat/" + strings.Repeat("x", 80),
+			"",
+			"feat",
+		},
+		{"length cap drops a partial word", "fix/" + strings.Repeat("ab-", 18) + "..tail", "", strings.TrimSuffix("fix/"+strings.Repeat("ab-", 18), "-")},
+	}
+	for _, tc := range cases {
+		got := slugifyBranch(tc.raw, tc.ticket)
+		if got != tc.want {
+			t.Errorf("%s: slugifyBranch(%q, %q) = %q, want %q", tc.name, tc.raw, tc.ticket, got, tc.want)
+		}
+		if len(got) > maxBranchNameLength {
+			t.Errorf("%s: %q is longer than %d", tc.name, got, maxBranchNameLength)
+		}
+	}
+}
+
+func TestValidBranchName(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"feat/ok", true},
+		{"feat/ABC-123-login", true},
+		{"", false},
+		{"-feat", false},
+		{".feat", false},
+		{"/feat", false},
+		{"feat/", false},
+		{"feat//x", false},
+		{"feat/.x", false},
+		{"feat..x", false},
+		{"feat.lock", false},
+		{"feat x", false},
+		{"feat~1", false},
+		{"feat^", false},
+		{"feat:x", false},
+		{"feat?", false},
+		{"feat*", false},
+		{"feat[x", false},
+		{`feat\x`, false},
+		{"feat@{x}", false},
+	}
+	for _, tc := range cases {
+		if got := validBranchName(tc.name); got != tc.want {
+			t.Errorf("validBranchName(%q) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
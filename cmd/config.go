@@ -0,0 +1,507 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rogwilco/diffscribe/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// configSources records, per flattened key, the last config layer that
+	// set it. Environment variables and flags are resolved when displayed.
+	configSources     = map[string]string{}
+	loadedConfigFiles []string
+	// profileFiles records, per key the active profile sets, the config
+	// file that defined it there.
+	profileFiles = map[string]string{}
+	// configWarnings holds schema problems found while merging config files.
+	// They are printed before any command runs.
+	configWarnings []string
+)
+
+var (
+	configLayerFlag   string
+	configShowSecrets bool
+	configSetForce    bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and edit diffscribe configuration",
+	Long: `config shows the effective configuration and where each value comes from:
+a config file, git config, a profile, an environment variable, a flag, or the
+built-in default.
+
+set, path and edit operate on a single layer, chosen with --layer:
+  global   $XDG_CONFIG_HOME/diffscribe/.diffscribe*
+  home     $HOME/.diffscribe*
+  project  .diffscribe* nearest the current directory, up to the
+           repository root (default)
+  git      the [diffscribe] section of the repository's git config
+  file     the file passed with --config`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration and the source of each value",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys := viper.AllKeys()
+		sort.Strings(keys)
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", key, summarizeValue(displayValue(key)), configSource(key))
+		}
+		return w.Flush()
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a single key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := strings.ToLower(args[0])
+		if !viper.IsSet(key) {
+			return fmt.Errorf("diffscribe: %s is not set", key)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), displayValue(key))
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Write a value to a config layer",
+	Long: `set writes a value to the layer chosen with --layer (project by default).
+Values are parsed as YAML, so numbers, booleans and lists such as
+"[feat, fix]" keep their type.
+
+In YAML files only the key being set changes; comments, key order and the
+other values are kept, although blank lines and indentation are normalized.
+Other formats are rewritten in full, so set refuses to write one that
+contains comments unless --force is given. It also refuses to put API keys,
+tokens and other secrets in git config, which is often shared in dotfile
+repositories, unless --force is given; use diffscribe auth login instead.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := strings.ToLower(args[0])
+		if configLayerFlag == "git" {
+			if isSecretKey(key) && !configSetForce {
+				return fmt.Errorf("diffscribe: refusing to store %s in plaintext git config (use diffscribe auth login, or --force)", key)
+			}
+			name := "diffscribe." + strings.ReplaceAll(key, "_", "-")
+			if out, err := exec.Command("git", "config", name, args[1]).CombinedOutput(); err != nil {
+				return fmt.Errorf("diffscribe: git config %s: %v: %s", name, err, strings.TrimSpace(string(out)))
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Set %s in git config\n", name)
+			return nil
+		}
+
+		path, err := configLayerPath(configLayerFlag)
+		if err != nil {
+			return err
+		}
+		var value any
+		if err := yaml.Unmarshal([]byte(args[1]), &value); err != nil || value == nil {
+			value = args[1]
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("diffscribe: unable to create %s: %w", filepath.Dir(path), err)
+		}
+		if err := writeConfigValue(path, key, value); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Set %s in %s\n", key, path)
+		return nil
+	},
+}
+
+// writeConfigValue sets key to value in the config file at path, creating it
+// when missing.
+func writeConfigValue(path, key string, value any) error {
+	src, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("diffscribe: unable to read config %s: %w", path, err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case "", ".yaml", ".yml":
+		out, err := setYAMLValue(src, key, value)
+		if err != nil {
+			return fmt.Errorf("diffscribe: unable to update config %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return fmt.Errorf("diffscribe: unable to write config %s: %w", path, err)
+		}
+		return nil
+	}
+
+	if hasComments(src) && !configSetForce {
+		return fmt.Errorf("diffscribe: %s has comments that rewriting it would drop; edit it with diffscribe config edit, or pass --force", path)
+	}
+	cfg := viper.New()
+	if src != nil {
+		if err := readConfigFile(cfg, path); err != nil {
+			return fmt.Errorf("diffscribe: unable to read config %s: %w", path, err)
+		}
+	}
+	cfg.Set(key, value)
+	if err := cfg.WriteConfigAs(path); err != nil {
+		return fmt.Errorf("diffscribe: unable to write config %s: %w", path, err)
+	}
+	return nil
+}
+
+// setYAMLValue sets the dotted key in a YAML document to value. It edits the
+// parsed node tree, so comments, key order and the other values survive;
+// keys are matched case-insensitively, as viper reads them, and missing ones
+// are appended.
+func setYAMLValue(src []byte, key string, value any) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{}}}
+	}
+	node := doc.Content[0]
+	if node.Kind == 0 || node.Tag == "!!null" {
+		*node = yaml.Node{Kind: yaml.MappingNode, HeadComment: node.HeadComment}
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, errors.New("the document is not a mapping")
+	}
+
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		var child *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if strings.EqualFold(node.Content[j].Value, part) {
+				child = node.Content[j+1]
+			}
+		}
+		if child == nil {
+			child = &yaml.Node{}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, child)
+		}
+		if i == len(parts)-1 {
+			var v yaml.Node
+			if err := v.Encode(value); err != nil {
+				return nil, err
+			}
+			v.HeadComment, v.LineComment, v.FootComment = child.HeadComment, child.LineComment, child.FootComment
+			if v.Kind == child.Kind && v.Tag == child.Tag {
+				// Keep flow lists flow and quoted strings quoted.
+				v.Style = child.Style
+			}
+			*child = v
+		} else if child.Kind != yaml.MappingNode {
+			*child = yaml.Node{Kind: yaml.MappingNode, LineComment: child.LineComment}
+		}
+		node = child
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hasComments reports whether a TOML, INI or HCL file has comment lines.
+func hasComments(src []byte) bool {
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			return true
+		}
+	}
+	return false
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print config file locations (all layers, or the one chosen with --layer)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		if cmd.Flags().Changed("layer") {
+			path, err := configLayerPath(configLayerFlag)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, path)
+			return nil
+		}
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, layer := range configLayers() {
+			path, ok := existingConfigFile(layer.Dir)
+			if !ok {
+				path = filepath.Join(layer.Dir, ".diffscribe.yaml")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", layer.Name, path, configFileState(path))
+		}
+		if cfgFile != "" {
+			fmt.Fprintf(w, "file\t%s\t%s\n", cfgFile, configFileState(cfgFile))
+		}
+		return w.Flush()
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Open a config layer in $VISUAL or $EDITOR",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := configLayerPath(configLayerFlag)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("diffscribe: unable to create %s: %w", filepath.Dir(path), err)
+		}
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+		c := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			return fmt.Errorf("diffscribe: editor exited with error: %w", err)
+		}
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file...]",
+	Short: "Check config files against the schema (defaults to every file that was loaded)",
+	Long: `validate checks config files for unknown keys and values of the wrong type,
+printing one problem per line and exiting with status 12 when any are found.
+Without arguments it checks every file diffscribe loaded.`,
+	// Overrides the root hook so load-time warnings are not printed twice.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return repoDirErr
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files := args
+		if len(files) == 0 {
+			files = loadedConfigFiles
+		}
+		out := cmd.OutOrStdout()
+		failed := false
+		for _, path := range files {
+			cfg := viper.New()
+			if err := readConfigFile(cfg, path); err != nil {
+				fmt.Fprintf(out, "%s: %v\n", path, err)
+				failed = true
+				continue
+			}
+			for _, p := range config.Validate(cfg.AllSettings()) {
+				fmt.Fprintf(out, "%s: %s\n", path, p)
+				failed = true
+			}
+		}
+		if failed {
+			return errConfigInvalid
+		}
+		fmt.Fprintf(out, "%d config file(s) OK\n", len(files))
+		return nil
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema for config files",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := config.JSONSchema()
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(schema)
+		return err
+	},
+}
+
+func init() {
+	configCmd.PersistentFlags().StringVar(&configLayerFlag, "layer", "project", "config layer to operate on (global, home, project, git, file)")
+	configShowCmd.Flags().BoolVar(&configShowSecrets, "show-secrets", false, "print API keys and other secrets unmasked")
+	configGetCmd.Flags().BoolVar(&configShowSecrets, "show-secrets", false, "print API keys and other secrets unmasked")
+	configSetCmd.Flags().BoolVar(&configSetForce, "force", false, "rewrite a non-YAML config file even though its comments will be lost, or store a secret in git config")
+
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func printConfigWarnings() {
+	for _, w := range configWarnings {
+		fmt.Fprintf(os.Stderr, "diffscribe: %s\n", w)
+	}
+}
+
+// recordSources marks every leaf key in settings as coming from source.
+func recordSources(settings map[string]any, source string) {
+	for _, key := range flattenKeys(settings, "") {
+		configSources[key] = source
+	}
+}
+
+func flattenKeys(settings map[string]any, prefix string) []string {
+	var keys []string
+	for k, v := range settings {
+		key := strings.ToLower(prefix + k)
+		if nested, ok := v.(map[string]any); ok && len(nested) > 0 {
+			keys = append(keys, flattenKeys(nested, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// configSource reports where the effective value of key comes from, following
+// viper's precedence: flag, environment, config layers, default.
+func configSource(key string) string {
+	if flagChanged(key) {
+		return "flag --" + configFlags[key]
+	}
+	for _, name := range configEnvNames(key) {
+		if _, ok := os.LookupEnv(name); ok {
+			return "env " + name
+		}
+	}
+	if source, ok := configSources[key]; ok {
+		return source
+	}
+	return "default"
+}
+
+// flagChanged reports whether the flag bound to key was passed.
+func flagChanged(key string) bool {
+	flag, ok := configFlags[key]
+	if !ok || rootFlags == nil {
+		return false
+	}
+	f := rootFlags.Lookup(flag)
+	return f != nil && f.Changed
+}
+
+func configEnvNames(key string) []string {
+	if key == "llm.api_key" {
+		return []string{"DIFFSCRIBE_API_KEY", "OPENAI_API_KEY"}
+	}
+	return []string{"DIFFSCRIBE_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))}
+}
+
+func displayValue(key string) string {
+	value := fmt.Sprint(viper.Get(key))
+	if !configShowSecrets && isSecretKey(key) && value != "" {
+		return maskSecret(value)
+	}
+	return value
+}
+
+func isSecretKey(key string) bool {
+	leaf := key[strings.LastIndex(key, ".")+1:]
+	for _, suffix := range []string{"api_key", "token", "secret", "password"} {
+		if strings.HasSuffix(leaf, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeValue keeps multi-line values such as prompts to one table cell.
+func summarizeValue(value string) string {
+	const limit = 60
+	first, _, multiline := strings.Cut(value, "\n")
+	if !multiline && len(first) <= limit {
+		return first
+	}
+	if len(first) > limit {
+		first = first[:limit]
+	}
+	return first + " …"
+}
+
+// configLayerPath returns the file a layer reads from: the first existing
+// .diffscribe* candidate, or .diffscribe.yaml when none exists yet. The
+// project layer resolves to the nearest directory with a config file, falling
+// back to the repository root.
+func configLayerPath(name string) (string, error) {
+	if name == "file" {
+		if cfgFile == "" {
+			return "", errors.New("diffscribe: --layer file requires --config")
+		}
+		return cfgFile, nil
+	}
+	if name == "git" {
+		return "", errors.New("diffscribe: the git layer has no file; use git config directly")
+	}
+	var matches []configLayer
+	for _, layer := range configLayers() {
+		if layer.Name == name {
+			matches = append(matches, layer)
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("diffscribe: unknown config layer %q (want global, home, project, git or file)", name)
+	}
+	for i := len(matches) - 1; i >= 0; i-- {
+		if f, ok := existingConfigFile(matches[i].Dir); ok {
+			return f, nil
+		}
+	}
+	return filepath.Join(matches[0].Dir, ".diffscribe.yaml"), nil
+}
+
+func existingConfigFile(dir string) (string, bool) {
+	for _, f := range configCandidates(dir) {
+		if info, err := os.Stat(f); err == nil && !info.IsDir() {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+func configFileState(path string) string {
+	for _, f := range loadedConfigFiles {
+		if f == path {
+			return "loaded"
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "exists"
+	}
+	return "missing"
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// isolateConfig runs a test in an empty working directory with its own home
+// directory, no DIFFSCRIBE_* variables and no user or system git config.
+// It returns the home directory.
+func isolateConfig(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, "DIFFSCRIBE_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() {
+		viper.Reset()
+		configSources = map[string]string{}
+		profileFiles = map[string]string{}
+		loadedConfigFiles = nil
+		configWarnings = nil
+		activeProfile = ""
+	})
+	return home
+}
+
+// writeFile creates path, and its parent directories, holding content.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetYAMLValue(t *testing.T) {
+	src := `# yaml-language-server: $schema=https://example.com/schema.json
+llm:
+  Model: gpt-4o-mini # cheap
+  temperature: 0.8
+# Keep subjects short.
+lint:
+  types: [feat, fix]
+  scopes: "api"
+quantity: 5
+`
+	cases := []struct {
+		key   string
+		value any
+		want  string
+	}{
+		{"llm.model", "gpt-4o", "  Model: gpt-4o # cheap\n"},
+		{"lint.types", []any{"feat", "fix", "chore"}, "  types: [feat, fix, chore]\n"},
+		{"lint.scopes", "web", "  scopes: \"web\"\n"},
+		{"lint.subject_max_length", 50, "  scopes: \"api\"\n  subject_max_length: 50\nquantity: 5\n"},
+		{"format", "kernel", "quantity: 5\nformat: kernel\n"},
+		{"quantity.nested", true, "quantity:\n  nested: true\n"},
+	}
+	for _, tc := range cases {
+		out, err := setYAMLValue([]byte(src), tc.key, tc.value)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.key, err)
+		}
+		got := string(out)
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("%s: missing %q in\n%s", tc.key, tc.want, got)
+		}
+		for _, kept := range []string{"# yaml-language-server: $schema=https://example.com/schema.json\nllm:\n", "  temperature: 0.8\n# Keep subjects short.\nlint:\n"} {
+			if !strings.Contains(got, kept) {
+				t.Errorf("%s: lost %q in\n%s", tc.key, kept, got)
+			}
+		}
+	}
+
+	out, err := setYAMLValue(nil, "llm.model", "gpt-4o")
+	if err != nil || string(out) != "llm:\n  model: gpt-4o\n" {
+		t.Errorf("new file = %q (%v)", out, err)
+	}
+}
+
+func TestWriteConfigValueRefusesCommentedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".diffscribe.toml")
+	writeFile(t, path, "# team defaults\nquantity = 3\n")
+	if err := writeConfigValue(path, "quantity", 4); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("expected a refusal mentioning --force, got %v", err)
+	}
+
+	configSetForce = true
+	t.Cleanup(func() { configSetForce = false })
+	if err := writeConfigValue(path, "quantity", 4); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "quantity = 4\n" {
+		t.Errorf("rewritten file = %q", b)
+	}
+}
+
+func TestConfigSetRefusesSecretsInGitConfig(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitIn(t, dir, "init", "-q")
+	configLayerFlag = "git"
+	t.Cleanup(func() { configLayerFlag, configSetForce = "project", false })
+	gitValue := func(name string) string {
+		out, _ := exec.Command("git", "config", name).Output()
+		return strings.TrimSpace(string(out))
+	}
+
+	for _, key := range []string{"llm.api_key", "serve.token", "LLM.API_KEY"} {
+		err := configSetCmd.RunE(configSetCmd, []string{key, "sk-secret"})
+		if err == nil || !strings.Contains(err.Error(), "--force") {
+			t.Errorf("set %s: err = %v, want a refusal mentioning --force", key, err)
+		}
+	}
+	if got := gitValue("diffscribe.llm.api-key"); got != "" {
+		t.Errorf("the key was written anyway: %q", got)
+	}
+
+	if err := configSetCmd.RunE(configSetCmd, []string{"llm.model", "gpt-4o"}); err != nil {
+		t.Errorf("set llm.model: %v", err)
+	}
+	configSetForce = true
+	if err := configSetCmd.RunE(configSetCmd, []string{"llm.api_key", "sk-secret"}); err != nil {
+		t.Errorf("set llm.api_key --force: %v", err)
+	}
+	if got := gitValue("diffscribe.llm.api-key"); got != "sk-secret" {
+		t.Errorf("diffscribe.llm.api-key = %q after --force", got)
+	}
+}
@@ -0,0 +1,688 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rogwilco/diffscribe/internal/daemon"
+	"github.com/rogwilco/diffscribe/internal/llm"
+	"github.com/rogwilco/diffscribe/internal/version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	daemonCacheSize    = 256
+	daemonPollInterval = 500 * time.Millisecond
+	daemonCallTimeout  = 60 * time.Second
+	daemonMaxBackoff   = 5 * time.Minute
+
+	defaultDaemonDebounce    = 1500 * time.Millisecond
+	defaultDaemonMinInterval = 10 * time.Second
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Serve suggestions from a long-running process to keep completion fast",
+	Long: `daemon listens on a per-user Unix socket and answers suggestion requests
+from the CLI and the shell completion scripts. It keeps HTTP connections to
+the provider warm, caches responses, and watches the index of every
+repository it has served: when the staged changes are unchanged, a repeated
+request is answered from the cache without calling git or the provider.
+
+While it runs, diffscribe forwards plain suggestion requests to it
+transparently (with the working directory, flags and DIFFSCRIBE_*/GIT_*
+environment variables) and falls back to working in-process when it is not
+running. Set DIFFSCRIBE_DAEMON=0 to bypass it.
+
+The socket is $XDG_RUNTIME_DIR/diffscribe/daemon.sock, or a diffscribe-<uid>
+directory under the system temp directory; DIFFSCRIBE_DAEMON_SOCKET
+overrides it. Its directory must be owned by you with mode 0700, or the
+daemon refuses to listen there and clients refuse to connect. The daemon
+runs in the foreground; start it from your login session, a systemd user
+unit or launchd.
+
+With daemon.pregenerate enabled, the daemon generates suggestions in the
+background once the index of a repository it has served changes and then
+stays quiet for daemon.debounce (default 1500ms). Pre-generation requests are
+spaced at least daemon.min_interval (default 10s) apart and back off after
+failures such as rate limiting.`,
+	Example: `  # start it in the background for this session
+  diffscribe daemon &
+
+  diffscribe daemon status
+  diffscribe daemon stop`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := daemon.SocketPath()
+		l, err := daemon.Listen(path)
+		if errors.Is(err, daemon.ErrRunning) {
+			return fmt.Errorf("diffscribe: daemon already running on %s", path)
+		}
+		if err != nil {
+			return fmt.Errorf("diffscribe: unable to listen on %s: %w", path, err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		srv := newDaemonServer(stop)
+		go srv.watch(ctx)
+
+		fmt.Fprintf(os.Stderr, "diffscribe: daemon listening on %s\n", path)
+		return daemon.Serve(ctx, l, srv.handle)
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report whether the daemon is running",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := daemon.SocketPath()
+		resp, err := daemon.Call(path, daemon.Request{Op: daemon.OpPing}, 2*time.Second)
+		if errors.Is(err, daemon.ErrUnsafeDir) {
+			return fmt.Errorf("diffscribe: %w", err)
+		}
+		if err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Not running (%s)\n", path)
+			return nil
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Running on %s\n", path)
+		fmt.Fprintf(out, "PID:     %d\n", resp.PID)
+		fmt.Fprintf(out, "Version: %s\n", resp.Version)
+		fmt.Fprintf(out, "Uptime:  %s\n", time.Since(resp.Started).Round(time.Second))
+		fmt.Fprintf(out, "Cached:  %d responses\n", resp.Entries)
+		return nil
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop a running daemon",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := daemon.SocketPath()
+		_, err := daemon.Call(path, daemon.Request{Op: daemon.OpStop}, 2*time.Second)
+		if errors.Is(err, daemon.ErrUnsafeDir) {
+			return fmt.Errorf("diffscribe: %w", err)
+		}
+		if err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Not running (%s)\n", path)
+			return nil
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "Stopped")
+		return nil
+	},
+}
+
+func init() {
+	daemonCmd.AddCommand(daemonStatusCmd, daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+
+	setDefault("daemon.pregenerate", false)
+	setDefault("daemon.debounce", defaultDaemonDebounce)
+	setDefault("daemon.min_interval", defaultDaemonMinInterval)
+}
+
+// daemonServer answers requests one at a time: configuration, the working
+// directory and the environment are process-wide, so each request switches
+// them to the client's and restores them afterwards.
+type daemonServer struct {
+	mu      sync.Mutex
+	stop    func()
+	started time.Time
+	baseEnv map[string]string
+	cache   *daemon.Cache
+	repos   map[string]*repoState
+	// configStamp identifies the configuration currently loaded, and
+	// promptStamp the prompt template files it reads.
+	configStamp string
+	promptStamp string
+	// entries mirrors cache.Len for ping.
+	entries atomic.Int64
+
+	// Pre-generation runs one repository at a time, no more often than
+	// nextPregen allows; failures add an increasing backoff.
+	pregenerating bool
+	nextPregen    time.Time
+	backoff       time.Duration
+}
+
+// repoState is what the daemon knows about a repository it has served.
+type repoState struct {
+	// req is the last suggestion request made in the repository; its
+	// directory, environment and flags are reused for pre-generation.
+	req        daemon.Request
+	stampPaths []string
+	stamp      string
+	// ctx is the staged change collected for stamp, or nil.
+	ctx *gitContext
+	// changed is when the index last changed, until pre-generation has
+	// been considered for it.
+	changed time.Time
+
+	pregenerate bool
+	debounce    time.Duration
+	minInterval time.Duration
+}
+
+func newDaemonServer(stop func()) *daemonServer {
+	return &daemonServer{
+		stop:    stop,
+		started: time.Now(),
+		baseEnv: forwardedEnv(),
+		cache:   daemon.NewCache(daemonCacheSize),
+		repos:   map[string]*repoState{},
+	}
+}
+
+func (s *daemonServer) handle(req daemon.Request) daemon.Response {
+	switch req.Op {
+	case daemon.OpPing:
+		// Answered without the lock so status works during a slow request.
+		return daemon.Response{Version: version.String(), PID: os.Getpid(), Started: s.started, Entries: int(s.entries.Load())}
+	case daemon.OpStop:
+		s.stop()
+		return daemon.Response{}
+	case daemon.OpSuggest:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.suggest(req)
+	}
+	return daemon.Response{Error: fmt.Sprintf("daemon: unknown op %q", req.Op)}
+}
+
+func (s *daemonServer) suggest(req daemon.Request) daemon.Response {
+	defer func() { s.entries.Store(int64(s.cache.Len())) }()
+	restore, err := s.enter(req)
+	defer restore()
+	if err != nil {
+		return daemon.Response{Error: err.Error()}
+	}
+	s.loadConfig(req)
+
+	c, repo, err := s.context()
+	if err != nil {
+		return daemon.Response{Error: err.Error()}
+	}
+	if st := s.repos[repo]; st != nil && os.Getenv("DIFFSCRIBE_STASH_COMMIT") == "" && stagedSource() {
+		st.req = req
+		st.pregenerate = viper.GetBool("daemon.pregenerate")
+		st.debounce = viper.GetDuration("daemon.debounce")
+		st.minInterval = viper.GetDuration("daemon.min_interval")
+	}
+	if suggestions, ok := s.cached(c, req.Prefix); ok {
+		return daemon.Response{Suggestions: suggestions, Cached: true}
+	}
+
+	suggestions, generated, err := generateSuggestions(c, req.Prefix)
+	if err != nil {
+		return daemon.Response{Error: err.Error()}
+	}
+	if generated {
+		s.cache.Put(repo, s.cacheKey(c, req.Prefix), suggestions)
+	}
+	return daemon.Response{Suggestions: suggestions}
+}
+
+func (s *daemonServer) cacheKey(c gitContext, prefix string) string {
+	return daemon.Key(s.configStamp, s.promptStamp, prefix, c.Branch, strings.Join(c.Paths, "\n"), c.Diff)
+}
+
+// cached looks up suggestions for c and prefix. Without an exact entry, the
+// suggestions generated for no prefix, usually by pre-generation, are reused
+// when some of them continue the prefix.
+func (s *daemonServer) cached(c gitContext, prefix string) ([]string, bool) {
+	if suggestions, ok := s.cache.Get(s.cacheKey(c, prefix)); ok {
+		return suggestions, true
+	}
+	if strings.TrimSpace(prefix) == "" {
+		return nil, false
+	}
+	all, ok := s.cache.Get(s.cacheKey(c, ""))
+	if !ok {
+		return nil, false
+	}
+	var matching []string
+	for _, sug := range all {
+		if spliced, ok := llm.ContinuePrefix(sug, strings.TrimSpace(prefix)); ok {
+			matching = append(matching, spliced)
+		}
+	}
+	return matching, len(matching) > 0
+}
+
+// loadConfig reloads the configuration when anything it depends on differs
+// from what is loaded, and stamps the prompt templates it reads, which may
+// change without the configuration changing.
+func (s *daemonServer) loadConfig(req daemon.Request) {
+	if stamp := configStamp(req); stamp != s.configStamp {
+		resetConfig()
+		for _, w := range configWarnings {
+			debugf("%s", w)
+		}
+		s.configStamp = stamp
+	}
+	files := promptFiles()
+	s.promptStamp = daemon.Key(strings.Join(files, "\n"), daemon.Stamp(files...))
+}
+
+// enter switches the process to the client's directory, environment and
+// flags. The returned function restores the daemon's own.
+func (s *daemonServer) enter(req daemon.Request) (func(), error) {
+	var undo []func()
+	restore := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+
+	if req.Dir != "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return restore, err
+		}
+		if err := os.Chdir(req.Dir); err != nil {
+			return restore, fmt.Errorf("diffscribe: %w", err)
+		}
+		undo = append(undo, func() { _ = os.Chdir(wd) })
+	}
+
+	setEnv(req.Env)
+	undo = append(undo, func() { setEnv(s.baseEnv) })
+
+	for name, value := range req.Flags {
+		f := rootFlags.Lookup(name)
+		if f == nil {
+			continue
+		}
+		prev, changed := f.Value.String(), f.Changed
+		// Registered first: a failed Set may still have changed the value.
+		undo = append(undo, func() {
+			_ = f.Value.Set(prev)
+			f.Changed = changed
+		})
+		if err := f.Value.Set(value); err != nil {
+			return restore, fmt.Errorf("diffscribe: invalid --%s: %w", name, err)
+		}
+		f.Changed = true
+	}
+	return restore, nil
+}
+
+// context returns the staged change, reusing the last collection for the
+// repository while its index and HEAD are unchanged. Stash requests from the
+// completion scripts and other sources are always collected afresh.
+func (s *daemonServer) context() (gitContext, string, error) {
+	gitDir := findGitDir()
+	if gitDir == "" || os.Getenv("DIFFSCRIBE_STASH_COMMIT") != "" || !stagedSource() {
+		c, err := collectContext()
+		return c, gitDir, err
+	}
+
+	st, ok := s.repos[gitDir]
+	if !ok {
+		st = &repoState{stampPaths: []string{indexFile(gitDir), filepath.Join(gitDir, "HEAD")}}
+		s.repos[gitDir] = st
+	}
+	stamp := daemon.Stamp(st.stampPaths...)
+	if st.ctx != nil && st.stamp == stamp {
+		return *st.ctx, gitDir, nil
+	}
+	c, err := collectContext()
+	if err != nil {
+		return c, gitDir, err
+	}
+	st.ctx, st.stamp, st.changed = &c, stamp, time.Time{}
+	return c, gitDir, nil
+}
+
+// watch polls the index of every repository served so far. A change drops
+// the repository's cached context and responses and, once the index has
+// been quiet for daemon.debounce, may start pre-generation.
+func (s *daemonServer) watch(ctx context.Context) {
+	t := time.NewTicker(daemonPollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			s.poll(now)
+			s.entries.Store(int64(s.cache.Len()))
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *daemonServer) poll(now time.Time) {
+	for repo, st := range s.repos {
+		stamp := daemon.Stamp(st.stampPaths...)
+		timing := pregenTiming{
+			indexChanged: stamp != st.stamp,
+			changed:      st.changed,
+			debounce:     st.debounce,
+			enabled:      st.pregenerate,
+			busy:         s.pregenerating,
+			next:         s.nextPregen,
+		}
+		switch decidePregen(timing, now) {
+		case pregenReset:
+			debugf("index changed in %s", repo)
+			st.stamp, st.ctx, st.changed = stamp, nil, now
+			s.cache.DropRepo(repo)
+		case pregenSettle:
+			st.changed = time.Time{}
+		case pregenStart:
+			st.changed = time.Time{}
+			s.pregenerating = true
+			go s.pregenerate(repo)
+		}
+	}
+}
+
+// pregenAction is what poll does for a repository.
+type pregenAction int
+
+const (
+	// pregenWait leaves the repository for a later poll.
+	pregenWait pregenAction = iota
+	// pregenReset drops what is cached for the repository, whose index
+	// changed, and starts the debounce.
+	pregenReset
+	// pregenSettle forgets a change that settled with pre-generation off.
+	pregenSettle
+	// pregenStart starts pre-generation.
+	pregenStart
+)
+
+// pregenTiming is what decidePregen needs to know about a repository.
+type pregenTiming struct {
+	// indexChanged reports whether the index differs from the last poll.
+	indexChanged bool
+	// changed is when the index last changed, or zero once handled.
+	changed  time.Time
+	debounce time.Duration
+	enabled  bool
+	// busy reports whether a pre-generation is already running.
+	busy bool
+	// next is the earliest start that min_interval and the backoff allow.
+	next time.Time
+}
+
+// decidePregen decides what poll does for a repository at now. A change
+// must be quiet for the debounce before it is acted on, and pre-generation
+// then waits for any other run and for next.
+func decidePregen(t pregenTiming, now time.Time) pregenAction {
+	switch {
+	case t.indexChanged:
+		return pregenReset
+	case t.changed.IsZero() || now.Sub(t.changed) < t.debounce:
+		return pregenWait
+	case !t.enabled:
+		return pregenSettle
+	case t.busy || now.Before(t.next):
+		return pregenWait
+	}
+	return pregenStart
+}
+
+// nextPregenAfter returns the backoff, and the earliest time another
+// pre-generation may start, after one finished at now: min_interval later,
+// plus a backoff that doubles with each failure up to daemonMaxBackoff and
+// is cleared by a success.
+func nextPregenAfter(backoff, interval time.Duration, failed bool, now time.Time) (time.Duration, time.Time) {
+	if !failed {
+		return 0, now.Add(interval)
+	}
+	backoff = min(max(2*backoff, interval), daemonMaxBackoff)
+	return backoff, now.Add(interval + backoff)
+}
+
+// pregenerate generates suggestions for the staged changes in repo, as the
+// last request made there would, and caches them. Suggestion requests that
+// arrive meanwhile wait for it and are then answered from the cache.
+func (s *daemonServer) pregenerate(repo string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		s.pregenerating = false
+		s.entries.Store(int64(s.cache.Len()))
+	}()
+
+	st := s.repos[repo]
+	if st == nil {
+		return
+	}
+	restore, err := s.enter(st.req)
+	defer restore()
+	if err != nil {
+		debugf("pre-generation skipped in %s: %v", repo, err)
+		return
+	}
+	s.loadConfig(st.req)
+	if !viper.GetBool("daemon.pregenerate") {
+		return
+	}
+
+	c, _, err := s.context()
+	if err != nil || len(c.Paths) == 0 {
+		return
+	}
+	if _, ok := s.cache.Get(s.cacheKey(c, "")); ok {
+		return
+	}
+	debugf("pre-generating suggestions in %s", repo)
+	suggestions, generated, err := generateSuggestions(c, "")
+	// A failure is likely rate limiting or being offline: back off.
+	failed := err != nil || !generated
+	s.backoff, s.nextPregen = nextPregenAfter(s.backoff, viper.GetDuration("daemon.min_interval"), failed, time.Now())
+	if !failed {
+		s.cache.Put(repo, s.cacheKey(c, ""), suggestions)
+	}
+}
+
+// configStamp fingerprints everything the configuration is loaded from: the
+// directory, forwarded environment and flags, and every config file that
+// could apply there.
+func configStamp(req daemon.Request) string {
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	var files []string
+	dir, _ := os.Getwd()
+	for d := dir; ; d = filepath.Dir(d) {
+		files = append(files, configCandidates(d)...)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	files = append(files, configCandidates(filepath.Join(xdg, "diffscribe"))...)
+	files = append(files, configCandidates(home)...)
+	files = append(files, filepath.Join(home, ".gitconfig"), filepath.Join(xdg, "git", "config"))
+	if gitDir := findGitDir(); gitDir != "" {
+		files = append(files, filepath.Join(gitDir, "config"))
+	}
+	if cfgFile != "" {
+		files = append(files, cfgFile)
+	}
+
+	return daemon.Key(dir, joinSorted(req.Env), joinSorted(req.Flags), daemon.Stamp(files...))
+}
+
+// promptFiles lists the prompt template files the loaded configuration
+// reads for suggestions, as loadPrompt and renderTemplate resolve them.
+func promptFiles() []string {
+	var files []string
+	for _, key := range []string{"system_prompt", "user_prompt"} {
+		if path := strings.TrimSpace(viper.GetString(key + "_file")); path != "" && !flagChanged(key) {
+			files = append(files, resolveConfigPath(key+"_file", path))
+		}
+	}
+	for _, pattern := range viper.GetStringSlice("prompt_includes") {
+		matches, _ := filepath.Glob(resolveConfigPath("prompt_includes", pattern))
+		files = append(files, matches...)
+	}
+	return files
+}
+
+func joinSorted(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\x00")
+}
+
+// findGitDir locates the git directory for the working directory without
+// running git: $GIT_DIR, or the nearest .git directory or gitfile.
+func findGitDir() string {
+	if dir := os.Getenv("GIT_DIR"); dir != "" {
+		abs, _ := filepath.Abs(dir)
+		return abs
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		candidate := filepath.Join(d, ".git")
+		if info, err := os.Stat(candidate); err == nil {
+			if info.IsDir() {
+				return candidate
+			}
+			b, err := os.ReadFile(candidate)
+			if err != nil {
+				return ""
+			}
+			target, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir: ")
+			if !ok {
+				return ""
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(d, target)
+			}
+			return filepath.Clean(target)
+		}
+		if filepath.Dir(d) == d {
+			return ""
+		}
+	}
+}
+
+func indexFile(gitDir string) string {
+	if f := os.Getenv("GIT_INDEX_FILE"); f != "" {
+		abs, _ := filepath.Abs(f)
+		return abs
+	}
+	return filepath.Join(gitDir, "index")
+}
+
+// isForwardedEnv reports whether a variable affects how suggestions are
+// generated and is therefore passed from the CLI to the daemon.
+func isForwardedEnv(name string) bool {
+	if name == "DIFFSCRIBE_DAEMON" || name == "DIFFSCRIBE_DAEMON_SOCKET" || name == "DIFFSCRIBE_REPO" {
+		return false
+	}
+	return name == "OPENAI_API_KEY" || strings.HasPrefix(name, "DIFFSCRIBE_") || strings.HasPrefix(name, "GIT_")
+}
+
+func forwardedEnv() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if isForwardedEnv(name) {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// setEnv replaces every forwarded variable with those in env.
+func setEnv(env map[string]string) {
+	for name := range forwardedEnv() {
+		if _, ok := env[name]; !ok {
+			os.Unsetenv(name)
+		}
+	}
+	for name, value := range env {
+		if isForwardedEnv(name) {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+// suggestViaDaemon asks a running daemon for suggestions. It reports false
+// when there is no daemon or it fails, so the caller can work in-process.
+func suggestViaDaemon(prefix string) ([]string, bool) {
+	req, ok := daemonSuggestRequest(prefix)
+	if !ok {
+		return nil, false
+	}
+	return askDaemon(req)
+}
+
+// daemonSuggestRequest builds the request suggestViaDaemon sends for the
+// current directory and flags. It reports false when the daemon is bypassed.
+func daemonSuggestRequest(prefix string) (daemon.Request, bool) {
+	// Pathspecs are not forwarded; those requests are answered in-process.
+	if os.Getenv("DIFFSCRIBE_DAEMON") == "0" || len(pathspecs) > 0 {
+		return daemon.Request{}, false
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return daemon.Request{}, false
+	}
+	flags := map[string]string{}
+	rootFlags.VisitAll(func(f *pflag.Flag) {
+		// The daemon is sent the directory --repo selected.
+		if f.Changed && f.Name != "version" && f.Name != "repo" {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	return daemon.Request{
+		Op:     daemon.OpSuggest,
+		Dir:    dir,
+		Prefix: prefix,
+		Env:    forwardedEnv(),
+		Flags:  flags,
+	}, true
+}
+
+// askDaemon sends a request built by daemonSuggestRequest. It depends on
+// neither the working directory nor the configuration.
+func askDaemon(req daemon.Request) ([]string, bool) {
+	resp, err := daemon.Call(daemon.SocketPath(), req, daemonCallTimeout)
+	if errors.Is(err, daemon.ErrUnsafeDir) {
+		// The request would carry API keys to whoever owns the socket.
+		debugf("daemon skipped: %v", err)
+		return nil, false
+	}
+	if err != nil {
+		debugf("daemon unavailable: %v", err)
+		return nil, false
+	}
+	if resp.Error != "" {
+		debugf("daemon failed: %s", resp.Error)
+		return nil, false
+	}
+	debugf("daemon answered (cached: %v)", resp.Cached)
+	return resp.Suggestions, true
+}
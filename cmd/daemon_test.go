@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rogwilco/diffscribe/internal/daemon"
+)
+
+// daemonRequest is a suggestion request from dir, forwarding the test's
+// environment with env over it. An empty value leaves the variable out.
+func daemonRequest(dir string, env, flags map[string]string) daemon.Request {
+	forwarded := forwardedEnv()
+	for name, value := range env {
+		forwarded[name] = value
+		if value == "" {
+			delete(forwarded, name)
+		}
+	}
+	return daemon.Request{Op: daemon.OpSuggest, Dir: dir, Env: forwarded, Flags: flags}
+}
+
+func TestDaemonServerRestoresState(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := filepath.Join(tmp, "api")
+	stageFile(t, api, "server.go")
+	writeFile(t, filepath.Join(api, ".diffscribe.yaml"), "llm:\n  provider: fake\nquantity: 3\n")
+	web := filepath.Join(tmp, "web")
+	stageFile(t, web, "page.go")
+	writeFile(t, filepath.Join(web, ".diffscribe.yaml"), "llm:\n  provider: fake\nquantity: 4\n")
+
+	start := filepath.Join(tmp, "start")
+	if err := os.MkdirAll(start, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(start)
+	// The daemon's own environment must not leak into requests that lack
+	// the variable, and must be restored after them.
+	t.Setenv("DIFFSCRIBE_QUANTITY", "5")
+	s := newDaemonServer(func() {})
+	quantity := rootFlags.Lookup("quantity")
+
+	cases := []struct {
+		name       string
+		req        daemon.Request
+		want       int
+		wantErr    bool
+		wantCached bool
+	}{
+		{name: "api", req: daemonRequest(api, map[string]string{"DIFFSCRIBE_QUANTITY": ""}, nil), want: 3},
+		{name: "web", req: daemonRequest(web, map[string]string{"DIFFSCRIBE_QUANTITY": ""}, nil), want: 4},
+		{name: "environment", req: daemonRequest(api, map[string]string{"DIFFSCRIBE_QUANTITY": "2"}, nil), want: 2},
+		{name: "flag over environment", req: daemonRequest(web, map[string]string{"DIFFSCRIBE_QUANTITY": "2"}, map[string]string{"quantity": "1"}), want: 1},
+		{name: "api again", req: daemonRequest(api, map[string]string{"DIFFSCRIBE_QUANTITY": ""}, nil), want: 3, wantCached: true},
+		{name: "invalid flag", req: daemonRequest(api, nil, map[string]string{"quantity": "many"}), wantErr: true},
+		{name: "missing directory", req: daemonRequest(filepath.Join(tmp, "missing"), nil, nil), wantErr: true},
+	}
+	for _, tc := range cases {
+		resp := s.handle(tc.req)
+		switch {
+		case tc.wantErr && resp.Error == "":
+			t.Errorf("%s: no error", tc.name)
+		case !tc.wantErr && resp.Error != "":
+			t.Errorf("%s: %s", tc.name, resp.Error)
+		case !tc.wantErr && (len(resp.Suggestions) != tc.want || resp.Cached != tc.wantCached):
+			t.Errorf("%s: %d suggestions (cached %v), want %d (cached %v)", tc.name, len(resp.Suggestions), resp.Cached, tc.want, tc.wantCached)
+		}
+
+		if cwd, _ := os.Getwd(); cwd != start {
+			t.Errorf("%s: working directory left at %s", tc.name, cwd)
+		}
+		if got := os.Getenv("DIFFSCRIBE_QUANTITY"); got != "5" {
+			t.Errorf("%s: DIFFSCRIBE_QUANTITY left at %q", tc.name, got)
+		}
+		if quantity.Changed || quantity.Value.String() != "5" {
+			t.Errorf("%s: --quantity left at %s (changed %v)", tc.name, quantity.Value, quantity.Changed)
+		}
+	}
+
+	// Editing a config file reloads the configuration.
+	writeFile(t, filepath.Join(api, ".diffscribe.yaml"), "llm:\n  provider: fake\nquantity: 1 # edited\n")
+	if resp := s.handle(daemonRequest(api, map[string]string{"DIFFSCRIBE_QUANTITY": ""}, nil)); len(resp.Suggestions) != 1 || resp.Cached {
+		t.Errorf("after editing the config: %d suggestions (cached %v), want 1 generated", len(resp.Suggestions), resp.Cached)
+	}
+}
+
+func TestDaemonCacheFollowsPromptFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	repo, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageFile(t, repo, "main.go")
+	writeFile(t, ".diffscribe.yaml", "llm:\n  provider: fake\nuser_prompt_file: prompts/user.tmpl\nprompt_includes: [prompts/*.inc]\n")
+	writeFile(t, "prompts/user.tmpl", "{{ template \"files.inc\" . }}\n{{ .Diff }}")
+	writeFile(t, "prompts/files.inc", "{{ range .Paths }}- {{ . }}\n{{ end }}")
+	s := newDaemonServer(func() {})
+	req := daemonRequest(repo, nil, nil)
+
+	steps := []struct {
+		name       string
+		edit       func()
+		wantCached bool
+	}{
+		{"first request", func() {}, false},
+		{"unchanged", func() {}, true},
+		{"prompt file edited", func() { writeFile(t, "prompts/user.tmpl", "Files:\n{{ template \"files.inc\" . }}\n{{ .Diff }}") }, false},
+		{"include edited", func() { writeFile(t, "prompts/files.inc", "{{ range .Paths }}* {{ . }}\n{{ end }}\n") }, false},
+		{"include added", func() { writeFile(t, "prompts/extra.inc", "{{ define \"extra\" }}{{ end }}") }, false},
+		{"unchanged again", func() {}, true},
+	}
+	for _, step := range steps {
+		step.edit()
+		resp := s.handle(req)
+		if resp.Error != "" {
+			t.Fatalf("%s: %s", step.name, resp.Error)
+		}
+		if resp.Cached != step.wantCached {
+			t.Errorf("%s: cached = %v, want %v", step.name, resp.Cached, step.wantCached)
+		}
+	}
+}
+
+func TestDecidePregen(t *testing.T) {
+	const debounce = 1500 * time.Millisecond
+	t0 := time.Unix(1_700_000_000, 0)
+	type poll struct {
+		at           time.Duration
+		indexChanged bool
+		want         pregenAction
+	}
+	cases := []struct {
+		name    string
+		enabled bool
+		busy    bool
+		next    time.Duration
+		polls   []poll
+	}{
+		{
+			name:    "burst of changes within the debounce",
+			enabled: true,
+			polls: []poll{
+				{0, true, pregenReset},
+				{500 * time.Millisecond, true, pregenReset},
+				{time.Second, true, pregenReset},
+				{2 * time.Second, false, pregenWait},
+				{2400 * time.Millisecond, false, pregenWait},
+				{2500 * time.Millisecond, false, pregenStart},
+				{3 * time.Second, false, pregenWait},
+			},
+		},
+		{
+			name: "settles with pre-generation off",
+			polls: []poll{
+				{0, true, pregenReset},
+				{time.Second, false, pregenWait},
+				{2 * time.Second, false, pregenSettle},
+				{3 * time.Second, false, pregenWait},
+			},
+		},
+		{
+			name:    "waits for min_interval or backoff",
+			enabled: true,
+			next:    4 * time.Second,
+			polls: []poll{
+				{0, true, pregenReset},
+				{2 * time.Second, false, pregenWait},
+				{3999 * time.Millisecond, false, pregenWait},
+				{4 * time.Second, false, pregenStart},
+			},
+		},
+		{
+			name:    "waits for another repository",
+			enabled: true,
+			busy:    true,
+			polls: []poll{
+				{0, true, pregenReset},
+				{10 * time.Second, false, pregenWait},
+			},
+		},
+		{
+			name:    "nothing changed",
+			enabled: true,
+			polls:   []poll{{0, false, pregenWait}, {time.Minute, false, pregenWait}},
+		},
+	}
+	for _, tc := range cases {
+		// changed follows the polls as poll updates it.
+		var changed time.Time
+		for _, p := range tc.polls {
+			now := t0.Add(p.at)
+			timing := pregenTiming{
+				indexChanged: p.indexChanged,
+				changed:      changed,
+				debounce:     debounce,
+				enabled:      tc.enabled,
+				busy:         tc.busy,
+				next:         t0.Add(tc.next),
+			}
+			got := decidePregen(timing, now)
+			if got != p.want {
+				t.Errorf("%s: at %s got %d, want %d", tc.name, p.at, got, p.want)
+			}
+			switch got {
+			case pregenReset:
+				changed = now
+			case pregenSettle, pregenStart:
+				changed = time.Time{}
+			}
+		}
+	}
+}
+
+func TestNextPregenAfter(t *testing.T) {
+	const interval = 10 * time.Second
+	now := time.Unix(1_700_000_000, 0)
+	cases := []struct {
+		name        string
+		outcomes    []bool // failed
+		wantBackoff time.Duration
+	}{
+		{"success", []bool{false}, 0},
+		{"failure backs off", []bool{true}, interval},
+		{"repeated failures double", []bool{true, true, true}, 4 * interval},
+		{"backoff is capped", []bool{true, true, true, true, true, true, true, true}, daemonMaxBackoff},
+		{"success clears the backoff", []bool{true, true, true, false}, 0},
+		{"failure after success starts over", []bool{true, true, false, true}, interval},
+	}
+	for _, tc := range cases {
+		var backoff time.Duration
+		var next time.Time
+		for _, failed := range tc.outcomes {
+			backoff, next = nextPregenAfter(backoff, interval, failed, now)
+		}
+		if backoff != tc.wantBackoff || !next.Equal(now.Add(interval+tc.wantBackoff)) {
+			t.Errorf("%s: backoff %s, next in %s; want %s, %s", tc.name, backoff, next.Sub(now), tc.wantBackoff, interval+tc.wantBackoff)
+		}
+	}
+}
@@ -9,7 +9,12 @@ type exitError struct {
 
 func (e *exitError) Error() string { return e.msg }
 
-var errNoSuggestions = &exitError{code: 10, msg: "no suggestions"}
+var (
+	errNoSuggestions      = &exitError{code: 10, msg: "no suggestions"}
+	errLintFailed         = &exitError{code: 11, msg: "commit message failed lint"}
+	errConfigInvalid      = &exitError{code: 12, msg: "configuration is invalid"}
+	errEvalBelowThreshold = &exitError{code: 13, msg: "evaluation below threshold"}
+)
 
 // ExitCode returns the desired process exit code for the given error.
 func ExitCode(err error) int {
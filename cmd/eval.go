@@ -0,0 +1,427 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rogwilco/diffscribe/internal/config"
+	"github.com/rogwilco/diffscribe/internal/eval"
+	"github.com/rogwilco/diffscribe/internal/lint"
+	"github.com/rogwilco/diffscribe/internal/llm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	evalSample        int
+	evalSave          string
+	evalVariants      []string
+	evalJudge         bool
+	evalJudgeModel    string
+	evalOutput        string
+	evalDetails       bool
+	evalMinCompliance float64
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval [dataset]",
+	Short: "Score generated messages against a dataset of real commits",
+	Long: `eval replays recorded changes through the current prompts, format and model
+and compares the suggestions with the messages people actually wrote. Each
+configuration is scored on:
+
+  compliant     share of suggestions passing the lint rules for the format
+  within limit  share of subjects no longer than lint.subject_max_length
+  avg len       mean subject length
+  similarity    best word overlap (F1) between a suggestion and the real subject
+  top-1         the same overlap for the first suggestion only
+  judge         mean 1-5 score from an LLM judge (with --judge)
+
+A dataset is a JSONL file with one change per line:
+
+  {"id": "a1b2c3", "paths": ["cmd/root.go"], "diff": "...", "message": "fix: ..."}
+
+Cases may also record "source", "files" and "declarations", which are sent to
+the model as a normal run would send them; declarations only when
+semantic.enabled is set. Cases without them are replayed without them.
+
+Instead of a dataset, --sample N takes the last N non-merge commits of the
+current repository, with their files and, when semantic.enabled is set, their
+declarations; --save writes them out as a dataset to replay later.
+
+--variant compares configurations side by side. A variant is either the name
+of a profile or comma-separated key=value settings, applied over the current
+configuration:
+
+  diffscribe eval golden.jsonl --variant current --variant llm.model=gpt-4o --variant terse
+
+With llm.provider set to fake, suggestions are derived locally from the
+changed file names, so runs are deterministic and need no API key. That is
+meant for exercising prompts, formats and the harness itself in CI.`,
+	Example: `  # build a golden dataset from recent history, then score it
+  diffscribe eval --sample 50 --save golden.jsonl
+  diffscribe eval golden.jsonl
+
+  # compare two models and a profile, with an LLM judge
+  diffscribe eval golden.jsonl --variant llm.model=gpt-4o-mini --variant llm.model=gpt-4o --variant terse --judge
+
+  # offline run for CI that fails below 90% compliance
+  diffscribe eval golden.jsonl --llm-provider fake --min-compliance 0.9 --output json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if evalOutput != "table" && evalOutput != "json" {
+			return fmt.Errorf("diffscribe: unknown --output %q (want table or json)", evalOutput)
+		}
+		cases, err := evalCases(args)
+		if err != nil {
+			return err
+		}
+		if evalSave != "" {
+			if err := saveDataset(evalSave, cases); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "diffscribe: wrote %d cases to %s\n", len(cases), evalSave)
+		}
+
+		var judge *llm.Config
+		if evalJudge {
+			cfg := baseLLMConfig()
+			if evalJudgeModel != "" {
+				cfg.Model = evalJudgeModel
+			}
+			if err := requireLLMConfig(cfg); err != nil {
+				return err
+			}
+			judge = &cfg
+		}
+
+		variants := evalVariants
+		if len(variants) == 0 {
+			variants = []string{"current"}
+		}
+		var report evalReport
+		for _, v := range variants {
+			overrides, err := variantSettings(v)
+			if err != nil {
+				return err
+			}
+			var scores []eval.Score
+			withSettings(overrides, func() {
+				debugf("evaluating %s on %d cases", v, len(cases))
+				for _, c := range cases {
+					scores = append(scores, evalCase(cmd.Context(), c, judge))
+				}
+			})
+			report.Variants = append(report.Variants, evalVariantReport{
+				Summary: eval.Summarize(v, scores),
+				Scores:  scores,
+			})
+		}
+
+		out := cmd.OutOrStdout()
+		if evalOutput == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+		} else {
+			writeEvalReport(out, report, evalDetails)
+		}
+
+		if evalMinCompliance > 0 {
+			for _, v := range report.Variants {
+				if v.Compliance < evalMinCompliance {
+					return errEvalBelowThreshold
+				}
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	evalCmd.Flags().IntVar(&evalSample, "sample", 0, "sample the last N non-merge commits of the current repository instead of reading a dataset")
+	evalCmd.Flags().StringVar(&evalSave, "save", "", "write the evaluated cases to this JSONL dataset")
+	evalCmd.Flags().StringArrayVar(&evalVariants, "variant", nil, "configuration to evaluate: a profile name or key=value[,key=value] (repeatable; default: current)")
+	evalCmd.Flags().BoolVar(&evalJudge, "judge", false, "also score suggestions with an LLM judge")
+	evalCmd.Flags().StringVar(&evalJudgeModel, "judge-model", "", "model for the judge (default: llm.model)")
+	evalCmd.Flags().StringVar(&evalOutput, "output", "table", "report format: table or json")
+	evalCmd.Flags().BoolVar(&evalDetails, "details", false, "list every case in the table report")
+	evalCmd.Flags().Float64Var(&evalMinCompliance, "min-compliance", 0, "exit with status 13 when any variant's compliance is below this fraction")
+	rootCmd.AddCommand(evalCmd)
+}
+
+type evalReport struct {
+	Variants []evalVariantReport `json:"variants"`
+}
+
+type evalVariantReport struct {
+	eval.Summary
+	Scores []eval.Score `json:"scores"`
+}
+
+func evalCases(args []string) ([]eval.Case, error) {
+	switch {
+	case len(args) > 0 && evalSample > 0:
+		return nil, errors.New("diffscribe: pass either a dataset or --sample, not both")
+	case len(args) > 0:
+		cases, err := eval.LoadDataset(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("diffscribe: unable to load dataset: %w", err)
+		}
+		if len(cases) == 0 {
+			return nil, fmt.Errorf("diffscribe: dataset %s is empty", args[0])
+		}
+		return cases, nil
+	case evalSample > 0:
+		return sampleCommits(evalSample)
+	}
+	return nil, errors.New("diffscribe: pass a dataset or --sample N")
+}
+
+// sampleCommits turns the last n non-merge commits into evaluation cases,
+// collected the same way as a commit passed to describe_range, including
+// declarations when semantic analysis is enabled.
+func sampleCommits(n int) ([]eval.Case, error) {
+	hashes := nonEmptyLines(run("git", "log", "--no-merges", "-n", strconv.Itoa(n), "--format=%H"))
+	if len(hashes) == 0 {
+		return nil, errors.New("diffscribe: no commits to sample")
+	}
+	var cases []eval.Case
+	for _, h := range hashes {
+		gc, err := collectRangeContext(h)
+		if err != nil {
+			return nil, err
+		}
+		if len(gc.Paths) == 0 {
+			continue
+		}
+		c := eval.Case{
+			ID:      h[:min(12, len(h))],
+			Source:  gc.Source,
+			Paths:   gc.Paths,
+			Diff:    gc.Diff,
+			Message: strings.TrimSpace(run("git", "log", "-1", "--format=%B", h)),
+		}
+		for _, f := range gc.Files {
+			c.Files = append(c.Files, eval.File(f))
+		}
+		for _, d := range gc.Declarations {
+			c.Declarations = append(c.Declarations, eval.Declaration(d))
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+func saveDataset(path string, cases []eval.Case) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("diffscribe: unable to save dataset: %w", err)
+	}
+	if err := eval.WriteDataset(f, cases); err != nil {
+		f.Close()
+		return fmt.Errorf("diffscribe: unable to save dataset: %w", err)
+	}
+	return f.Close()
+}
+
+// variantSettings resolves a --variant into flattened config overrides:
+// "current" is the configuration as loaded, key=value pairs are parsed like
+// config set values, and anything else names a profile.
+func variantSettings(spec string) (map[string]any, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "current" {
+		return nil, nil
+	}
+
+	settings := map[string]any{}
+	if strings.Contains(spec, "=") {
+		for _, pair := range strings.Split(spec, ",") {
+			key, raw, ok := strings.Cut(pair, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if !ok || key == "" {
+				return nil, fmt.Errorf("diffscribe: invalid --variant %q (want key=value[,key=value])", spec)
+			}
+			var value any
+			if err := yaml.Unmarshal([]byte(raw), &value); err != nil || value == nil {
+				value = raw
+			}
+			setNested(settings, key, value)
+		}
+		if problems := config.Validate(settings); len(problems) > 0 {
+			return nil, fmt.Errorf("diffscribe: invalid --variant %q: %s", spec, problems[0])
+		}
+	} else {
+		profiles, _ := viper.Get("profiles").(map[string]any)
+		profile, ok := profiles[strings.ToLower(spec)].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("diffscribe: unknown profile %q in --variant", spec)
+		}
+		for k, v := range profile {
+			if k != "match" {
+				settings[k] = v
+			}
+		}
+	}
+
+	overrides := map[string]any{}
+	flattenSettings(settings, "", overrides)
+	return overrides, nil
+}
+
+func flattenSettings(settings map[string]any, prefix string, out map[string]any) {
+	for k, v := range settings {
+		key := strings.ToLower(prefix + k)
+		if nested, ok := v.(map[string]any); ok && len(nested) > 0 {
+			flattenSettings(nested, key+".", out)
+			continue
+		}
+		out[key] = v
+	}
+}
+
+// withSettings runs fn with overrides set over the current configuration and
+// restores the previous values afterwards.
+func withSettings(overrides map[string]any, fn func()) {
+	previous := make(map[string]any, len(overrides))
+	for key, value := range overrides {
+		previous[key] = viper.Get(key)
+		viper.Set(key, value)
+	}
+	defer func() {
+		for key, value := range previous {
+			viper.Set(key, value)
+		}
+	}()
+	fn()
+}
+
+// evalCase generates suggestions for c with the current configuration and
+// scores them. Failures are recorded on the score rather than aborting the
+// run.
+func evalCase(ctx context.Context, c eval.Case, judge *llm.Config) eval.Score {
+	gc := caseContext(c)
+	failed := func(err error) eval.Score {
+		return eval.Score{Case: c.ID, Reference: c.Subject(), Error: err.Error()}
+	}
+	cfg, err := newLLMConfig(newTemplateData(gc, ""))
+	if err != nil {
+		return failed(err)
+	}
+	if err := requireLLMConfig(cfg); err != nil {
+		return failed(err)
+	}
+
+	data := llm.Context{
+		Branch:       gc.Branch,
+		Source:       gc.Source,
+		Paths:        gc.Paths,
+		Files:        gc.Files,
+		Declarations: gc.Declarations,
+		Diff:         gc.Diff,
+	}
+	res, err := llm.Generate(ctx, data, cfg)
+	recordUsage("eval", cfg, res.Usage)
+	rules := lintRules()
+	score := eval.ScoreSuggestions(c, res.Suggestions, func(s string) bool {
+		return len(lint.LintSubject(s, rules)) == 0
+	}, rules.SubjectMaxLength)
+	score.Tokens = res.Usage.TotalTokens
+	if err != nil {
+		score.Error = err.Error()
+		return score
+	}
+
+	if judge != nil && len(res.Suggestions) > 0 {
+		j, err := llm.Judge(ctx, data, c.Message, res.Suggestions, *judge)
+		recordUsage("eval", *judge, j.Usage)
+		if err != nil {
+			score.Error = "judge: " + err.Error()
+			return score
+		}
+		total, n := 0, 0
+		for _, s := range j.Scores {
+			if s > 0 {
+				total += s
+				n++
+			}
+		}
+		if n > 0 {
+			score.Judge = float64(total) / float64(n)
+		}
+	}
+	return score
+}
+
+func writeEvalReport(out io.Writer, report evalReport, details bool) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VARIANT\tCASES\tERRORS\tCOMPLIANT\tWITHIN LIMIT\tAVG LEN\tSIMILARITY\tTOP-1\tJUDGE\tTOKENS")
+	for _, v := range report.Variants {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%.1f\t%.2f\t%.2f\t%s\t%d\n",
+			v.Variant, v.Cases, v.Errors, percent(v.Compliance), percent(v.WithinLimit),
+			v.MeanLength, v.Similarity, v.TopSimilarity, judgeScore(v.Judge), v.Tokens)
+	}
+	_ = w.Flush()
+
+	if !details {
+		return
+	}
+	for _, v := range report.Variants {
+		fmt.Fprintf(out, "\n== %s ==\n", v.Variant)
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CASE\tCOMPLIANT\tSIMILARITY\tJUDGE\tTOP SUGGESTION\tREFERENCE")
+		for _, s := range v.Scores {
+			top := s.Error
+			if len(s.Suggestions) > 0 {
+				top = s.Suggestions[0]
+			}
+			fmt.Fprintf(w, "%s\t%d/%d\t%.2f\t%s\t%s\t%s\n",
+				s.Case, s.Compliant, len(s.Suggestions), s.Similarity, judgeScore(s.Judge),
+				truncateRunes(60, top), truncateRunes(60, s.Reference))
+		}
+		_ = w.Flush()
+	}
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
+}
+
+func judgeScore(f float64) string {
+	if f == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", f)
+}
+
+// caseContext is the git context a run would have collected for c. Recorded
+// declarations are only sent when the configuration enables semantic
+// analysis, as for a normal run.
+func caseContext(c eval.Case) gitContext {
+	gc := gitContext{
+		Branch:    c.Branch,
+		Source:    c.Source,
+		Paths:     c.Paths,
+		Diff:      capString(c.Diff, maxDiffBytes),
+		DiffTotal: len(c.Diff),
+	}
+	for _, f := range c.Files {
+		gc.Files = append(gc.Files, llm.File(f))
+	}
+	if viper.GetBool("semantic.enabled") {
+		for _, d := range c.Declarations {
+			gc.Declarations = append(gc.Declarations, llm.Declaration(d))
+		}
+	}
+	return gc
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSampleCommitsMatchTheCLIContext(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	repo, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRepo(t, repo)
+	writeFile(t, "parse.go", "package x\n\nfunc Parse(s string) error { return nil }\n")
+	gitIn(t, repo, "add", "parse.go")
+	gitIn(t, repo, "commit", "-q", "-m", "feat: add Parse")
+	writeFile(t, ".diffscribe.yaml", "semantic:\n  enabled: true\n")
+	resetConfig()
+
+	cases, err := sampleCommits(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 1 {
+		t.Fatalf("got %d cases, want 1", len(cases))
+	}
+	c := cases[0]
+	if c.Message != "feat: add Parse" || !strings.Contains(c.Source, "the commits in ") {
+		t.Errorf("message %q, source %q", c.Message, c.Source)
+	}
+	if len(c.Files) != 1 || c.Files[0].Path != "parse.go" || c.Files[0].Status != "added" {
+		t.Errorf("files = %+v, want parse.go added", c.Files)
+	}
+	if len(c.Declarations) != 1 || c.Declarations[0].Name != "Parse" {
+		t.Fatalf("declarations = %+v, want Parse", c.Declarations)
+	}
+
+	gc := caseContext(c)
+	if gc.Source != c.Source || len(gc.Files) != 1 || len(gc.Declarations) != 1 {
+		t.Errorf("context = %+v, want the recorded source, files and declarations", gc)
+	}
+	withSettings(map[string]any{"semantic.enabled": false}, func() {
+		if gc := caseContext(c); len(gc.Declarations) != 0 {
+			t.Errorf("declarations sent with semantic analysis off: %+v", gc.Declarations)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rogwilco/diffscribe/internal/format"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var formatsCmd = &cobra.Command{
+	Use:   "formats",
+	Short: "Inspect the available commit message formats",
+	Long: `Commit message formats are named presets bundling prompt guidance, few-shot
+examples and the rules used to validate suggestions. Select one with --format
+or the format config key. Built-in presets are conventional, angular, gitmoji,
+kernel, jira-prefixed and plain.
+
+Custom presets are defined under the formats config block, using either a
+regular expression (pattern) or a header grammar such as
+"<type>[(<scope>)]: <description>":
+
+  formats:
+    team:
+      description: Ticket in brackets, then a conventional header
+      guidance: Start with the ticket in brackets, then type and summary.
+      grammar: '\[<ticket>\] <type>: <summary>'
+      types: [feat, fix, chore]
+      examples: ["[ABC-1] feat: add login form"]
+
+Any other --format value is treated as a free-text description of the
+desired style.`,
+}
+
+var formatsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List built-in and custom format presets",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		custom, err := customFormats()
+		if err != nil {
+			return err
+		}
+		presets, err := format.All(custom)
+		if err != nil {
+			return err
+		}
+
+		selected := strings.ToLower(strings.TrimSpace(viper.GetString("format")))
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "\tNAME\tSOURCE\tDESCRIPTION")
+		for _, p := range presets {
+			marker, source := "", "config"
+			if p.Name == selected {
+				marker = "*"
+			}
+			if p.Builtin {
+				source = "built-in"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", marker, p.Name, source, p.Description)
+		}
+		return w.Flush()
+	},
+}
+
+var formatsShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show a preset's guidance and examples (defaults to the selected format)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := viper.GetString("format")
+		if len(args) > 0 {
+			name = args[0]
+		}
+		custom, err := customFormats()
+		if err != nil {
+			return err
+		}
+		p, err := format.Lookup(name, custom)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Name: %s\n", p.Name)
+		if p.Pattern != nil {
+			fmt.Fprintf(out, "Pattern: %s\n", p.Pattern)
+		} else if p.Conventional {
+			fmt.Fprintln(out, "Grammar: conventional")
+		}
+		if len(p.Types) > 0 {
+			fmt.Fprintf(out, "Types: %s\n", strings.Join(p.Types, ", "))
+		}
+		if len(p.Scopes) > 0 {
+			fmt.Fprintf(out, "Scopes: %s\n", strings.Join(p.Scopes, ", "))
+		}
+		fmt.Fprintf(out, "\n%s\n", p.Guidance)
+		if len(p.Examples) > 0 {
+			fmt.Fprintln(out, "\nExamples:")
+			for _, ex := range p.Examples {
+				fmt.Fprintf(out, "  %s\n", ex)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	formatsCmd.AddCommand(formatsListCmd)
+	formatsCmd.AddCommand(formatsShowCmd)
+	rootCmd.AddCommand(formatsCmd)
+}
+
+func customFormats() (map[string]format.Config, error) {
+	var custom map[string]format.Config
+	if err := viper.UnmarshalKey("formats", &custom); err != nil {
+		return nil, fmt.Errorf("diffscribe: invalid formats config: %w", err)
+	}
+	return custom, nil
+}
+
+// currentPreset resolves the format setting. Broken custom presets are
+// reported and the value falls back to a free-text description.
+func currentPreset() format.Preset {
+	value := viper.GetString("format")
+	custom, err := customFormats()
+	if err == nil {
+		var p format.Preset
+		if p, err = format.Lookup(value, custom); err == nil {
+			return p
+		}
+	}
+	fmt.Fprintln(os.Stderr, err)
+	p, _ := format.Lookup(value, nil)
+	return p
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// gitConfigAliases maps git config variable names, which git lowercases and
+// which cannot contain underscores, onto viper keys. Short names such as
+// diffscribe.model are accepted for the common llm settings.
+var gitConfigAliases = map[string]string{
+	"apikey":              "llm.api_key",
+	"provider":            "llm.provider",
+	"model":               "llm.model",
+	"baseurl":             "llm.base_url",
+	"temperature":         "llm.temperature",
+	"maxcompletiontokens": "llm.max_completion_tokens",
+	"maxrepairs":          "llm.max_repairs",
+	"systemprompt":        "system_prompt",
+	"userprompt":          "user_prompt",
+}
+
+// Sources recorded for settings read from git config.
+const (
+	userGitConfig = "git config (user)"
+	repoGitConfig = "git config (repository)"
+)
+
+// readGitConfig reads the [diffscribe] section of git config, split into the
+// user's own settings (system and global scope) and the repository's (local,
+// worktree and command-line scope), so each can be merged next to the
+// config files of the same reach. Git applies includeIf, and within a
+// group the last value reported for a key wins. Subsections address nested
+// keys:
+//
+//	[diffscribe]
+//		model = gpt-4o
+//		format = kernel
+//	[diffscribe "lint"]
+//		subject-max-length = 50
+func readGitConfig() (user, repo map[string]any) {
+	return parseGitConfig(run("git", "config", "--includes", "-z", "--show-scope", "--get-regexp", `^diffscribe\.`))
+}
+
+// parseGitConfig parses the output of git config -z --show-scope, where
+// each entry is a scope followed by the name and value. A name without a
+// value is a boolean set to true, as git reads it.
+func parseGitConfig(out string) (user, repo map[string]any) {
+	user, repo = map[string]any{}, map[string]any{}
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		scope, entry := fields[i], fields[i+1]
+		name, value, hasValue := strings.Cut(entry, "\n")
+		if name == "" {
+			continue
+		}
+		key, ok := gitConfigKey(name)
+		if !ok {
+			debugf("ignoring git config %s", name)
+			continue
+		}
+		settings := repo
+		if scope == "system" || scope == "global" {
+			settings = user
+		}
+		if hasValue {
+			setNested(settings, key, value)
+		} else {
+			setNested(settings, key, true)
+		}
+	}
+	return user, repo
+}
+
+// mergeGitConfig merges settings read by readGitConfig over the loaded
+// configuration.
+func mergeGitConfig(settings map[string]any, source string) {
+	if len(settings) == 0 {
+		return
+	}
+	if err := viper.MergeConfigMap(settings); err != nil {
+		fmt.Fprintf(os.Stderr, "diffscribe: unable to merge %s: %v\n", source, err)
+		return
+	}
+	recordSources(settings, source)
+}
+
+// gitConfigKey converts a git config name such as diffscribe.lint.body-wrap
+// into the matching viper key (lint.body_wrap).
+func gitConfigKey(name string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.ToLower(name), "diffscribe.")
+	if !ok || rest == "" {
+		return "", false
+	}
+	parts := strings.Split(rest, ".")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(p, "-", "_")
+	}
+	if len(parts) == 1 {
+		if key, ok := gitConfigAliases[strings.ReplaceAll(parts[0], "_", "")]; ok {
+			return key, true
+		}
+	}
+	if parts[0] == "llm" && len(parts) == 2 {
+		if key, ok := gitConfigAliases[strings.ReplaceAll(parts[1], "_", "")]; ok && strings.HasPrefix(key, "llm.") {
+			return key, true
+		}
+	}
+	return strings.Join(parts, "."), true
+}
+
+func setNested(m map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[p] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = value
+}
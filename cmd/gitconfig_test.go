@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestGitConfigKey(t *testing.T) {
+	cases := []struct {
+		name string
+		key  string
+		ok   bool
+	}{
+		{"diffscribe.model", "llm.model", true},
+		{"diffscribe.baseUrl", "llm.base_url", true},
+		{"diffscribe.maxcompletiontokens", "llm.max_completion_tokens", true},
+		{"diffscribe.max-repairs", "llm.max_repairs", true},
+		{"diffscribe.systemPrompt", "system_prompt", true},
+		{"diffscribe.llm.model", "llm.model", true},
+		{"diffscribe.llm.apikey", "llm.api_key", true},
+		{"diffscribe.llm.base-url", "llm.base_url", true},
+		{"diffscribe.llm.systemprompt", "llm.systemprompt", true},
+		{"diffscribe.format", "format", true},
+		{"diffscribe.lint.subject-max-length", "lint.subject_max_length", true},
+		{"diffscribe.lint.body-wrap", "lint.body_wrap", true},
+		{"diffscribe.semantic.enabled", "semantic.enabled", true},
+		{"DiffScribe.Quantity", "quantity", true},
+		{"diffscribe.", "", false},
+		{"user.name", "", false},
+	}
+	for _, tc := range cases {
+		key, ok := gitConfigKey(tc.name)
+		if key != tc.key || ok != tc.ok {
+			t.Errorf("gitConfigKey(%q) = %q, %v; want %q, %v", tc.name, key, ok, tc.key, tc.ok)
+		}
+	}
+}
+
+func TestParseGitConfig(t *testing.T) {
+	out := "global\x00diffscribe.model\ngpt-4o\x00" +
+		"system\x00diffscribe.lint.subject-max-length\n50\x00" +
+		"local\x00diffscribe.semantic.enabled\x00" +
+		"local\x00diffscribe.model\nlocal-model\x00" +
+		"worktree\x00user.name\nnobody\x00"
+	user, repo := parseGitConfig(out)
+	wantUser := map[string]any{
+		"llm":  map[string]any{"model": "gpt-4o"},
+		"lint": map[string]any{"subject_max_length": "50"},
+	}
+	wantRepo := map[string]any{
+		"semantic": map[string]any{"enabled": true},
+		"llm":      map[string]any{"model": "local-model"},
+	}
+	if !reflect.DeepEqual(user, wantUser) {
+		t.Errorf("user settings = %v, want %v", user, wantUser)
+	}
+	if !reflect.DeepEqual(repo, wantRepo) {
+		t.Errorf("repository settings = %v, want %v", repo, wantRepo)
+	}
+}
+
+func TestGitConfigLayering(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	home := isolateConfig(t)
+	writeFile(t, filepath.Join(home, ".gitconfig"), "[diffscribe]\n\tmodel = global-model\n\tformat = kernel\n\tquantity = 3\n")
+	writeFile(t, ".diffscribe.yaml", "llm:\n  model: project-model\nformat: gitmoji\n")
+	if out, err := exec.Command("git", "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	if out, err := exec.Command("git", "config", "diffscribe.format", "conventional").CombinedOutput(); err != nil {
+		t.Fatalf("git config: %v\n%s", err, out)
+	}
+	resetConfig()
+
+	for key, want := range map[string]string{
+		"llm.model": "project-model",
+		"format":    "conventional",
+		"quantity":  "3",
+	} {
+		if got := viper.GetString(key); got != want {
+			t.Errorf("%s = %q (from %s), want %q", key, got, configSource(key), want)
+		}
+	}
+	if got := configSource("quantity"); got != userGitConfig {
+		t.Errorf("quantity came from %s, want %s", got, userGitConfig)
+	}
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/rogwilco/diffscribe/internal/lint"
+	"github.com/rogwilco/diffscribe/internal/llm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultSubjectMaxLength = 72
+	defaultBodyWrap         = 72
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [msg-file|-]",
+	Short: "Check a commit message against the configured format",
+	Long: `lint reads a commit message from a file (or stdin when the argument is "-"
+or omitted) and checks it against the configured rules: Conventional Commit
+grammar, allowed types and scopes, subject length, imperative mood, body
+wrapping and required trailers. Git comment lines are ignored, so the command
+can be used directly as a commit-msg hook.
+
+The header grammar, types and scopes come from the selected --format preset
+and can be overridden under the lint block (lint.conventional, lint.types,
+lint.scopes). The remaining rules are configured there too
+(lint.subject_max_length, lint.body_wrap, lint.imperative,
+lint.trailing_punctuation, lint.trailers).
+
+The same rules are applied to generated suggestions: candidates that fail are
+repaired where possible and dropped otherwise.`,
+	Example: `  # lint the message being written by git commit
+  diffscribe lint .git/COMMIT_EDITMSG
+
+  # install as a commit-msg hook
+  printf '#!/bin/sh\nexec diffscribe lint "$1"\n' > .git/hooks/commit-msg
+  chmod +x .git/hooks/commit-msg`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := "-"
+		if len(args) > 0 {
+			path = args[0]
+		}
+		msg, err := readMessage(cmd, path)
+		if err != nil {
+			return err
+		}
+
+		if err := checkOutputFormat(lintOutput); err != nil {
+			return err
+		}
+		result := newLintResult(lint.Lint(msg, lintRules()))
+		if lintOutput == "json" {
+			if err := writeJSON(cmd.OutOrStdout(), result); err != nil {
+				return err
+			}
+		} else {
+			for _, v := range result.Violations {
+				fmt.Fprintln(cmd.OutOrStdout(), v)
+			}
+		}
+		if !result.Valid {
+			return errLintFailed
+		}
+		return nil
+	},
+}
+
+var lintOutput string
+
+func init() {
+	lintCmd.Flags().StringVar(&lintOutput, "output", "text", "output format: text or json")
+	rootCmd.AddCommand(lintCmd)
+
+	setDefault("lint.subject_max_length", defaultSubjectMaxLength)
+	setDefault("lint.body_wrap", defaultBodyWrap)
+	setDefault("lint.imperative", true)
+	setDefault("lint.trailing_punctuation", true)
+}
+
+// lintResult is the structured form of a lint run, shared by lint --output
+// json, the MCP server and the HTTP API.
+type lintResult struct {
+	Valid      bool             `json:"valid"`
+	Violations []lint.Violation `json:"violations"`
+}
+
+func newLintResult(violations []lint.Violation) lintResult {
+	if violations == nil {
+		violations = []lint.Violation{}
+	}
+	return lintResult{Valid: len(violations) == 0, Violations: violations}
+}
+
+func readMessage(cmd *cobra.Command, path string) (string, error) {
+	if path == "-" {
+		b, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return "", fmt.Errorf("diffscribe: unable to read message: %w", err)
+		}
+		return string(b), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("diffscribe: unable to read message: %w", err)
+	}
+	return string(b), nil
+}
+
+// lintRules starts from the selected format preset and applies the lint
+// block on top of it.
+func lintRules() lint.Rules {
+	rules := currentPreset().Rules()
+	if viper.IsSet("lint.conventional") {
+		rules.Conventional = viper.GetBool("lint.conventional")
+	}
+	if viper.IsSet("lint.types") {
+		rules.Types = viper.GetStringSlice("lint.types")
+	}
+	if viper.IsSet("lint.scopes") {
+		rules.Scopes = viper.GetStringSlice("lint.scopes")
+	}
+	rules.SubjectMaxLength = viper.GetInt("lint.subject_max_length")
+	rules.BodyWrap = viper.GetInt("lint.body_wrap")
+	rules.Imperative = viper.GetBool("lint.imperative")
+	rules.TrailingPunctuation = viper.GetBool("lint.trailing_punctuation")
+	rules.Trailers = viper.GetStringSlice("lint.trailers")
+	return rules
+}
+
+// conformCandidates keeps the candidates that satisfy the lint rules, repairing
+// the ones that can be fixed mechanically. Candidates keep the typed prefix
+// byte for byte: a repair that would reword it is not applied, and problems
+// in the typed text itself are not held against them.
+func conformCandidates(candidates []string, rules lint.Rules, prefix string) []string {
+	typed := strings.TrimLeftFunc(prefix, unicode.IsSpace)
+	// Repairs without the imperative rewrite leave the words alone, for
+	// when the typed prefix ends inside a verb such as "feat: added".
+	wordsKept := rules
+	wordsKept.Imperative = false
+	seen := make(map[string]struct{})
+	var out []string
+	for _, c := range candidates {
+		if !strings.HasPrefix(c, typed) {
+			continue
+		}
+		if len(lint.LintSubject(c, rules)) > 0 {
+			c = keepPrefix(c, typed, lint.Repair(c, rules), lint.Repair(c, wordsKept))
+			if len(untypedViolations(c, rules, typed)) > 0 {
+				continue
+			}
+		}
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		out = append(out, c)
+	}
+	return out
+}
+
+// keepPrefix returns the first of the repaired versions of original that
+// keeps the typed prefix, restoring it where a repair only changed its case
+// (such as lowercasing a typed "Feat:"). Without one, original is returned.
+func keepPrefix(original, typed string, repaired ...string) string {
+	for _, r := range repaired {
+		switch {
+		case strings.HasPrefix(r, typed):
+			return r
+		case len(r) >= len(typed) && strings.EqualFold(r[:len(typed)], typed):
+			return typed + r[len(typed):]
+		}
+	}
+	return original
+}
+
+// untypedViolations lints candidate, leaving out the problems that lie in the
+// typed prefix: those whose repair would reword it, and a type or scope the
+// user typed in full.
+func untypedViolations(candidate string, rules lint.Rules, typed string) []lint.Violation {
+	violations := lint.LintSubject(candidate, rules)
+	if typed == "" || len(violations) == 0 {
+		return violations
+	}
+	rewords := !strings.HasPrefix(lint.Repair(candidate, rules), typed)
+	h, parsed := lint.ParseHeader(candidate)
+	var out []lint.Violation
+	for _, v := range violations {
+		switch {
+		case v.Rule == "imperative" && rewords:
+		case v.Rule == "type" && (rewords || parsed && len(typed) > len(h.Type)):
+		case v.Rule == "scope" && parsed && h.Scope != "" && len(typed) > strings.Index(candidate, ")"):
+		default:
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// candidateValidator exposes the lint rules to the LLM repair loop. Subject
+// length and trailing punctuation are left out because llm.Config checks
+// those itself, as are problems in the typed prefix, which the model must
+// not change.
+func candidateValidator(rules lint.Rules, prefix string) llm.Validator {
+	rules.SubjectMaxLength = 0
+	rules.TrailingPunctuation = false
+	typed := strings.TrimLeftFunc(prefix, unicode.IsSpace)
+	return func(candidate string) []string {
+		var problems []string
+		for _, v := range untypedViolations(candidate, rules, typed) {
+			problems = append(problems, v.Message)
+		}
+		return problems
+	}
+}
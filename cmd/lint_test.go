@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rogwilco/diffscribe/internal/lint"
+)
+
+var candidateRules = lint.Rules{
+	Conventional:        true,
+	SubjectMaxLength:    50,
+	Imperative:          true,
+	TrailingPunctuation: true,
+}
+
+func TestConformCandidatesKeepsPrefix(t *testing.T) {
+	cases := []struct {
+		name       string
+		prefix     string
+		candidates []string
+		want       []string
+	}{
+		{
+			name:       "no prefix",
+			candidates: []string{"Feat: added retry to the parser.", "feat: add retry to the parser and a great deal more besides"},
+			want:       []string{"feat: add retry to the parser"},
+		},
+		{
+			name:       "non-imperative prefix",
+			prefix:     "feat: added",
+			candidates: []string{"feat: added retry to the parser", "feat: added backoff.", "fix: add retry"},
+			want:       []string{"feat: added retry to the parser", "feat: added backoff"},
+		},
+		{
+			name:       "uppercase type",
+			prefix:     "Feat:",
+			candidates: []string{"Feat: added retry to the parser", "Feat: add backoff"},
+			want:       []string{"Feat: add retry to the parser", "Feat: add backoff"},
+		},
+		{
+			name:       "problems after the prefix",
+			prefix:     "feat: added",
+			candidates: []string{"feat: added retry to the parser and a great deal more besides"},
+		},
+		{
+			name:       "repair outside the prefix",
+			prefix:     "feat(api): ",
+			candidates: []string{"feat(api): added retries"},
+			want:       []string{"feat(api): add retries"},
+		},
+	}
+	for _, tc := range cases {
+		got := conformCandidates(tc.candidates, candidateRules, tc.prefix)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCandidateValidatorIgnoresPrefix(t *testing.T) {
+	if problems := candidateValidator(candidateRules, "feat: added")("feat: added retry"); len(problems) != 0 {
+		t.Errorf("problems in the typed prefix were reported: %v", problems)
+	}
+	if problems := candidateValidator(candidateRules, "Feat")("Feat: add retry"); len(problems) != 0 {
+		t.Errorf("a typed type was reported: %v", problems)
+	}
+	if problems := candidateValidator(candidateRules, "feat: ")("feat: added retry"); len(problems) != 1 {
+		t.Errorf("expected the generated verb to be reported, got %v", problems)
+	}
+}
@@ -0,0 +1,681 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rogwilco/diffscribe/internal/lint"
+	"github.com/rogwilco/diffscribe/internal/llm"
+	"github.com/rogwilco/diffscribe/internal/lsp"
+	"github.com/rogwilco/diffscribe/internal/version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	lspCommandRegenerate = "diffscribe.regenerate"
+	lspCommandInsertBody = "diffscribe.insertBody"
+)
+
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "Serve completions and diagnostics for commit messages over LSP",
+	Long: `lsp runs a Language Server Protocol server on stdin/stdout for editors that
+open COMMIT_EDITMSG as a plain buffer.
+
+While the cursor is on the subject line, completion offers the generated
+candidates that continue what has been typed so far. Diagnostics report the
+same problems as diffscribe lint (subject length, type, scope, body wrapping,
+required trailers), and code actions fix the subject mechanically, regenerate
+it, or insert a generated body when there is none.
+
+The repository is found from the path of the message being edited, so one
+server can be shared by every repository. Suggestions come from a running
+diffscribe daemon when there is one. Generation runs in the background, one
+request per message: a newer completion request, $/cancelRequest or closing
+the message cancels the one in flight.`,
+	Example: `  # Neovim (0.11+)
+  vim.lsp.config('diffscribe', { cmd = { 'diffscribe', 'lsp' }, filetypes = { 'gitcommit' } })
+  vim.lsp.enable('diffscribe')`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := &lspServer{
+			conn:       lsp.NewConn(cmd.InOrStdin(), cmd.OutOrStdout()),
+			docs:       map[string]string{},
+			candidates: map[string]lspCandidates{},
+			pending:    map[string]*lspPending{},
+		}
+		return s.serve()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lspCmd)
+}
+
+// lspServer handles one client. Messages are read and handled in order, but
+// requests that generate run in their own goroutine so that edits,
+// diagnostics and cancellations are not held up while the model answers.
+type lspServer struct {
+	conn *lsp.Conn
+	// docs and shutdown belong to the read loop.
+	docs     map[string]string
+	shutdown bool
+
+	// mu guards the working directory and configuration, which are
+	// process-wide, along with what was generated from them. Generation
+	// releases it while waiting for the model or the daemon.
+	mu sync.Mutex
+	// candidates holds the last suggestions generated for each document.
+	candidates map[string]lspCandidates
+	// workTree is the directory configuration was last loaded for.
+	workTree string
+
+	pendingMu sync.Mutex
+	// pending holds the request being generated for each document.
+	pending map[string]*lspPending
+	wg      sync.WaitGroup
+}
+
+type lspCandidates struct {
+	prefix string
+	list   []string
+}
+
+// lspPending is a request answered outside the read loop.
+type lspPending struct {
+	id     json.RawMessage
+	cancel context.CancelFunc
+}
+
+// errReplyLater is returned by handle for requests answered by async.
+var errReplyLater = errors.New("reply later")
+
+func (s *lspServer) serve() error {
+	defer s.wg.Wait()
+	defer s.cancelAll()
+	for {
+		m, err := s.conn.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var rpcErr *lsp.Error
+		if errors.As(err, &rpcErr) {
+			_ = s.conn.ReplyError(nil, rpcErr.Code, rpcErr.Message)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("diffscribe: %w", err)
+		}
+		if m.Method == "" {
+			// A response to one of our requests, such as workspace/applyEdit.
+			continue
+		}
+		if m.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("diffscribe: exit requested before shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(m)
+		if errors.Is(err, errReplyLater) {
+			continue
+		}
+		if !m.IsRequest() {
+			if err != nil {
+				debugf("lsp: %s: %v", m.Method, err)
+			}
+			continue
+		}
+		if err := s.reply(m.ID, result, err); err != nil {
+			return fmt.Errorf("diffscribe: %w", err)
+		}
+	}
+}
+
+// reply answers a request with its result, or with err as a JSON-RPC error.
+func (s *lspServer) reply(id json.RawMessage, result any, err error) error {
+	if err == nil {
+		return s.conn.Reply(id, result)
+	}
+	code, msg := lsp.CodeInternalError, err.Error()
+	var rpcErr *lsp.Error
+	if errors.As(err, &rpcErr) {
+		code, msg = rpcErr.Code, rpcErr.Message
+	}
+	return s.conn.ReplyError(id, code, msg)
+}
+
+// async answers m from a new goroutine with the result of fn and returns
+// errReplyLater. A document has at most one such request: starting another
+// cancels it, as do $/cancelRequest and closing the document, and a
+// cancelled request is answered with RequestCancelled.
+func (s *lspServer) async(m *lsp.Message, uri string, fn func(ctx context.Context) (any, error)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &lspPending{id: m.ID, cancel: cancel}
+	s.pendingMu.Lock()
+	if prev := s.pending[uri]; prev != nil {
+		prev.cancel()
+	}
+	s.pending[uri] = p
+	s.pendingMu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		result, err := fn(ctx)
+		if ctx.Err() != nil {
+			result, err = nil, &lsp.Error{Code: lsp.CodeRequestCancelled, Message: "request cancelled"}
+		}
+		cancel()
+		s.pendingMu.Lock()
+		if s.pending[uri] == p {
+			delete(s.pending, uri)
+		}
+		s.pendingMu.Unlock()
+		if err := s.reply(m.ID, result, err); err != nil {
+			debugf("lsp: %s: %v", m.Method, err)
+		}
+	}()
+	return errReplyLater
+}
+
+// cancelRequest cancels the request with the given ID if it is still being
+// answered.
+func (s *lspServer) cancelRequest(id json.RawMessage) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	for _, p := range s.pending {
+		if bytes.Equal(p.id, id) {
+			p.cancel()
+		}
+	}
+}
+
+// cancel cancels the request being answered for the document at uri.
+func (s *lspServer) cancel(uri string) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if p := s.pending[uri]; p != nil {
+		p.cancel()
+	}
+}
+
+func (s *lspServer) cancelAll() {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	for _, p := range s.pending {
+		p.cancel()
+	}
+}
+
+func (s *lspServer) handle(m *lsp.Message) (any, error) {
+	if s.shutdown && m.IsRequest() {
+		return nil, &lsp.Error{Code: lsp.CodeInvalidRequest, Message: "server is shutting down"}
+	}
+	switch m.Method {
+	case "initialize":
+		return lsp.InitializeResult{
+			Capabilities: lsp.ServerCapabilities{
+				TextDocumentSync:   lsp.TextDocumentSyncFull,
+				CompletionProvider: &lsp.CompletionOptions{TriggerCharacters: []string{":", " ", "("}},
+				CodeActionProvider: true,
+				ExecuteCommandProvider: &lsp.ExecuteCommandOptions{
+					Commands: []string{lspCommandRegenerate, lspCommandInsertBody},
+				},
+			},
+			ServerInfo: lsp.ServerInfo{Name: "diffscribe", Version: version.String()},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p lsp.DidOpenTextDocumentParams
+		if err := decodeParams(m, &p); err != nil {
+			return nil, err
+		}
+		s.docs[p.TextDocument.URI] = p.TextDocument.Text
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didChange":
+		var p lsp.DidChangeTextDocumentParams
+		if err := decodeParams(m, &p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[p.TextDocument.URI] = p.ContentChanges[n-1].Text
+		}
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didClose":
+		var p lsp.DidCloseTextDocumentParams
+		if err := decodeParams(m, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.cancel(p.TextDocument.URI)
+		s.mu.Lock()
+		delete(s.candidates, p.TextDocument.URI)
+		s.mu.Unlock()
+		return nil, s.conn.Notify("textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+			URI:         p.TextDocument.URI,
+			Diagnostics: []lsp.Diagnostic{},
+		})
+	case "textDocument/completion":
+		var p lsp.TextDocumentPositionParams
+		if err := decodeParams(m, &p); err != nil {
+			return nil, err
+		}
+		return s.completion(m, p)
+	case "textDocument/codeAction":
+		var p lsp.CodeActionParams
+		if err := decodeParams(m, &p); err != nil {
+			return nil, err
+		}
+		return s.codeActions(p)
+	case "workspace/executeCommand":
+		var p lsp.ExecuteCommandParams
+		if err := decodeParams(m, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.executeCommand(m, p)
+	case "$/cancelRequest":
+		var p lsp.CancelParams
+		if err := decodeParams(m, &p); err != nil {
+			return nil, err
+		}
+		s.cancelRequest(p.ID)
+		return nil, nil
+	case "initialized", "textDocument/didSave", "$/setTrace":
+		return nil, nil
+	}
+	if m.IsRequest() {
+		return nil, &lsp.Error{Code: lsp.CodeMethodNotFound, Message: "method not found: " + m.Method}
+	}
+	return nil, nil
+}
+
+func decodeParams(m *lsp.Message, v any) error {
+	if err := json.Unmarshal(m.Params, v); err != nil {
+		return &lsp.Error{Code: lsp.CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// enter switches to the work tree of the document at uri, reloading the
+// configuration when it differs from the last one. s.mu must be held.
+func (s *lspServer) enter(uri string) error {
+	return enterDir(&s.workTree, lspWorkTree(lsp.URIToPath(uri)))
+}
+
+// unlocked runs fn without s.mu, so fn must not depend on the working
+// directory or configuration, and then switches back to the work tree of
+// the document at uri, which another request may have left.
+func (s *lspServer) unlocked(uri string, fn func()) error {
+	s.mu.Unlock()
+	fn()
+	s.mu.Lock()
+	return s.enter(uri)
+}
+
+// lintRules returns the lint rules configured for the document at uri.
+func (s *lspServer) lintRules(uri string) (lint.Rules, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enter(uri); err != nil {
+		return lint.Rules{}, err
+	}
+	return lintRules(), nil
+}
+
+// lspWorkTree returns the work tree a commit message belongs to. Git writes
+// COMMIT_EDITMSG to the git directory: .git itself, or for linked worktrees
+// an administrative directory whose gitdir file points at the worktree's
+// .git file.
+func lspWorkTree(path string) string {
+	dir := filepath.Dir(path)
+	if b, err := os.ReadFile(filepath.Join(dir, "gitdir")); err == nil {
+		target := strings.TrimSpace(string(b))
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		return filepath.Dir(filepath.Clean(target))
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if filepath.Base(d) == ".git" {
+			return filepath.Dir(d)
+		}
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+func (s *lspServer) publishDiagnostics(uri string) error {
+	text := s.docs[uri]
+	rules, err := s.lintRules(uri)
+	if err != nil {
+		return err
+	}
+	lines := lsp.Lines(text)
+	diagnostics := []lsp.Diagnostic{}
+	for _, v := range lint.Lint(text, rules) {
+		// An empty buffer is where every message starts.
+		if v.Rule == "empty" {
+			continue
+		}
+		line := lint.SourceLine(text, v.Line) - 1
+		if line < 0 {
+			continue
+		}
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    lineRange(line, lines[line]),
+			Severity: lsp.SeverityError,
+			Code:     v.Rule,
+			Source:   "diffscribe",
+			Message:  v.Message,
+		})
+	}
+	return s.conn.Notify("textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// completion answers from the candidates already generated for the document
+// when some still fit, and otherwise generates new ones off the read loop.
+func (s *lspServer) completion(m *lsp.Message, p lsp.TextDocumentPositionParams) (any, error) {
+	uri := p.TextDocument.URI
+	lines := lsp.Lines(s.docs[uri])
+	if p.Position.Line != subjectLine(s.docs[uri]) || p.Position.Line >= len(lines) {
+		return completionList(p.Position.Line, "", nil), nil
+	}
+	line := lines[p.Position.Line]
+	prefix := line[:lsp.ByteOffset(line, p.Position.Character)]
+
+	if candidates, ok := s.cachedCandidates(uri, prefix); ok {
+		return completionList(p.Position.Line, prefix, candidates), nil
+	}
+	return nil, s.async(m, uri, func(ctx context.Context) (any, error) {
+		candidates, err := s.suggest(ctx, uri, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return completionList(p.Position.Line, prefix, candidates), nil
+	})
+}
+
+// completionList offers candidates replacing the subject up to the cursor.
+func completionList(line int, prefix string, candidates []string) lsp.CompletionList {
+	list := lsp.CompletionList{Items: []lsp.CompletionItem{}}
+	for i, c := range candidates {
+		list.Items = append(list.Items, lsp.CompletionItem{
+			Label:      c,
+			Kind:       lsp.CompletionItemKindText,
+			Detail:     "diffscribe",
+			SortText:   fmt.Sprintf("%03d", i),
+			FilterText: c,
+			TextEdit: &lsp.TextEdit{
+				Range: lsp.Range{
+					Start: lsp.Position{Line: line},
+					End:   lsp.Position{Line: line, Character: lsp.UTF16Len(prefix)},
+				},
+				NewText: c,
+			},
+		})
+	}
+	return list
+}
+
+// cachedCandidates returns the candidates generated for an earlier prefix
+// that still continue prefix, so typing does not start a new request for
+// every completion.
+func (s *lspServer) cachedCandidates(uri, prefix string) ([]string, bool) {
+	trimmed := strings.TrimSpace(prefix)
+	s.mu.Lock()
+	prev, ok := s.candidates[uri]
+	s.mu.Unlock()
+	if !ok || !strings.HasPrefix(trimmed, prev.prefix) {
+		return nil, false
+	}
+	var matching []string
+	for _, c := range prev.list {
+		if spliced, ok := llm.ContinuePrefix(c, trimmed); ok {
+			matching = append(matching, spliced)
+		}
+	}
+	return matching, len(matching) > 0
+}
+
+// suggest generates candidates continuing prefix for the document at uri,
+// from the daemon when it is running. It gives up as soon as ctx is
+// cancelled.
+func (s *lspServer) suggest(ctx context.Context, uri, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enter(uri); err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+	answered := false
+	if req, ok := daemonSuggestRequest(prefix); ok {
+		if err := s.unlocked(uri, func() { candidates, answered = askDaemon(req) }); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !answered {
+		c, err := collectContext()
+		if err != nil {
+			return nil, err
+		}
+		g, err := prepareGeneration(c, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if !g.skip {
+			var res llm.Result
+			var genErr error
+			if err := s.unlocked(uri, func() { res, genErr = g.run(ctx) }); err != nil {
+				return nil, err
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			candidates, _ = g.finish(res, genErr)
+		}
+	}
+	s.candidates[uri] = lspCandidates{prefix: strings.TrimSpace(prefix), list: candidates}
+	return candidates, nil
+}
+
+func (s *lspServer) codeActions(p lsp.CodeActionParams) ([]lsp.CodeAction, error) {
+	uri := p.TextDocument.URI
+	text := s.docs[uri]
+	actions := []lsp.CodeAction{}
+	line := subjectLine(text)
+	if line < 0 {
+		return actions, nil
+	}
+	subject := strings.TrimRight(lsp.Lines(text)[line], " \t")
+	rules, err := s.lintRules(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(subject) != "" && len(lint.LintSubject(subject, rules)) > 0 {
+		if repaired := lint.Repair(subject, rules); repaired != subject {
+			var diagnostics []lsp.Diagnostic
+			for _, d := range p.Context.Diagnostics {
+				if d.Source == "diffscribe" && d.Range.Start.Line == line {
+					diagnostics = append(diagnostics, d)
+				}
+			}
+			actions = append(actions, lsp.CodeAction{
+				Title:       "Fix subject: " + repaired,
+				Kind:        "quickfix",
+				Diagnostics: diagnostics,
+				Edit:        subjectEdit(uri, line, subject, repaired),
+			})
+		}
+	}
+	actions = append(actions, lsp.CodeAction{
+		Title:   "Regenerate subject with diffscribe",
+		Kind:    "refactor.rewrite",
+		Command: &lsp.Command{Title: "Regenerate subject", Command: lspCommandRegenerate, Arguments: []any{uri}},
+	})
+	if strings.TrimSpace(subject) != "" && !hasBody(text) {
+		actions = append(actions, lsp.CodeAction{
+			Title:   "Insert body generated by diffscribe",
+			Kind:    "refactor.rewrite",
+			Command: &lsp.Command{Title: "Insert body", Command: lspCommandInsertBody, Arguments: []any{uri}},
+		})
+	}
+	return actions, nil
+}
+
+// executeCommand checks the command against the open document and runs it
+// off the read loop.
+func (s *lspServer) executeCommand(m *lsp.Message, p lsp.ExecuteCommandParams) error {
+	if len(p.Arguments) != 1 {
+		return &lsp.Error{Code: lsp.CodeInvalidParams, Message: p.Command + " takes the document URI"}
+	}
+	uri := p.Arguments[0]
+	text, ok := s.docs[uri]
+	if !ok {
+		return &lsp.Error{Code: lsp.CodeInvalidParams, Message: "document is not open: " + uri}
+	}
+	line := subjectLine(text)
+	if line < 0 {
+		return &lsp.Error{Code: lsp.CodeInvalidParams, Message: "document has no subject line"}
+	}
+	subject := lsp.Lines(text)[line]
+
+	switch p.Command {
+	case lspCommandRegenerate:
+		return s.async(m, uri, func(ctx context.Context) (any, error) {
+			candidates, err := s.suggest(ctx, uri, "")
+			if err != nil {
+				return nil, err
+			}
+			if len(candidates) == 0 {
+				return nil, errors.New("diffscribe: no suggestions (are there staged changes?)")
+			}
+			return nil, s.conn.Call("workspace/applyEdit", lsp.ApplyWorkspaceEditParams{
+				Label: "Regenerate subject",
+				Edit:  *subjectEdit(uri, line, subject, candidates[0]),
+			})
+		})
+	case lspCommandInsertBody:
+		return s.async(m, uri, func(ctx context.Context) (any, error) {
+			body, err := s.generateBody(ctx, uri, subject)
+			if err != nil {
+				return nil, err
+			}
+			end := lsp.Position{Line: line, Character: lsp.UTF16Len(subject)}
+			return nil, s.conn.Call("workspace/applyEdit", lsp.ApplyWorkspaceEditParams{
+				Label: "Insert body",
+				Edit: lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{
+					uri: {{Range: lsp.Range{Start: end, End: end}, NewText: "\n\n" + body}},
+				}},
+			})
+		})
+	}
+	return &lsp.Error{Code: lsp.CodeInvalidParams, Message: "unknown command: " + p.Command}
+}
+
+func (s *lspServer) generateBody(ctx context.Context, uri, subject string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enter(uri); err != nil {
+		return "", err
+	}
+	c, err := collectContext()
+	if err != nil {
+		return "", err
+	}
+	if len(c.Paths) == 0 {
+		return "", errors.New("diffscribe: no staged changes to describe")
+	}
+	cfg, err := newLLMConfig(newTemplateData(c, ""))
+	if err != nil {
+		return "", err
+	}
+	if err := requireLLMConfig(cfg); err != nil {
+		return "", err
+	}
+	var res llm.Result
+	var genErr error
+	if err := s.unlocked(uri, func() {
+		res, genErr = llm.GenerateBody(ctx, llm.Context{
+			Branch:       c.Branch,
+			Source:       c.Source,
+			Paths:        c.Paths,
+			Files:        c.Files,
+			Declarations: c.Declarations,
+			Diff:         c.Diff,
+		}, subject, cfg)
+	}); err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	recordUsage("lsp", cfg, res.Usage)
+	if genErr != nil {
+		return "", fmt.Errorf("diffscribe: LLM error: %w", genErr)
+	}
+	if len(res.Suggestions) == 0 {
+		return "", errors.New("diffscribe: the model returned no body")
+	}
+	return wrapText(viper.GetInt("lint.body_wrap"), strings.TrimSpace(res.Suggestions[0])), nil
+}
+
+// subjectLine returns the 0-based line of the subject: the first line that
+// is neither a comment nor blank, else the first line that is not a comment.
+// It returns -1 when there is none.
+func subjectLine(text string) int {
+	if line := lint.SourceLine(text, 1); line > 0 {
+		return line - 1
+	}
+	for i, l := range lsp.Lines(text) {
+		if strings.HasPrefix(l, "# ") && strings.Contains(l, ">8") {
+			break
+		}
+		if !strings.HasPrefix(l, "#") {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasBody reports whether the message has anything below the subject.
+func hasBody(text string) bool {
+	return lint.SourceLine(text, 2) > 0
+}
+
+func subjectEdit(uri string, line int, old, subject string) *lsp.WorkspaceEdit {
+	return &lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{
+		uri: {{Range: lineRange(line, old), NewText: subject}},
+	}}
+}
+
+func lineRange(line int, text string) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: line},
+		End:   lsp.Position{Line: line, Character: lsp.UTF16Len(text)},
+	}
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogwilco/diffscribe/internal/lsp"
+)
+
+// lspClient drives an lspServer over pipes.
+type lspClient struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *lsp.Conn
+	done chan error
+}
+
+func startLSP(t *testing.T) *lspClient {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	s := &lspServer{
+		conn:       lsp.NewConn(inR, outW),
+		docs:       map[string]string{},
+		candidates: map[string]lspCandidates{},
+		pending:    map[string]*lspPending{},
+	}
+	c := &lspClient{t: t, in: inW, out: lsp.NewConn(outR, io.Discard), done: make(chan error, 1)}
+	go func() {
+		c.done <- s.serve()
+		outW.Close()
+	}()
+	return c
+}
+
+func (c *lspClient) send(id int, method string, params any) {
+	c.t.Helper()
+	m := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if id != 0 {
+		m["id"] = id
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := io.WriteString(c.in, "Content-Length: "+itoa(len(body))+"\r\n\r\n"+string(body)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the next message from the server.
+func (c *lspClient) next() *lsp.Message {
+	c.t.Helper()
+	m, err := c.out.Read()
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return m
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+// lspRepo creates a repository with a staged file in the working directory.
+func lspRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	writeFile(t, "a.txt", "a\n")
+	for _, args := range [][]string{{"init", "-q"}, {"add", "a.txt"}} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// openCommitMessage starts a server and opens the repository's commit
+// message holding text.
+func openCommitMessage(t *testing.T, repo, text string) (*lspClient, string) {
+	t.Helper()
+	c := startLSP(t)
+	uri := "file://" + filepath.Join(repo, ".git", "COMMIT_EDITMSG")
+	c.send(1, "initialize", map[string]any{})
+	if m := c.next(); string(m.ID) != "1" {
+		t.Fatalf("unexpected reply to initialize: %+v", m)
+	}
+	c.send(0, "textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "text": text}})
+	if m := c.next(); m.Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("expected diagnostics, got %+v", m)
+	}
+	return c, uri
+}
+
+// stop shuts the server down cleanly.
+func (c *lspClient) stop(id int) {
+	c.t.Helper()
+	c.send(id, "shutdown", nil)
+	if m := c.next(); string(m.ID) != itoa(id) {
+		c.t.Fatalf("unexpected reply to shutdown: %+v", m)
+	}
+	c.send(0, "exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("serve: %v", err)
+	}
+}
+
+func TestLSPCompletion(t *testing.T) {
+	isolateConfig(t)
+	t.Setenv("DIFFSCRIBE_DAEMON", "0")
+	repo := lspRepo(t)
+	writeFile(t, ".diffscribe.yaml", "llm:\n  provider: fake\n")
+	c, uri := openCommitMessage(t, repo, "chore: ")
+
+	complete := func(id, character int) lsp.CompletionList {
+		t.Helper()
+		c.send(id, "textDocument/completion", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": map[string]any{"line": 0, "character": character}})
+		m := c.next()
+		var list lsp.CompletionList
+		if string(m.ID) != itoa(id) || m.Error != nil || json.Unmarshal(m.Result, &list) != nil {
+			t.Fatalf("unexpected reply to completion: %+v", m)
+		}
+		return list
+	}
+	list := complete(2, 7)
+	if len(list.Items) == 0 {
+		t.Fatal("expected candidates")
+	}
+	for _, item := range list.Items {
+		if item.TextEdit == nil || item.TextEdit.Range.End.Character != 7 || !strings.HasPrefix(item.TextEdit.NewText, "chore: ") {
+			t.Errorf("candidate %+v does not continue the subject", item)
+		}
+	}
+	// Typing on narrows the candidates.
+	c.send(0, "textDocument/didChange", map[string]any{"textDocument": map[string]any{"uri": uri}, "contentChanges": []any{map[string]any{"text": "chore: up"}}})
+	if m := c.next(); m.Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("expected diagnostics, got %+v", m)
+	}
+	for _, item := range complete(3, 9).Items {
+		if !strings.HasPrefix(item.Label, "chore: up") {
+			t.Errorf("candidate %q does not continue the subject", item.Label)
+		}
+	}
+	c.stop(4)
+}
+
+func TestLSPCompletionIsCancellable(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	t.Setenv("DIFFSCRIBE_DAEMON", "0")
+
+	started := make(chan struct{}, 1)
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reading the body lets the server notice the client hanging up.
+		_, _ = io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer model.Close()
+
+	repo := lspRepo(t)
+	writeFile(t, ".diffscribe.yaml", "llm:\n  provider: openai\n  api_key: test\n  base_url: "+model.URL+"\n")
+
+	c, uri := openCommitMessage(t, repo, "feat: ")
+	doc := map[string]any{"uri": uri}
+	c.send(2, "textDocument/completion", map[string]any{"textDocument": doc, "position": map[string]any{"line": 0, "character": 6}})
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the model was never asked")
+	}
+
+	// The read loop keeps going while the model answers.
+	c.send(0, "textDocument/didChange", map[string]any{"textDocument": doc, "contentChanges": []any{map[string]any{"text": "feat: add"}}})
+	if m := c.next(); m.Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("expected diagnostics during generation, got %+v", m)
+	}
+
+	c.send(0, "$/cancelRequest", map[string]any{"id": 2})
+	m := c.next()
+	if string(m.ID) != "2" || m.Error == nil || m.Error.Code != lsp.CodeRequestCancelled {
+		t.Fatalf("expected the completion to be cancelled, got %+v", m)
+	}
+
+	c.stop(3)
+}
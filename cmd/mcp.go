@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rogwilco/diffscribe/internal/lint"
+	"github.com/rogwilco/diffscribe/internal/mcp"
+	"github.com/rogwilco/diffscribe/internal/version"
+	"github.com/spf13/cobra"
+)
+
+const mcpInstructions = `diffscribe writes and checks commit messages using the repository's configured
+format, lint rules and model. Stage changes, call suggest_commit_message and
+commit with one of the suggestions; check hand-written messages with
+lint_commit_message before committing. describe_range summarizes existing
+commits, for example as a squash message or pull request title.`
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Expose diffscribe as tools over the Model Context Protocol",
+	Long: `mcp runs a Model Context Protocol server on stdin/stdout so coding agents
+can follow the same commit conventions as people. It offers three tools:
+
+  suggest_commit_message  suggestions for the staged changes
+  lint_commit_message     check a message against the lint rules
+  describe_range          suggestions describing a revision range
+
+Each tool takes an optional repository path and otherwise works in the
+directory the server was started in. Context collection, format presets,
+profiles and provider settings are resolved exactly as for the CLI.`,
+	Example: `  # register with an MCP client, e.g. in its JSON configuration
+  {"mcpServers": {"diffscribe": {"command": "diffscribe", "args": ["mcp"]}}}`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("diffscribe: %w", err)
+		}
+		s := &mcpServer{startDir: dir, dir: dir}
+		srv := &mcp.Server{
+			Name:         "diffscribe",
+			Version:      version.String(),
+			Instructions: mcpInstructions,
+			Tools:        s.tools(),
+		}
+		return srv.Serve(cmd.InOrStdin(), cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+}
+
+// mcpServer runs tool calls in the repository they name.
+type mcpServer struct {
+	startDir string
+	// dir is the directory configuration was last loaded for.
+	dir string
+}
+
+var mcpRepositoryProperty = map[string]any{
+	"type":        "string",
+	"description": "Path inside the git repository to use. Defaults to the server's working directory.",
+}
+
+func (s *mcpServer) tools() []mcp.Tool {
+	return []mcp.Tool{
+		{
+			Name:        "suggest_commit_message",
+			Title:       "Suggest commit message",
+			Description: "Suggest commit message subjects for the staged changes, in the repository's configured format. Pass a prefix to get only suggestions that continue it.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"prefix": map[string]any{
+						"type":        "string",
+						"description": "Start of the subject the suggestions must continue, e.g. \"fix(api): \".",
+					},
+					"repository": mcpRepositoryProperty,
+				},
+			},
+			Handler: s.suggest,
+		},
+		{
+			Name:        "lint_commit_message",
+			Title:       "Lint commit message",
+			Description: "Check a complete commit message against the repository's format and lint rules (subject length, type, scope, mood, body wrapping, required trailers).",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"message": map[string]any{
+						"type":        "string",
+						"description": "The commit message: subject, optional blank line and body, optional trailers.",
+					},
+					"repository": mcpRepositoryProperty,
+				},
+				"required": []string{"message"},
+			},
+			Handler: s.lint,
+		},
+		{
+			Name:        "describe_range",
+			Title:       "Describe revision range",
+			Description: "Suggest commit message subjects describing all changes in a revision range (such as main..HEAD) or a single commit, e.g. for a squash commit or pull request title.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"range": map[string]any{
+						"type":        "string",
+						"description": "A revision range like main..HEAD, or a single commit.",
+					},
+					"repository": mcpRepositoryProperty,
+				},
+				"required": []string{"range"},
+			},
+			Handler: s.describeRange,
+		},
+	}
+}
+
+// enter switches to repo, or back to the starting directory when it is
+// empty, and checks that it is inside a git work tree.
+func (s *mcpServer) enter(repo string) error {
+	dir := s.startDir
+	if repo != "" {
+		abs, err := filepath.Abs(repo)
+		if err != nil {
+			return fmt.Errorf("diffscribe: %w", err)
+		}
+		dir = abs
+	}
+	return enterRepo(&s.dir, dir)
+}
+
+func (s *mcpServer) suggest(args json.RawMessage) (mcp.Result, error) {
+	var in struct {
+		Prefix     string `json:"prefix"`
+		Repository string `json:"repository"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return mcp.Result{}, fmt.Errorf("diffscribe: invalid arguments: %w", err)
+	}
+	if err := s.enter(in.Repository); err != nil {
+		return mcp.Result{}, err
+	}
+	c, err := collectContext()
+	if err != nil {
+		return mcp.Result{}, err
+	}
+	if len(c.Paths) == 0 {
+		return mcp.Result{}, errors.New("diffscribe: nothing is staged; stage the changes with git add first")
+	}
+	return mcpSuggestions(c, in.Prefix)
+}
+
+func (s *mcpServer) describeRange(args json.RawMessage) (mcp.Result, error) {
+	var in struct {
+		Range      string `json:"range"`
+		Repository string `json:"repository"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return mcp.Result{}, fmt.Errorf("diffscribe: invalid arguments: %w", err)
+	}
+	rng := strings.TrimSpace(in.Range)
+	if rng == "" || strings.HasPrefix(rng, "-") {
+		return mcp.Result{}, fmt.Errorf("diffscribe: invalid revision range %q", in.Range)
+	}
+	if err := s.enter(in.Repository); err != nil {
+		return mcp.Result{}, err
+	}
+	c, err := collectRangeContext(rng)
+	if err != nil {
+		return mcp.Result{}, err
+	}
+	if len(c.Paths) == 0 {
+		return mcp.Result{}, fmt.Errorf("diffscribe: no changes in %q", rng)
+	}
+	return mcpSuggestions(c, "")
+}
+
+// mcpSuggestions generates suggestions for c. Unlike the CLI, it fails
+// instead of falling back to offline placeholders, which an agent would
+// commit verbatim.
+func mcpSuggestions(c gitContext, prefix string) (mcp.Result, error) {
+	candidates, generated, err := generateSuggestions(c, prefix)
+	if err != nil {
+		return mcp.Result{}, err
+	}
+	if !generated || len(candidates) == 0 {
+		return mcp.Result{}, errors.New("diffscribe: no suggestions were generated; check the provider configuration (details are on the server's stderr)")
+	}
+	return mcp.TextResult(strings.Join(candidates, "\n"), newSuggestResult(candidates)), nil
+}
+
+func (s *mcpServer) lint(args json.RawMessage) (mcp.Result, error) {
+	var in struct {
+		Message    string `json:"message"`
+		Repository string `json:"repository"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return mcp.Result{}, fmt.Errorf("diffscribe: invalid arguments: %w", err)
+	}
+	if err := s.enter(in.Repository); err != nil {
+		return mcp.Result{}, err
+	}
+
+	result := newLintResult(lint.Lint(in.Message, lintRules()))
+	lines := []string{"ok"}
+	if !result.Valid {
+		lines = lines[:0]
+		for _, v := range result.Violations {
+			lines = append(lines, v.String())
+		}
+	}
+	return mcp.TextResult(strings.Join(lines, "\n"), result), nil
+}
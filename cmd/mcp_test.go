@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogwilco/diffscribe/internal/mcp"
+)
+
+// mcpArgs encodes tool arguments.
+func mcpArgs(t *testing.T, args map[string]string) json.RawMessage {
+	t.Helper()
+	b, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// newMCPRepo creates a repository with one commit in the working directory
+// and returns an mcpServer started there.
+func newMCPRepo(t *testing.T, config string) (*mcpServer, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRepo(t, dir)
+	writeFile(t, ".diffscribe.yaml", config)
+	return &mcpServer{startDir: dir}, dir
+}
+
+func TestMCPSuggest(t *testing.T) {
+	s, dir := newMCPRepo(t, "llm:\n  provider: fake\nquantity: 2\n")
+
+	_, err := s.suggest(mcpArgs(t, nil))
+	if err == nil || !strings.Contains(err.Error(), "nothing is staged") {
+		t.Errorf("nothing staged: err = %v", err)
+	}
+
+	stageFile(t, dir, "main.go")
+	res, err := s.suggest(mcpArgs(t, map[string]string{"prefix": "feat: "}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := res.StructuredContent.(suggestResult).Suggestions
+	if len(got) == 0 || res.Content[0].Text != strings.Join(got, "\n") {
+		t.Errorf("suggest = %+v", res)
+	}
+	for _, sug := range got {
+		if !strings.HasPrefix(sug, "feat: ") {
+			t.Errorf("suggestion %q does not continue the prefix", sug)
+		}
+	}
+
+	_, err = s.suggest(mcpArgs(t, map[string]string{"repository": t.TempDir()}))
+	if err == nil || !strings.Contains(err.Error(), "is not a git repository") {
+		t.Errorf("repository outside git: err = %v", err)
+	}
+	if _, err := s.suggest(json.RawMessage(`{"prefix": 1}`)); err == nil || !strings.Contains(err.Error(), "invalid arguments") {
+		t.Errorf("bad arguments: err = %v", err)
+	}
+}
+
+func TestMCPRefusesPlaceholders(t *testing.T) {
+	cases := []struct{ name, config string }{
+		{"no API key", "llm:\n  provider: openai\n"},
+		{"every suggestion fails lint", "llm:\n  provider: fake\n  max_repairs: 0\nlint:\n  types: [perf]\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, dir := newMCPRepo(t, tc.config)
+			isolateAPIKey(t)
+			stageFile(t, dir, "main.go")
+			res, err := s.suggest(mcpArgs(t, nil))
+			if err == nil || !strings.Contains(err.Error(), "no suggestions were generated") {
+				t.Errorf("suggest = %+v, %v; want placeholders refused", res, err)
+			}
+		})
+	}
+}
+
+func TestMCPDescribeRange(t *testing.T) {
+	s, dir := newMCPRepo(t, "llm:\n  provider: fake\n")
+	stageFile(t, dir, "main.go")
+	gitIn(t, dir, "commit", "-q", "-m", "add main")
+
+	for _, rng := range []string{"", "  ", "-p", "--output=/tmp/x"} {
+		_, err := s.describeRange(mcpArgs(t, map[string]string{"range": rng}))
+		if err == nil || !strings.Contains(err.Error(), "invalid revision range") {
+			t.Errorf("range %q: err = %v", rng, err)
+		}
+	}
+	if _, err := s.describeRange(mcpArgs(t, map[string]string{"range": "HEAD..HEAD"})); err == nil || !strings.Contains(err.Error(), "no changes") {
+		t.Errorf("empty range: err = %v", err)
+	}
+	if _, err := s.describeRange(mcpArgs(t, map[string]string{"range": "nosuchref..HEAD"})); err == nil {
+		t.Error("unknown revision: no error")
+	}
+
+	res, err := s.describeRange(mcpArgs(t, map[string]string{"range": "HEAD~1..HEAD"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.StructuredContent.(suggestResult).Suggestions; len(got) == 0 {
+		t.Errorf("describe_range = %+v", res)
+	}
+}
+
+func TestMCPLint(t *testing.T) {
+	s, dir := newMCPRepo(t, "lint:\n  types: [feat, fix]\n  subject_max_length: 30\n")
+	other := filepath.Join(t.TempDir(), "other")
+	newRepo(t, other)
+
+	lint := func(message, repo string) mcp.Result {
+		t.Helper()
+		res, err := s.lint(mcpArgs(t, map[string]string{"message": message, "repository": repo}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := lint("fix: handle empty diffs", "")
+	if res.Content[0].Text != "ok" || !res.StructuredContent.(lintResult).Valid {
+		t.Errorf("valid message = %+v", res)
+	}
+
+	res = lint("chore: tidy up every last corner of the repository", dir)
+	result := res.StructuredContent.(lintResult)
+	if result.Valid || len(result.Violations) < 2 {
+		t.Fatalf("invalid message = %+v", res)
+	}
+	lines := strings.Split(res.Content[0].Text, "\n")
+	if len(lines) != len(result.Violations) {
+		t.Errorf("text %q does not list the %d violations", res.Content[0].Text, len(result.Violations))
+	}
+	for i, v := range result.Violations {
+		if lines[i] != v.String() {
+			t.Errorf("line %d = %q, want %q", i, lines[i], v.String())
+		}
+	}
+
+	// Another repository's rules apply to it.
+	if res := lint("chore: tidy", other); !res.StructuredContent.(lintResult).Valid {
+		t.Errorf("lint in %s = %+v, want its own default rules", other, res)
+	}
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// activeProfile is the profile applied by initConfig, if any.
+var activeProfile string
+
+type profileMatch struct {
+	Remotes []string `mapstructure:"remotes"`
+	Paths   []string `mapstructure:"paths"`
+}
+
+// applyProfile merges the selected profile over the loaded config files. The
+// profile is chosen by --profile/DIFFSCRIBE_PROFILE (or a top-level profile
+// key), falling back to the first profile, by name, whose match block fits
+// the current repository.
+func applyProfile() {
+	profiles, ok := viper.Get("profiles").(map[string]any)
+	if !ok || len(profiles) == 0 {
+		if name := viper.GetString("profile"); name != "" {
+			fmt.Fprintf(os.Stderr, "diffscribe: unknown profile %q\n", name)
+		}
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(viper.GetString("profile")))
+	if name == "" {
+		name = matchProfile(profiles)
+	}
+	if name == "" {
+		return
+	}
+
+	settings, ok := profiles[name].(map[string]any)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "diffscribe: unknown profile %q\n", name)
+		return
+	}
+	overrides := make(map[string]any, len(settings))
+	for k, v := range settings {
+		if k != "match" {
+			overrides[k] = v
+		}
+	}
+	if err := viper.MergeConfigMap(overrides); err != nil {
+		fmt.Fprintf(os.Stderr, "diffscribe: unable to apply profile %s: %v\n", name, err)
+		return
+	}
+	recordSources(overrides, "profile "+name)
+	for _, key := range flattenKeys(overrides, "") {
+		if file, ok := configSources["profiles."+name+"."+key]; ok {
+			profileFiles[key] = file
+		}
+	}
+	activeProfile = name
+	debugf("using profile %s", name)
+}
+
+func matchProfile(profiles map[string]any) string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var remotes []string
+	var remotesLoaded bool
+	cwd, _ := os.Getwd()
+
+	for _, name := range names {
+		var m profileMatch
+		if err := viper.UnmarshalKey("profiles."+name+".match", &m); err != nil {
+			fmt.Fprintf(os.Stderr, "diffscribe: invalid match for profile %s: %v\n", name, err)
+			continue
+		}
+		for _, pattern := range m.Paths {
+			if matchPathGlob(expandHome(pattern), cwd) {
+				return name
+			}
+		}
+		if len(m.Remotes) == 0 {
+			continue
+		}
+		if !remotesLoaded {
+			remotes = remoteURLs()
+			remotesLoaded = true
+		}
+		for _, pattern := range m.Remotes {
+			for _, url := range remotes {
+				if matchGlob(pattern, url) {
+					return name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func remoteURLs() []string {
+	var urls []string
+	for _, line := range nonEmptyLines(run("git", "config", "--get-regexp", `^remote\..*\.url$`)) {
+		if _, url, ok := strings.Cut(line, " "); ok {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// matchPathGlob reports whether dir, or any of its parents, matches pattern.
+// A trailing "/**" matches everything below the prefix.
+func matchPathGlob(pattern, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	pattern = filepath.Clean(pattern)
+	if base, ok := strings.CutSuffix(pattern, string(filepath.Separator)+"**"); ok {
+		return dir == base || strings.HasPrefix(dir, base+string(filepath.Separator))
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if ok, _ := filepath.Match(pattern, d); ok {
+			return true
+		}
+		if parent := filepath.Dir(d); parent == d {
+			return false
+		}
+	}
+}
+
+// matchGlob matches s against a pattern where "*" matches any run of
+// characters, including separators, and "?" matches exactly one.
+func matchGlob(pattern, s string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	return err == nil && re.MatchString(s)
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
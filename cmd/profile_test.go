@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*github.com?acme/*", "git@github.com:acme/api.git", true},
+		{"*github.com?acme/*", "https://github.com/acme/api.git", true},
+		{"*github.com?acme/*", "ssh://git@github.com/acme/api", true},
+		{"*github.com?acme/*", "https://github.com/other/api.git", false},
+		{"git@github.com:acme/*", "https://github.com/acme/api.git", false},
+		{"https://**/acme/**", "https://gitlab.example.com/group/acme/sub/api.git", true},
+		{"https://**/acme/**", "git@gitlab.example.com:group/acme/api.git", false},
+		{"*/api.git", "https://github.com/acme/api.git", true},
+		{"*/api?git", "https://github.com/acme/api.git", true},
+		{"*github.com*", "https://githubxcom/acme", false},
+		{"*(acme)*", "https://github.com/(acme)/api", true},
+	}
+	for _, tc := range cases {
+		if got := matchGlob(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestMatchPathGlob(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	work := filepath.Join(home, "work")
+	cases := []struct {
+		pattern, dir string
+		want         bool
+	}{
+		{"~/work/**", work, true},
+		{"~/work/**", filepath.Join(work, "acme", "api"), true},
+		{"~/work/**", filepath.Join(home, "workshop"), false},
+		{"~/work/*", filepath.Join(work, "api"), true},
+		{"~/work/*", filepath.Join(work, "api", "internal"), true},
+		{"~/work/*", work, false},
+		{"~/work", filepath.Join(work, "api"), true},
+		{"~", filepath.Join(home, "personal"), true},
+		{"~/work/**", filepath.Join(t.TempDir(), "work"), false},
+		{"~/work/**", "", false},
+	}
+	for _, tc := range cases {
+		if got := matchPathGlob(expandHome(tc.pattern), tc.dir); got != tc.want {
+			t.Errorf("matchPathGlob(%q, %q) = %v, want %v", tc.pattern, tc.dir, got, tc.want)
+		}
+	}
+}
+
+func TestProfileSelection(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	if out, err := exec.Command("git", "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	if out, err := exec.Command("git", "remote", "add", "origin", "git@github.com:acme/api.git").CombinedOutput(); err != nil {
+		t.Fatalf("git remote: %v\n%s", err, out)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := `profiles:
+  env:
+    quantity: 2
+  flag:
+    quantity: 3
+  remote:
+    match:
+      remotes: ["*github.com?acme/*"]
+    quantity: 4
+  unmatched:
+    match:
+      paths: ["/nowhere/**"]
+      remotes: ["*gitlab.com*"]
+    quantity: 5
+`
+	pathProfile := `  byPath:
+    match:
+      paths: ["` + filepath.Join(cwd, "**") + `"]
+    quantity: 1
+`
+	// Sorts before byPath, so its remote match wins over byPath's path.
+	remoteFirst := `  aRemote:
+    match:
+      remotes: ["*acme/api.git"]
+    quantity: 6
+`
+	profileFlag := rootCmd.PersistentFlags().Lookup("profile")
+	t.Cleanup(func() {
+		_ = profileFlag.Value.Set("")
+		profileFlag.Changed = false
+	})
+
+	cases := []struct {
+		name, config, env, flag, want string
+	}{
+		{name: "first match by name, by path", config: profiles + pathProfile, want: "bypath"},
+		{name: "first match by name, by remote", config: profiles + pathProfile + remoteFirst, want: "aremote"},
+		{name: "matched by remote", config: profiles, want: "remote"},
+		{name: "environment", config: profiles + pathProfile, env: "env", want: "env"},
+		{name: "flag over environment", config: profiles + pathProfile, env: "env", flag: "flag", want: "flag"},
+		{name: "profile key", config: "profile: env\n" + profiles, want: "env"},
+		{name: "environment over profile key", config: "profile: flag\n" + profiles, env: "env", want: "env"},
+		{name: "nothing matches", config: "profiles:\n  unmatched:\n    match:\n      remotes: [\"*gitlab.com*\"]\n"},
+	}
+	for _, tc := range cases {
+		writeFile(t, ".diffscribe.yaml", tc.config)
+		t.Setenv("DIFFSCRIBE_PROFILE", tc.env)
+		_ = profileFlag.Value.Set(tc.flag)
+		profileFlag.Changed = tc.flag != ""
+		resetConfig()
+		if activeProfile != tc.want {
+			t.Errorf("%s: profile = %q, want %q", tc.name, activeProfile, tc.want)
+		}
+	}
+}
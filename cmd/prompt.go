@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/rogwilco/diffscribe/internal/llm"
+	"github.com/spf13/cobra"
+)
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt [prefix] [-- pathspec...]",
+	Short: "Show the prompts and request that would be sent, without calling the API",
+	Long: `prompt renders the system and user prompts exactly as a normal run would,
+then prints the provider request body (with the API key masked), how much of
+the diff was truncated and estimated token counts. Nothing is sent to the
+provider. diffscribe --dry-run is equivalent.`,
+	Args: prefixArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefix := splitPrefixArgs(cmd, args)
+		c, err := collectContext()
+		if err != nil {
+			return err
+		}
+		return writeDryRun(cmd.OutOrStdout(), c, prefix)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(promptCmd)
+}
+
+// writeDryRun describes the request generateCandidates would send for c.
+func writeDryRun(w io.Writer, c gitContext, prefix string) error {
+	cfg, err := newLLMConfig(newTemplateData(c, prefix))
+	if err != nil {
+		return err
+	}
+	p, err := llm.PreviewCommitMessages(context.Background(), llm.Context{
+		Branch:       c.Branch,
+		Source:       c.Source,
+		Paths:        c.Paths,
+		Files:        c.Files,
+		Declarations: c.Declarations,
+		Diff:         c.Diff,
+		Prefix:       prefix,
+	}, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range p.Messages {
+		fmt.Fprintf(w, "== %s prompt ==\n%s\n\n", m.Role, m.Content)
+	}
+
+	fmt.Fprintf(w, "== Request ==\n%s %s\n", p.Method, p.URL)
+	names := make([]string, 0, len(p.Header))
+	for name := range p.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range p.Header[name] {
+			fmt.Fprintf(w, "%s: %s\n", name, v)
+		}
+	}
+	var body bytes.Buffer
+	if err := json.Indent(&body, p.Body, "", "  "); err != nil {
+		body.Reset()
+		body.Write(p.Body)
+	}
+	fmt.Fprintf(w, "\n%s\n\n", body.String())
+
+	fmt.Fprintln(w, "== Stats ==")
+	fmt.Fprintf(w, "Files:     %d\n", len(c.Paths))
+	if c.DiffTotal > maxDiffBytes {
+		fmt.Fprintf(w, "Diff:      %d of %d bytes sent (truncated, %d dropped)\n", maxDiffBytes, c.DiffTotal, c.DiffTotal-maxDiffBytes)
+	} else {
+		fmt.Fprintf(w, "Diff:      %d bytes sent (not truncated)\n", c.DiffTotal)
+	}
+	total := 0
+	for _, m := range p.Messages {
+		n := llm.EstimateTokens(m.Content)
+		total += n
+		fmt.Fprintf(w, "Tokens:    ~%d %s\n", n, m.Role)
+	}
+	fmt.Fprintf(w, "Tokens:    ~%d prompt total", total)
+	if cfg.MaxCompletionTokens > 0 {
+		fmt.Fprintf(w, ", up to %d completion", cfg.MaxCompletionTokens)
+	}
+	fmt.Fprintln(w, " (estimated at ~4 characters per token)")
+	return nil
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// gitIn runs git in dir, failing the test if it fails.
+func gitIn(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+// newRepo creates a repository at dir with one commit.
+func newRepo(t *testing.T, dir string) {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@example.com")
+	writeFile(t, filepath.Join(dir, "README"), "readme\n")
+	gitIn(t, dir, "init", "-q")
+	gitIn(t, dir, "add", "README")
+	gitIn(t, dir, "commit", "-q", "-m", "init")
+}
+
+func TestProjectConfigDirs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outer := filepath.Join(tmp, "outer")
+	newRepo(t, outer)
+	if err := os.MkdirAll(filepath.Join(outer, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(outer, "vendor", "nested")
+	newRepo(t, nested)
+	if err := os.MkdirAll(filepath.Join(nested, "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	worktree := filepath.Join(outer, "wt")
+	gitIn(t, outer, "worktree", "add", "-q", "-b", "wt", worktree)
+	if err := os.MkdirAll(filepath.Join(worktree, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	library := filepath.Join(tmp, "library")
+	newRepo(t, library)
+	gitIn(t, outer, "-c", "protocol.file.allow=always", "submodule", "add", "-q", library, "lib")
+	submodule := filepath.Join(outer, "lib")
+	outside := filepath.Join(tmp, "plain", "dir")
+	if err := os.MkdirAll(outside, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name, cwd string
+		want      []string
+	}{
+		{"repository root", outer, []string{outer}},
+		{"subdirectory", filepath.Join(outer, "a", "b"), []string{outer, filepath.Join(outer, "a"), filepath.Join(outer, "a", "b")}},
+		{"nested repository", filepath.Join(nested, "pkg"), []string{nested, filepath.Join(nested, "pkg")}},
+		{"linked worktree", filepath.Join(worktree, "docs"), []string{worktree, filepath.Join(worktree, "docs")}},
+		{"submodule", submodule, []string{submodule}},
+		{"outside a repository", outside, []string{outside}},
+	}
+	for _, tc := range cases {
+		t.Chdir(tc.cwd)
+		if got := projectConfigDirs(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: dirs = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestProjectConfigMerging(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitIn(t, root, "init", "-q")
+	writeFile(t, filepath.Join(root, ".diffscribe.yaml"), "quantity: 1\nformat: kernel\nllm:\n  model: root-model\n")
+	writeFile(t, filepath.Join(root, "svc", ".diffscribe.yaml"), "quantity: 2\nllm:\n  temperature: 0.5\n")
+	writeFile(t, filepath.Join(root, "svc", "api", ".diffscribe.toml"), "quantity = 3\n")
+	t.Chdir(filepath.Join(root, "svc", "api"))
+	resetConfig()
+
+	for key, want := range map[string]any{
+		"quantity":        3,
+		"format":          "kernel",
+		"llm.model":       "root-model",
+		"llm.temperature": 0.5,
+	} {
+		if got := viper.Get(key); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s = %v (from %s), want %v", key, got, configSource(key), want)
+		}
+	}
+	if want := filepath.Join(root, "svc", ".diffscribe.yaml"); configSource("llm.temperature") != want {
+		t.Errorf("llm.temperature came from %s, want %s", configSource("llm.temperature"), want)
+	}
+}
+
+func TestRepoFlagChangesConfigDiscovery(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	t.Cleanup(func() { repoFlag, repoDirErr = "", nil })
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := filepath.Join(tmp, "start")
+	newRepo(t, start)
+	writeFile(t, filepath.Join(start, ".diffscribe.yaml"), "quantity: 1\n")
+	target := filepath.Join(tmp, "target")
+	newRepo(t, target)
+	writeFile(t, filepath.Join(target, ".diffscribe.yaml"), "quantity: 2\n")
+	gitIn(t, target, "config", "diffscribe.format", "kernel")
+	sub := filepath.Join(target, "sub")
+	writeFile(t, filepath.Join(sub, ".diffscribe.yaml"), "llm:\n  model: sub-model\n")
+
+	cases := []struct{ name, flag, env, want string }{
+		{"flag", sub, "", sub},
+		{"environment", "", sub, sub},
+		{"flag over environment", sub, start, sub},
+		{"neither", "", "", start},
+	}
+	for _, tc := range cases {
+		t.Chdir(start)
+		repoFlag = tc.flag
+		t.Setenv("DIFFSCRIBE_REPO", tc.env)
+		enterRepoDir()
+		if repoDirErr != nil {
+			t.Fatalf("%s: %v", tc.name, repoDirErr)
+		}
+		resetConfig()
+		if cwd, _ := os.Getwd(); cwd != tc.want {
+			t.Errorf("%s: working directory = %s, want %s", tc.name, cwd, tc.want)
+		}
+		if tc.want != sub {
+			continue
+		}
+		if got, want := projectConfigDirs(), []string{target, sub}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: dirs = %v, want %v", tc.name, got, want)
+		}
+		if got := viper.GetInt("quantity"); got != 2 {
+			t.Errorf("%s: quantity = %d, want the target repository's 2", tc.name, got)
+		}
+		if got := viper.GetString("llm.model"); got != "sub-model" {
+			t.Errorf("%s: llm.model = %q, want the subdirectory's", tc.name, got)
+		}
+		if got, src := viper.GetString("format"), configSource("format"); got != "kernel" || src != repoGitConfig {
+			t.Errorf("%s: format = %q from %s, want kernel from the target's git config", tc.name, got, src)
+		}
+	}
+}
+
+func TestRepoFlagErrorIsReturned(t *testing.T) {
+	isolateConfig(t)
+	t.Cleanup(func() { repoFlag, repoDirErr = "", nil })
+	missing := filepath.Join(t.TempDir(), "missing")
+	rootCmd.SetArgs([]string{"--repo", missing, "formats", "list"})
+	t.Cleanup(func() {
+		rootCmd.SetArgs(nil)
+		rootFlags.Lookup("repo").Changed = false
+	})
+	err := Execute()
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("Execute() = %v, want an error naming %s", err, missing)
+	}
+	if ExitCode(err) == 0 {
+		t.Error("ExitCode() = 0 for a missing --repo")
+	}
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rogwilco/diffscribe/internal/httpapi"
+	"github.com/rogwilco/diffscribe/internal/lint"
+	"github.com/rogwilco/diffscribe/internal/version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultServeAddr = "127.0.0.1:7199"
+	maxServeQuantity = 20
+)
+
+var (
+	serveAddr    string
+	serveToken   string
+	serveOrigins []string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve suggestions and linting over a local HTTP/JSON API",
+	Long: `serve answers HTTP requests from IDEs and GUI git clients that cannot spawn
+a process per keystroke:
+
+  GET  /health   {"status": "ok", "version": "..."}
+  POST /suggest  {"repo": "/path", "prefix": "feat: ", "mode": "staged", "quantity": 3}
+  POST /lint     {"repo": "/path", "message": "feat: add x"}
+
+Responses have the same shape as diffscribe --output json and diffscribe lint
+--output json; errors are {"error": "..."} with a 4xx or 5xx status. mode is
+staged (default), unstaged or all, as for --source. quantity is 1 to 20, or 0
+for the configured quantity. repo defaults to the directory the server was
+started in, and configuration is resolved for each repository as the CLI
+would.
+
+With a token (--token, DIFFSCRIBE_SERVE_TOKEN or serve.token) every request
+except /health needs "Authorization: Bearer <token>". Listening on anything
+other than loopback requires one. Browser-based clients must be allowed with
+--cors-origin (or serve.cors_origins); requests from other origins are
+rejected. The serve block is only read from your own config (the global and
+home files, global git config and --config), never from a repository's.`,
+	Example: `  diffscribe serve --addr 127.0.0.1:7199
+
+  curl -s localhost:7199/suggest -H 'Content-Type: application/json' \
+    -d '{"repo": "'"$PWD"'", "prefix": "fix: "}'`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, token, origins := serveSettings(cmd)
+		loopback := httpapi.IsLoopback(addr)
+		if !loopback && token == "" {
+			return fmt.Errorf("diffscribe: refusing to serve on %s without a token (set --token or DIFFSCRIBE_SERVE_TOKEN)", addr)
+		}
+		dir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("diffscribe: %w", err)
+		}
+
+		opts := httpapi.Options{Token: token, Origins: origins, Version: version.String()}
+		if loopback {
+			opts.Hosts = httpapi.LoopbackHosts
+		}
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("diffscribe: unable to listen on %s: %w", addr, err)
+		}
+		srv := &http.Server{
+			Handler:           httpapi.NewHandler(&apiBackend{startDir: dir, dir: dir}, opts),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdown)
+		}()
+
+		fmt.Fprintf(os.Stderr, "diffscribe: serving on http://%s\n", l.Addr())
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("diffscribe: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", defaultServeAddr, "address to listen on (host:port)")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "require this bearer token (prefer DIFFSCRIBE_SERVE_TOKEN, which is not visible in ps)")
+	serveCmd.Flags().StringArrayVar(&serveOrigins, "cors-origin", nil, "browser origin allowed to call the API, or * for any (repeatable)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// serveSettings combines the flags with DIFFSCRIBE_SERVE_TOKEN and the serve
+// block of the configuration; flags win. The serve block is one of the
+// userOnlyKeys, so a repository cannot open the server to the network.
+func serveSettings(cmd *cobra.Command) (addr, token string, origins []string) {
+	addr = serveAddr
+	if !cmd.Flags().Changed("addr") && viper.IsSet("serve.addr") {
+		addr = viper.GetString("serve.addr")
+	}
+	token = serveToken
+	if token == "" {
+		token = os.Getenv("DIFFSCRIBE_SERVE_TOKEN")
+	}
+	if token == "" {
+		token = viper.GetString("serve.token")
+	}
+	origins = serveOrigins
+	if len(origins) == 0 {
+		origins = viper.GetStringSlice("serve.cors_origins")
+	}
+	return addr, strings.TrimSpace(token), origins
+}
+
+// apiBackend answers API requests one at a time, since the working
+// directory and configuration are process-wide.
+type apiBackend struct {
+	mu       sync.Mutex
+	startDir string
+	// dir is the directory configuration was last loaded for.
+	dir string
+}
+
+func (b *apiBackend) enter(repo string) error {
+	dir := b.startDir
+	if repo != "" {
+		abs, err := filepath.Abs(repo)
+		if err != nil {
+			return httpapi.BadRequest("%v", err)
+		}
+		dir = abs
+	}
+	if err := enterRepo(&b.dir, dir); err != nil {
+		return httpapi.BadRequest("%v", err)
+	}
+	return nil
+}
+
+func (b *apiBackend) Suggest(req httpapi.SuggestRequest) (any, error) {
+	if req.Quantity < 0 || req.Quantity > maxServeQuantity {
+		return nil, httpapi.BadRequest("diffscribe: quantity must be between 1 and %d, or 0 for the default", maxServeQuantity)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.enter(req.Repo); err != nil {
+		return nil, err
+	}
+
+	if req.Mode != "" {
+		if err := checkSource(req.Mode); err != nil {
+			return nil, httpapi.BadRequest("%v", err)
+		}
+	}
+	c, err := collectSource(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]any{}
+	if req.Quantity > 0 {
+		overrides["quantity"] = req.Quantity
+	}
+	var candidates []string
+	withSettings(overrides, func() {
+		candidates, err = generateCandidates(c, req.Prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSuggestResult(candidates), nil
+}
+
+func (b *apiBackend) Lint(req httpapi.LintRequest) (any, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.enter(req.Repo); err != nil {
+		return nil, err
+	}
+	return newLintResult(lint.Lint(req.Message, lintRules())), nil
+}
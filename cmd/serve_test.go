@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rogwilco/diffscribe/internal/httpapi"
+)
+
+// stageFile creates a repository at dir, unless there is one, with name
+// staged.
+func stageFile(t *testing.T, dir, name string) {
+	t.Helper()
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		newRepo(t, dir)
+	}
+	writeFile(t, filepath.Join(dir, name), "package x\n")
+	gitIn(t, dir, "add", name)
+}
+
+func TestServeSettingsAreUserOnly(t *testing.T) {
+	home := isolateConfig(t)
+	t.Setenv("DIFFSCRIBE_SERVE_TOKEN", "")
+	os.Unsetenv("DIFFSCRIBE_SERVE_TOKEN")
+	writeFile(t, ".diffscribe.yaml", "serve:\n  addr: 0.0.0.0:7199\n  token: known\n  cors_origins: [\"*\"]\n")
+	resetConfig()
+	addr, token, origins := serveSettings(serveCmd)
+	if addr != defaultServeAddr || token != "" || len(origins) != 0 {
+		t.Errorf("project config: serveSettings() = %q, %q, %q; want the defaults", addr, token, origins)
+	}
+
+	writeFile(t, filepath.Join(home, ".diffscribe.yaml"), "serve:\n  addr: 127.0.0.1:8000\n  token: mine\n  cors_origins: [http://localhost:5173]\n")
+	resetConfig()
+	addr, token, origins = serveSettings(serveCmd)
+	if addr != "127.0.0.1:8000" || token != "mine" || !reflect.DeepEqual(origins, []string{"http://localhost:5173"}) {
+		t.Errorf("home config: serveSettings() = %q, %q, %q", addr, token, origins)
+	}
+
+	t.Setenv("DIFFSCRIBE_SERVE_TOKEN", "from-env")
+	if _, token, _ := serveSettings(serveCmd); token != "from-env" {
+		t.Errorf("token = %q, want the environment's", token)
+	}
+}
+
+func TestAPIBackend(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := filepath.Join(tmp, "api")
+	stageFile(t, api, "server.go")
+	writeFile(t, filepath.Join(api, ".diffscribe.yaml"), "llm:\n  provider: fake\nquantity: 3\nlint:\n  types: [feat, fix, chore, refactor, docs]\n")
+	web := filepath.Join(tmp, "web")
+	stageFile(t, web, "page.go")
+	writeFile(t, filepath.Join(web, ".diffscribe.yaml"), "llm:\n  provider: fake\nlint:\n  types: [feat]\n")
+	b := &apiBackend{startDir: api}
+
+	badRequest := func(name string, err error, want string) {
+		t.Helper()
+		var apiErr *httpapi.Error
+		if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || !strings.Contains(apiErr.Message, want) {
+			t.Errorf("%s: err = %v, want a bad request containing %q", name, err, want)
+		}
+	}
+	suggest := func(req httpapi.SuggestRequest) []string {
+		t.Helper()
+		res, err := b.Suggest(req)
+		if err != nil {
+			t.Fatalf("Suggest(%+v): %v", req, err)
+		}
+		return res.(suggestResult).Suggestions
+	}
+
+	for _, q := range []int{-1, maxServeQuantity + 1} {
+		_, err := b.Suggest(httpapi.SuggestRequest{Quantity: q})
+		badRequest("quantity", err, "or 0 for the default")
+	}
+	_, err = b.Suggest(httpapi.SuggestRequest{Mode: "everything"})
+	badRequest("mode", err, `unknown source "everything"`)
+	_, err = b.Suggest(httpapi.SuggestRequest{Repo: tmp})
+	badRequest("repo", err, "is not a git repository")
+
+	if got := suggest(httpapi.SuggestRequest{}); len(got) != 3 {
+		t.Errorf("default request = %q, want api's quantity of 3", got)
+	}
+	if got := suggest(httpapi.SuggestRequest{Quantity: 1, Mode: sourceStaged}); len(got) != 1 {
+		t.Errorf("quantity 1 = %q", got)
+	}
+	if got := suggest(httpapi.SuggestRequest{Mode: sourceUnstaged}); len(got) != 0 {
+		t.Errorf("unstaged = %q, want nothing with no unstaged changes", got)
+	}
+	if got := suggest(httpapi.SuggestRequest{Repo: web}); len(got) == 0 || slices.ContainsFunc(got, func(s string) bool { return !strings.HasPrefix(s, "feat: ") }) {
+		t.Errorf("web = %q, want only the feat suggestions its lint.types allow", got)
+	}
+
+	lint := func(repo string) bool {
+		t.Helper()
+		res, err := b.Lint(httpapi.LintRequest{Repo: repo, Message: "chore: tidy"})
+		if err != nil {
+			t.Fatalf("Lint(%s): %v", repo, err)
+		}
+		return res.(lintResult).Valid
+	}
+	if lint(web) {
+		t.Error("web allows chore, want its own lint.types")
+	}
+	if !lint("") {
+		t.Error("the start directory rejects chore, want api's lint.types")
+	}
+	if lint(web) || !lint(api) {
+		t.Error("switching back and forth between repositories kept stale rules")
+	}
+}
@@ -4,92 +4,436 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
-	"text/template"
 	"time"
 
+	"github.com/rogwilco/diffscribe/internal/gitrepo"
 	"github.com/rogwilco/diffscribe/internal/llm"
+	"github.com/rogwilco/diffscribe/internal/semantic"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// maxDiffBytes caps how much of the diff is sent to the model.
+const maxDiffBytes = 8000
+
+// defaultGitTimeout bounds reading the repository (git.timeout).
+const defaultGitTimeout = 10 * time.Second
+
+// maxDeclarations caps how many changed declarations semantic analysis adds
+// to the prompt, and maxAnalyzedBytes the size of the files it reads.
+const (
+	maxDeclarations  = 40
+	maxAnalyzedBytes = 1 << 20
+)
+
 type gitContext struct {
 	Branch string
+	// Source describes which changes were collected, for the prompt.
+	Source string
 	Paths  []string
-	Diff   string
+	Files  []llm.File
+	// Declarations are filled in by semantic analysis (semantic.enabled).
+	Declarations []llm.Declaration
+	Diff         string
+	// DiffTotal is the size of the diff before it was capped to maxDiffBytes.
+	DiffTotal int
+}
+
+// Change sources selectable with --source.
+const (
+	sourceStaged   = "staged"
+	sourceUnstaged = "unstaged"
+	sourceAll      = "all"
+)
+
+// sourceLabels tell the model which changes it is describing.
+var sourceLabels = map[string]string{
+	sourceStaged:   "staged changes (the index against HEAD)",
+	sourceUnstaged: "unstaged changes (the working tree against the index)",
+	sourceAll:      "all changes to tracked files (the working tree against HEAD, as git commit -a would commit them)",
 }
 
+var (
+	sourceFlag string
+	// pathspecs limit the collected changes; they follow -- on the command
+	// line.
+	pathspecs []string
+)
+
+// collectContext collects the changes selected by --source and pathspecs,
+// or the stash named by DIFFSCRIBE_STASH_COMMIT.
 func collectContext() (gitContext, error) {
 	if oid := strings.TrimSpace(os.Getenv("DIFFSCRIBE_STASH_COMMIT")); oid != "" {
-		return collectStashContext(oid), nil
+		return collectStashContext(oid)
 	}
+	return collectSource(sourceFlag, pathspecs...)
+}
 
-	return gitContext{
-		Branch: strings.TrimSpace(run("git", "rev-parse", "--abbrev-ref", "HEAD")),
-		Paths:  nonEmptyLines(run("git", "diff", "--cached", "--name-only")),
-		Diff:   capString(run("git", "diff", "--cached", "--unified=0"), 8000),
-	}, nil
+// collectSource collects one source of changes (staged when empty).
+func collectSource(source string, pathspecs ...string) (gitContext, error) {
+	if source == "" {
+		source = sourceStaged
+	}
+	if err := checkSource(source); err != nil {
+		return gitContext{}, err
+	}
+	c, err := collectGit(func(ctx context.Context, repo gitrepo.Collector) (gitrepo.Change, error) {
+		switch source {
+		case sourceUnstaged:
+			return repo.Unstaged(ctx, pathspecs...)
+		case sourceAll:
+			return repo.All(ctx, pathspecs...)
+		}
+		return repo.Staged(ctx, pathspecs...)
+	})
+	c.Source = sourceLabels[source]
+	return c, err
 }
 
-func collectStashContext(oid string) gitContext {
-	return gitContext{
-		Branch: strings.TrimSpace(run("git", "rev-parse", "--abbrev-ref", "HEAD")),
-		Paths:  nonEmptyLines(run("git", "stash", "show", "--include-untracked", "--name-only", oid)),
-		Diff:   capString(run("git", "stash", "show", "--include-untracked", "--patch", oid), 8000),
+func checkSource(source string) error {
+	if _, ok := sourceLabels[source]; !ok {
+		return fmt.Errorf("diffscribe: unknown source %q (want staged, unstaged or all)", source)
+	}
+	return nil
+}
+
+// stagedSource reports whether --source selects the staged changes, the
+// only ones the daemon tracks.
+func stagedSource() bool {
+	return (sourceFlag == "" || sourceFlag == sourceStaged) && len(pathspecs) == 0
+}
+
+func collectStashContext(oid string) (gitContext, error) {
+	c, err := collectGit(func(ctx context.Context, repo gitrepo.Collector) (gitrepo.Change, error) {
+		return repo.Stash(ctx, oid)
+	})
+	c.Source = "stashed changes"
+	return c, err
+}
+
+// collectRangeContext describes the changes in a revision range such as
+// main..HEAD, or those made by a single commit.
+func collectRangeContext(rng string) (gitContext, error) {
+	c, err := collectGit(func(ctx context.Context, repo gitrepo.Collector) (gitrepo.Change, error) {
+		return repo.Range(ctx, rng)
+	})
+	c.Source = "the commits in " + rng
+	return c, err
+}
+
+// prefixArgs accepts an optional prefix, followed by pathspecs after --.
+func prefixArgs(cmd *cobra.Command, args []string) error {
+	n := len(args)
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		n = dash
+	}
+	if n > 1 {
+		return fmt.Errorf("accepts at most 1 arg before --, received %d", n)
+	}
+	return nil
+}
+
+// splitPrefixArgs returns the prefix and records the pathspecs of args
+// accepted by prefixArgs.
+func splitPrefixArgs(cmd *cobra.Command, args []string) string {
+	rest := args
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		rest, pathspecs = args[:dash], args[dash:]
+	}
+	if len(rest) > 0 {
+		return rest[0]
+	}
+	return ""
+}
+
+// collectGit opens the repository in the working directory with the
+// git.backend collector and reads the branch and one set of changes, all
+// within git.timeout.
+func collectGit(collect func(context.Context, gitrepo.Collector) (gitrepo.Change, error)) (gitContext, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout())
+	defer cancel()
+	repo, err := gitrepo.Open(ctx, strings.TrimSpace(viper.GetString("git.backend")), "")
+	if err != nil {
+		return gitContext{}, gitError(err)
+	}
+	branch, err := repo.Branch(ctx)
+	if err != nil {
+		return gitContext{}, gitError(err)
+	}
+	change, err := collect(ctx, repo)
+	if err != nil {
+		return gitContext{}, gitError(err)
+	}
+	c := newGitContext(branch, change)
+	if viper.GetBool("semantic.enabled") {
+		if c.Declarations, err = declarations(ctx, change); err != nil {
+			return gitContext{}, err
+		}
+	}
+	return c, nil
+}
+
+// declarations compares the declarations in both versions of each changed
+// source file in a semantic.languages language. Files that cannot be read
+// or parsed are left out; running out of time ends the analysis early.
+func declarations(ctx context.Context, change gitrepo.Change) ([]llm.Declaration, error) {
+	analyzers, err := semantic.Select(viper.GetStringSlice("semantic.languages")...)
+	if err != nil {
+		return nil, fmt.Errorf("diffscribe: semantic.languages: %w", err)
+	}
+	var decls []llm.Declaration
+	for _, f := range change.Files {
+		a := semantic.For(analyzers, f.Path)
+		if a == nil {
+			continue
+		}
+		before, after, err := change.Contents(ctx, f)
+		if err != nil {
+			if ctx.Err() != nil {
+				debugf("semantic analysis stopped: %v", err)
+				break
+			}
+			debugf("semantic analysis skipped %s: %v", f.Path, err)
+			continue
+		}
+		if len(before) > maxAnalyzedBytes || len(after) > maxAnalyzedBytes {
+			debugf("semantic analysis skipped %s: larger than %d bytes", f.Path, maxAnalyzedBytes)
+			continue
+		}
+		changes, err := semantic.Diff(a, f.Path, before, after)
+		if err != nil {
+			debugf("semantic analysis skipped %v", err)
+			continue
+		}
+		for _, c := range changes {
+			decls = append(decls, llm.Declaration(c))
+		}
+	}
+	if len(decls) > maxDeclarations {
+		debugf("semantic analysis found %d changed declarations, keeping %d", len(decls), maxDeclarations)
+		decls = decls[:maxDeclarations]
+	}
+	return decls, nil
+}
+
+func gitTimeout() time.Duration {
+	if d := viper.GetDuration("git.timeout"); d > 0 {
+		return d
+	}
+	return defaultGitTimeout
+}
+
+// gitError phrases a collector error for the user.
+func gitError(err error) error {
+	switch {
+	case errors.Is(err, gitrepo.ErrNotRepository):
+		return errors.New("diffscribe: not a git repository")
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("diffscribe: reading the repository took longer than %s (raise git.timeout): %w", gitTimeout(), err)
 	}
+	return fmt.Errorf("diffscribe: %w", err)
 }
 
-func generateCandidates(c gitContext, prefix string) []string {
-	if len(c.Paths) == 0 {
+// enterDir makes dir the working directory and loads the configuration for
+// it. current names the directory loaded last; nothing is done when dir is
+// the same.
+func enterDir(current *string, dir string) error {
+	if dir == *current {
 		return nil
 	}
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("diffscribe: %w", err)
+	}
+	*current = dir
+	resetConfig()
+	for _, w := range configWarnings {
+		debugf("%s", w)
+	}
+	return nil
+}
+
+// enterRepo is enterDir for a directory that must be inside a git work tree.
+func enterRepo(current *string, dir string) error {
+	if err := enterDir(current, dir); err != nil {
+		return err
+	}
+	if strings.TrimSpace(run("git", "rev-parse", "--is-inside-work-tree")) != "true" {
+		return fmt.Errorf("diffscribe: %s is not a git repository", dir)
+	}
+	return nil
+}
 
-	tplData := templateData{
-		Branch:     c.Branch,
-		Paths:      c.Paths,
-		Diff:       c.Diff,
-		FileCount:  len(c.Paths),
-		Summary:    joinLimit(c.Paths, 3),
-		DiffLength: len(c.Diff),
-		Prefix:     prefix,
-		Format:     viper.GetString("format"),
-		Timestamp:  time.Now(),
+func newGitContext(branch string, change gitrepo.Change) gitContext {
+	files := make([]llm.File, len(change.Files))
+	for i, f := range change.Files {
+		files[i] = llm.File(f)
+	}
+	return gitContext{
+		Branch:    branch,
+		Paths:     change.Paths,
+		Files:     files,
+		Diff:      capString(change.Diff, maxDiffBytes),
+		DiffTotal: len(change.Diff),
 	}
+}
 
-	cfg := newLLMConfig(tplData)
+func generateCandidates(c gitContext, prefix string) ([]string, error) {
+	candidates, _, err := generateSuggestions(c, prefix)
+	return candidates, err
+}
+
+// generateSuggestions is generateCandidates, also reporting whether the
+// candidates came from the model rather than the offline fallback.
+func generateSuggestions(c gitContext, prefix string) (candidates []string, generated bool, err error) {
+	g, err := prepareGeneration(c, prefix)
+	if err != nil || g.skip {
+		return nil, false, err
+	}
+	candidates, generated = g.finish(g.run(context.Background()))
+	return candidates, generated, nil
+}
+
+// generation is a request for suggestions built from the current
+// configuration. Only prepareGeneration and finish read the configuration
+// and the working directory; run does not, so a server can let other
+// requests use them while the model answers.
+type generation struct {
+	c      gitContext
+	prefix string
+	cfg    llm.Config
+	// skip means there is nothing to generate: no changes, or no usable
+	// LLM configuration.
+	skip bool
+}
+
+func prepareGeneration(c gitContext, prefix string) (generation, error) {
+	g := generation{c: c, prefix: prefix, skip: len(c.Paths) == 0}
+	if g.skip {
+		return g, nil
+	}
+	cfg, err := newLLMConfig(newTemplateData(c, prefix))
+	if err != nil {
+		return g, err
+	}
 	if err := requireLLMConfig(cfg); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		return nil
+		g.skip = true
+		return g, nil
 	}
+	g.cfg = cfg
+	return g, nil
+}
 
-	msgs, err := llm.GenerateCommitMessages(context.Background(), llm.Context{
-		Branch: c.Branch,
-		Paths:  c.Paths,
-		Diff:   c.Diff,
-		Prefix: prefix,
-	}, cfg)
+func (g generation) run(ctx context.Context) (llm.Result, error) {
+	return llm.Generate(ctx, llm.Context{
+		Branch:       g.c.Branch,
+		Source:       g.c.Source,
+		Paths:        g.c.Paths,
+		Files:        g.c.Files,
+		Declarations: g.c.Declarations,
+		Diff:         g.c.Diff,
+		Prefix:       g.prefix,
+	}, g.cfg)
+}
+
+// finish records usage and conforms the model's answer, falling back to
+// stub candidates when it failed or every candidate failed lint.
+func (g generation) finish(res llm.Result, err error) (candidates []string, generated bool) {
+	recordUsage("commit", g.cfg, res.Usage)
+	msgs := res.Suggestions
+	if res.PrefixCorrections > 0 {
+		debugf("corrected %d suggestions to continue the prefix (%d dropped)", res.PrefixCorrections, res.PrefixDropped)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "diffscribe: LLM error:", err)
 	} else if len(msgs) > 0 {
-		return msgs
+		if conformed := conformCandidates(msgs, lintRules(), g.prefix); len(conformed) > 0 {
+			return conformed, true
+		}
+		fmt.Fprintf(os.Stderr, "diffscribe: all %d suggestions failed lint\n", len(msgs))
+	}
+
+	return stubCandidates(g.c, g.prefix), false
+}
+
+// suggestResult is the structured form of a suggestion run, shared by
+// --output json, the MCP server and the HTTP API.
+type suggestResult struct {
+	Suggestions []string `json:"suggestions"`
+}
+
+func newSuggestResult(suggestions []string) suggestResult {
+	if suggestions == nil {
+		suggestions = []string{}
+	}
+	return suggestResult{Suggestions: suggestions}
+}
+
+// checkOutputFormat validates an --output flag of the text and json kind.
+func checkOutputFormat(format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("diffscribe: unknown --output %q (want text or json)", format)
 	}
+	return nil
+}
 
-	return stubCandidates(c, prefix)
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
 }
 
 type templateData struct {
-	Branch     string
-	Paths      []string
-	Diff       string
-	FileCount  int
-	Summary    string
-	DiffLength int
-	Prefix     string
-	Format     string
-	Timestamp  time.Time
+	Branch         string
+	Source         string
+	Paths          []string
+	Files          []llm.File
+	Declarations   []llm.Declaration
+	Diff           string
+	FileCount      int
+	Summary        string
+	DiffLength     int
+	Prefix         string
+	Format         string
+	FormatName     string
+	FormatExamples []string
+	Timestamp      time.Time
+}
+
+func newTemplateData(c gitContext, prefix string) templateData {
+	preset := currentPreset()
+	return templateData{
+		Branch:         c.Branch,
+		Source:         c.Source,
+		Paths:          c.Paths,
+		Files:          c.Files,
+		Declarations:   c.Declarations,
+		Diff:           c.Diff,
+		FileCount:      fileCount(c),
+		Summary:        joinLimit(c.Paths, 3),
+		DiffLength:     len(c.Diff),
+		Prefix:         prefix,
+		Format:         preset.Guidance,
+		FormatName:     preset.Name,
+		FormatExamples: preset.Examples,
+		Timestamp:      time.Now(),
+	}
+}
+
+// fileCount counts a rename as one file when the changes are described
+// file by file.
+func fileCount(c gitContext) int {
+	if len(c.Files) > 0 {
+		return len(c.Files)
+	}
+	return len(c.Paths)
 }
 
 type systemPromptData struct {
@@ -105,9 +449,29 @@ type userPromptData struct {
 	Quantity int
 }
 
-func newLLMConfig(data templateData) llm.Config {
-	cfg := llm.Config{
-		APIKey:              strings.TrimSpace(viper.GetString("llm.api_key")),
+func newLLMConfig(data templateData) (llm.Config, error) {
+	cfg := baseLLMConfig()
+	sysData, userData := newPromptData(cfg, data)
+	var err error
+	if cfg.SystemPrompt, err = renderPrompt("system_prompt", sysData); err != nil {
+		return cfg, err
+	}
+	if cfg.UserPrompt, err = renderPrompt("user_prompt", userData); err != nil {
+		return cfg, err
+	}
+
+	rules := lintRules()
+	cfg.MaxSubjectLength = rules.SubjectMaxLength
+	cfg.AllowTrailingPunctuation = !rules.TrailingPunctuation
+	cfg.Validator = candidateValidator(rules, data.Prefix)
+	cfg.MaxRepairs = viper.GetInt("llm.max_repairs")
+	return cfg, nil
+}
+
+func baseLLMConfig() llm.Config {
+	apiKey, _ := resolveAPIKey()
+	return llm.Config{
+		APIKey:              apiKey,
 		Provider:            strings.TrimSpace(viper.GetString("llm.provider")),
 		Model:               strings.TrimSpace(viper.GetString("llm.model")),
 		BaseURL:             strings.TrimSpace(viper.GetString("llm.base_url")),
@@ -115,7 +479,9 @@ func newLLMConfig(data templateData) llm.Config {
 		Quantity:            viper.GetInt("quantity"),
 		MaxCompletionTokens: viper.GetInt("llm.max_completion_tokens"),
 	}
+}
 
+func newPromptData(cfg llm.Config, data templateData) (systemPromptData, userPromptData) {
 	sysData := systemPromptData{
 		templateData: data,
 		Model:        cfg.Model,
@@ -127,33 +493,12 @@ func newLLMConfig(data templateData) llm.Config {
 		templateData: data,
 		Quantity:     cfg.Quantity,
 	}
-
-	cfg.SystemPrompt = renderTemplate(viper.GetString("system_prompt"), sysData)
-	cfg.UserPrompt = renderTemplate(viper.GetString("user_prompt"), userData)
-	return cfg
-}
-
-func renderTemplate(raw string, data any) string {
-	raw = strings.TrimSpace(raw)
-	if raw == "" {
-		return ""
-	}
-	tmpl, err := template.New("prompt").Parse(raw)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "diffscribe: bad system prompt template: %v\n", err)
-		return raw
-	}
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		fmt.Fprintf(os.Stderr, "diffscribe: system prompt render error: %v\n", err)
-		return raw
-	}
-	return buf.String()
+	return sysData, userData
 }
 
 func requireLLMConfig(cfg llm.Config) error {
-	if strings.TrimSpace(cfg.APIKey) == "" {
-		return errors.New("diffscribe: api_key is required (set --api-key or DIFFSCRIBE_API_KEY/OPENAI_API_KEY)")
+	if strings.TrimSpace(cfg.APIKey) == "" && !llm.IsLocal(cfg.Provider) {
+		return errors.New("diffscribe: api_key is required (set --llm-api-key, DIFFSCRIBE_API_KEY/OPENAI_API_KEY, llm.api_key_command or run diffscribe auth login)")
 	}
 	return nil
 }
@@ -174,10 +519,9 @@ func stubCandidates(c gitContext, prefix string) []string {
 	}
 
 	withPrefix := make([]string, 0, len(suggestions))
-	lowerPrefix := strings.ToLower(trimmed)
 	for _, cand := range suggestions {
-		if strings.HasPrefix(strings.ToLower(cand), lowerPrefix) {
-			withPrefix = append(withPrefix, cand)
+		if spliced, ok := llm.ContinuePrefix(cand, trimmed); ok {
+			withPrefix = append(withPrefix, spliced)
 			continue
 		}
 		remainder := strings.TrimLeft(cand, " ")
@@ -190,22 +534,31 @@ func stubCandidates(c gitContext, prefix string) []string {
 	return withPrefix
 }
 
+// debugf writes diagnostics to stderr when DIFFSCRIBE_DEBUG is set, matching
+// the shell integrations.
+func debugf(format string, args ...any) {
+	if os.Getenv("DIFFSCRIBE_DEBUG") == "" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[diffscribe] "+format+"\n", args...)
+}
+
+// run returns the output of a command, killing it after git.timeout. Failures
+// yield whatever was printed; a timeout is reported on stderr so truncated
+// output is not mistaken for a complete answer.
 func run(name string, args ...string) string {
-	cmd := exec.Command(name, args...)
-	cmd.Env = os.Environ()
-	var out bytes.Buffer
-	var errBuf bytes.Buffer
+	timeout := gitTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	var out, errBuf bytes.Buffer
 	cmd.Stdout, cmd.Stderr = &out, &errBuf
-	_ = cmd.Start()
-	done := make(chan struct{})
-	go func() {
-		_ = cmd.Wait()
-		close(done)
-	}()
-	select {
-	case <-done:
-	case <-time.After(1500 * time.Millisecond):
-		_ = cmd.Process.Kill()
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "diffscribe: %s %s timed out after %s; raise git.timeout\n", name, strings.Join(args, " "), timeout)
+		} else if msg := strings.TrimSpace(errBuf.String()); msg != "" {
+			debugf("%s %s: %s", name, strings.Join(args, " "), msg)
+		}
 	}
 	return out.String()
 }
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+// renderPrompt renders the prompt stored under key (system_prompt,
+// user_prompt, branch.system_prompt, ...). When key_file is set it is read
+// instead, unless the inline prompt was passed as a flag.
+func renderPrompt(key string, data any) (string, error) {
+	name, raw, err := loadPrompt(key)
+	if err != nil {
+		return "", err
+	}
+	return renderTemplate(name, raw, data)
+}
+
+func loadPrompt(key string) (name, raw string, err error) {
+	fileKey := key + "_file"
+	path := strings.TrimSpace(viper.GetString(fileKey))
+	if path == "" || flagChanged(key) {
+		return key, viper.GetString(key), nil
+	}
+	path = resolveConfigPath(fileKey, path)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("diffscribe: unable to read %s: %w", fileKey, err)
+	}
+	return path, string(b), nil
+}
+
+// resolveConfigPath resolves a path setting relative to the config file that
+// set it, or that defined the profile setting it. Values from flags, the
+// environment or git config are relative to the working directory.
+func resolveConfigPath(key, path string) string {
+	path = expandHome(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	src := configSources[key]
+	if file, ok := profileFiles[key]; ok && src == "profile "+activeProfile {
+		src = file
+	}
+	if slices.Contains(loadedConfigFiles, src) && !flagChanged(key) {
+		return filepath.Join(filepath.Dir(src), path)
+	}
+	return path
+}
+
+// renderTemplate executes a prompt template. Files matched by the
+// prompt_includes globs are available to {{ template "name.tmpl" . }} under
+// their base names. Parse and execution errors include the template name and
+// line number.
+func renderTemplate(name, raw string, data any) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	tmpl := template.New(name).Funcs(templateFuncs())
+	for _, pattern := range viper.GetStringSlice("prompt_includes") {
+		matches, err := filepath.Glob(resolveConfigPath("prompt_includes", pattern))
+		if err != nil {
+			return "", fmt.Errorf("diffscribe: invalid prompt_includes pattern %q: %w", pattern, err)
+		}
+		for _, path := range matches {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("diffscribe: unable to read prompt include: %w", err)
+			}
+			if _, err := tmpl.New(filepath.Base(path)).Parse(string(b)); err != nil {
+				return "", fmt.Errorf("diffscribe: invalid prompt template: %w", err)
+			}
+		}
+	}
+
+	if _, err := tmpl.Parse(raw); err != nil {
+		return "", fmt.Errorf("diffscribe: invalid prompt template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("diffscribe: prompt template failed: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// templateFuncs are available in every prompt template. The value being
+// transformed comes last so the helpers work in pipelines:
+//
+//	{{ .Diff | truncate 2000 | indent 2 }}
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"truncate":     truncateRunes,
+		"indent":       indentLines,
+		"join":         joinValues,
+		"wrap":         wrapText,
+		"regexReplace": regexReplace,
+		"env":          templateEnv,
+		"git":          templateGit,
+	}
+}
+
+// templateEnvPrefix limits env to diffscribe's own variables, so a project's
+// prompt cannot copy other secrets from the environment to the provider.
+const templateEnvPrefix = "DIFFSCRIBE_"
+
+func templateEnv(name string) (string, error) {
+	if !strings.HasPrefix(name, templateEnvPrefix) {
+		return "", fmt.Errorf("env: only %s* variables are available, not %s", templateEnvPrefix, name)
+	}
+	return os.Getenv(name), nil
+}
+
+// templateGitCommands are the read-only subcommands git may run in a prompt.
+var templateGitCommands = []string{
+	"blame", "describe", "diff", "log", "ls-files", "rev-list", "rev-parse", "shortlog", "show", "status",
+}
+
+// templateGitDenied are option prefixes that would let a prompt set config,
+// run other programs or write files, even through a read-only subcommand.
+var templateGitDenied = []string{"-c", "--config", "--exec-path", "--ext-diff", "--output"}
+
+func templateGit(args ...string) (string, error) {
+	if len(args) == 0 || !slices.Contains(templateGitCommands, args[0]) {
+		return "", fmt.Errorf("git: only %s are available", strings.Join(templateGitCommands, ", "))
+	}
+	for _, arg := range args[1:] {
+		for _, denied := range templateGitDenied {
+			if strings.HasPrefix(arg, denied) {
+				return "", fmt.Errorf("git: %s is not allowed", arg)
+			}
+		}
+	}
+	return strings.TrimSpace(run("git", args...)), nil
+}
+
+func truncateRunes(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+func indentLines(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func joinValues(sep string, v any) string {
+	switch x := v.(type) {
+	case []string:
+		return strings.Join(x, sep)
+	case []any:
+		parts := make([]string, len(x))
+		for i, item := range x {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	}
+	return fmt.Sprint(v)
+}
+
+// wrapText wraps each paragraph of s at width columns, breaking on spaces.
+func wrapText(width int, s string) string {
+	if width <= 0 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	var out []string
+	for _, line := range lines {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			out = append(out, "")
+			continue
+		}
+		cur := words[0]
+		for _, w := range words[1:] {
+			if utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(w) > width {
+				out = append(out, cur)
+				cur = w
+				continue
+			}
+			cur += " " + w
+		}
+		out = append(out, cur)
+	}
+	return strings.Join(out, "\n")
+}
+
+func regexReplace(pattern, repl, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfilePathsResolveAgainstDefiningFile(t *testing.T) {
+	home := isolateConfig(t)
+	global := filepath.Join(home, ".config", "diffscribe")
+	writeFile(t, filepath.Join(global, ".diffscribe.yaml"), `profile: work
+system_prompt_file: base.tmpl
+profiles:
+  work:
+    user_prompt_file: prompts/user.tmpl
+    prompt_includes: [prompts/*.tmpl]
+`)
+	resetConfig()
+
+	cases := []struct{ key, path, want string }{
+		{"system_prompt_file", "base.tmpl", filepath.Join(global, "base.tmpl")},
+		{"user_prompt_file", "prompts/user.tmpl", filepath.Join(global, "prompts", "user.tmpl")},
+		{"prompt_includes", "prompts/*.tmpl", filepath.Join(global, "prompts", "*.tmpl")},
+	}
+	for _, tc := range cases {
+		if got := resolveConfigPath(tc.key, tc.path); got != tc.want {
+			t.Errorf("%s: resolved to %q, want %q", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	isolateConfig(t)
+	cases := []struct{ name, raw, want string }{
+		{"parse", "Branch: {{ .Branch }}\n{{ if }}", "invalid prompt template: template: user_prompt:2:"},
+		{"execute", "line one\n{{ .Missing.Field }}", "prompt template failed: template: user_prompt:2:"},
+		{"helper", "{{ env \"HOME\" }}", "env: only DIFFSCRIBE_* variables are available"},
+		{"include", "{{ template \"missing.tmpl\" . }}", `template "missing.tmpl" not defined`},
+	}
+	for _, tc := range cases {
+		_, err := renderTemplate("user_prompt", tc.raw, map[string]any{"Branch": "main", "Missing": nil})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want it to contain %q", tc.name, err, tc.want)
+		}
+	}
+
+	writeFile(t, ".diffscribe.yaml", "prompt_includes: [\"[\"]\n")
+	resetConfig()
+	if _, err := renderTemplate("user_prompt", "x", nil); err == nil || !strings.Contains(err.Error(), "invalid prompt_includes pattern") {
+		t.Errorf("bad include pattern: err = %v", err)
+	}
+}
+
+func TestRenderTemplateIncludes(t *testing.T) {
+	isolateConfig(t)
+	writeFile(t, "prompts/files.tmpl", `{{ define "files" }}{{ join ", " .Paths }}{{ end }}`)
+	writeFile(t, ".diffscribe.yaml", "prompt_includes: [prompts/*.tmpl]\n")
+	resetConfig()
+	got, err := renderTemplate("user_prompt", `  Files: {{ template "files" . }}  `, map[string]any{"Paths": []string{"a.go", "b.go"}})
+	if err != nil || got != "Files: a.go, b.go" {
+		t.Errorf("renderTemplate() = %q, %v", got, err)
+	}
+	if got, err := renderTemplate("user_prompt", " \n ", nil); got != "" || err != nil {
+		t.Errorf("blank template = %q, %v; want empty", got, err)
+	}
+}
+
+func TestTemplateHelpers(t *testing.T) {
+	isolateConfig(t)
+	t.Setenv("DIFFSCRIBE_TEAM", "platform")
+	t.Setenv("SECRET_TOKEN", "hunter2")
+	cases := []struct{ raw, want string }{
+		{`{{ "héllo wörld" | truncate 5 }}`, "héllo…"},
+		{`{{ "short" | truncate 10 }}`, "short"},
+		{`{{ "short" | truncate -1 }}`, "short"},
+		{`{{ "a\n\nb" | indent 2 }}`, "  a\n\n  b"},
+		{`{{ join ", " .Paths }}`, "a.go, b.go"},
+		{`{{ join "-" .Counts }}`, "1-2"},
+		{`{{ join "-" .Branch }}`, "main"},
+		{`{{ "one two three four" | wrap 9 }}`, "one two\nthree\nfour"},
+		{`{{ "one two" | wrap 0 }}`, "one two"},
+		{`{{ regexReplace "^(\\w+)/" "$1: " .Branch2 }}`, "feat: login"},
+		{`{{ env "DIFFSCRIBE_TEAM" }}`, "platform"},
+	}
+	data := map[string]any{"Paths": []string{"a.go", "b.go"}, "Counts": []any{1, 2}, "Branch": "main", "Branch2": "feat/login"}
+	for _, tc := range cases {
+		if got, err := renderTemplate("t", tc.raw, data); err != nil || got != tc.want {
+			t.Errorf("%s = %q, %v; want %q", tc.raw, got, err, tc.want)
+		}
+	}
+
+	for _, raw := range []string{
+		`{{ regexReplace "(" "" "x" }}`,
+		`{{ env "SECRET_TOKEN" }}`,
+		`{{ env "PATH" }}`,
+	} {
+		if got, err := renderTemplate("t", raw, data); err == nil {
+			t.Errorf("%s = %q, want an error", raw, got)
+		}
+	}
+}
+
+func TestTemplateGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	isolateConfig(t)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRepo(t, cwd)
+
+	if got, err := renderTemplate("t", `{{ git "log" "-1" "--format=%s" }}`, nil); err != nil || got != "init" {
+		t.Errorf("git log = %q, %v; want init", got, err)
+	}
+	pwned := filepath.Join(t.TempDir(), "pwned")
+	for _, raw := range []string{
+		`{{ git }}`,
+		`{{ git "-c" "alias.x=!touch ` + pwned + `" "x" }}`,
+		`{{ git "config" "user.name" }}`,
+		`{{ git "commit" "--allow-empty" "-m" "x" }}`,
+		`{{ git "log" "-c" "alias.x=!touch ` + pwned + `" }}`,
+		`{{ git "log" "-calias.x=!touch ` + pwned + `" }}`,
+		`{{ git "diff" "--ext-diff" }}`,
+		`{{ git "log" "--output=` + pwned + `" }}`,
+		`{{ git "status" "--exec-path=/tmp" }}`,
+	} {
+		if got, err := renderTemplate("t", raw, nil); err == nil {
+			t.Errorf("%s = %q, want an error", raw, got)
+		}
+	}
+	if _, err := os.Stat(pwned); err == nil {
+		t.Error("a template ran a command through git")
+	}
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rogwilco/diffscribe/internal/llm"
+	"github.com/rogwilco/diffscribe/internal/usage"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var usageSince string
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report token usage and estimated cost from the local ledger",
+	Long: `Every request diffscribe makes is recorded in an append-only JSONL ledger
+with its timestamp, repository, model, token counts and estimated cost. usage
+totals the ledger by model and by repository.
+
+The ledger lives at $XDG_STATE_HOME/diffscribe/usage.jsonl by default
+(usage.ledger overrides it, from your own config only; usage.enabled: false
+stops recording). Costs use built-in list prices for common OpenAI models, in
+USD per million tokens; add or override models under usage.prices:
+
+  usage:
+    prices:
+      gpt-4o-mini: {input: 0.15, output: 0.60}`,
+	Example: `  # totals for the current month
+  diffscribe usage
+
+  # the last week, or since a date
+  diffscribe usage --since 7d
+  diffscribe usage --since 2026-01-01`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		if usageSince != "" {
+			var err error
+			if since, err = usage.ParseSince(usageSince, now); err != nil {
+				return err
+			}
+		}
+
+		entries, err := usage.Read(usageLedgerPath(), since)
+		if err != nil {
+			return fmt.Errorf("diffscribe: unable to read usage ledger: %w", err)
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Usage since %s\n", since.Format("2006-01-02 15:04"))
+		if len(entries) == 0 {
+			fmt.Fprintln(out, "\nNo requests recorded.")
+			return nil
+		}
+
+		byModel, all := usage.Summarize(entries, func(e usage.Entry) string { return e.Model })
+		byRepo, _ := usage.Summarize(entries, func(e usage.Entry) string { return fallbackLabel(e.Repo, "(none)") })
+		writeUsageTable(out, "MODEL", byModel)
+		writeUsageTable(out, "REPO", byRepo)
+		fmt.Fprintf(out, "\nTotal: %d requests, %d tokens, %s\n", all.Requests, all.TotalTokens, formatCost(all))
+		return nil
+	},
+}
+
+func init() {
+	usageCmd.Flags().StringVar(&usageSince, "since", "", "start of the report: a date, RFC 3339 time, or duration like 7d (default: start of this month)")
+	rootCmd.AddCommand(usageCmd)
+
+	setDefault("usage.enabled", true)
+}
+
+func writeUsageTable(out io.Writer, label string, totals []usage.Total) {
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tREQUESTS\tPROMPT\tCOMPLETION\tTOTAL\tCOST\n", label)
+	for _, t := range totals {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", t.Key, t.Requests, t.PromptTokens, t.CompletionTokens, t.TotalTokens, formatCost(t))
+	}
+	_ = w.Flush()
+}
+
+func formatCost(t usage.Total) string {
+	cost := fmt.Sprintf("$%.4f", t.Cost)
+	if t.Cost > 0 && t.Cost < 0.0001 {
+		cost = "<$0.0001"
+	}
+	if t.Unpriced > 0 {
+		cost += fmt.Sprintf(" (+%d unpriced)", t.Unpriced)
+	}
+	return cost
+}
+
+func fallbackLabel(v, alt string) string {
+	if strings.TrimSpace(v) == "" {
+		return alt
+	}
+	return v
+}
+
+// recordUsage appends one ledger entry for a generation. Failures are only
+// reported; accounting never blocks a suggestion.
+func recordUsage(command string, cfg llm.Config, u llm.Usage) {
+	if u.Requests == 0 || !viper.GetBool("usage.enabled") {
+		return
+	}
+	e := usage.Entry{
+		Time:             time.Now().UTC(),
+		Command:          command,
+		Repo:             strings.TrimSpace(run("git", "rev-parse", "--show-toplevel")),
+		Provider:         cfg.Provider,
+		Model:            cfg.Model,
+		Requests:         u.Requests,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if cost, ok := usage.EstimateCost(usagePrices(), cfg.Model, u.PromptTokens, u.CompletionTokens); ok {
+		e.Cost = &cost
+	}
+	if err := usage.Append(usageLedgerPath(), e); err != nil {
+		fmt.Fprintf(os.Stderr, "diffscribe: unable to record usage: %v\n", err)
+	}
+}
+
+func usagePrices() map[string]usage.Price {
+	prices := make(map[string]usage.Price, len(usage.DefaultPrices))
+	for name, p := range usage.DefaultPrices {
+		prices[name] = p
+	}
+	addPrices(prices, "", viper.Get("usage.prices"))
+	return prices
+}
+
+// addPrices copies configured prices into prices. Viper splits model names
+// containing dots (gpt-4.1) into nested maps, so maps without input or output
+// keys are walked and their names joined back together.
+func addPrices(prices map[string]usage.Price, name string, v any) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	_, hasInput := m["input"]
+	_, hasOutput := m["output"]
+	if name != "" && (hasInput || hasOutput) {
+		input, inErr := priceValue(m["input"])
+		output, outErr := priceValue(m["output"])
+		if err := errors.Join(inErr, outErr); err != nil {
+			fmt.Fprintf(os.Stderr, "diffscribe: invalid usage.prices.%s: %v\n", name, err)
+			return
+		}
+		prices[name] = usage.Price{Input: input, Output: output}
+		return
+	}
+	for k, child := range m {
+		if name != "" {
+			k = name + "." + k
+		}
+		addPrices(prices, k, child)
+	}
+}
+
+func priceValue(v any) (float64, error) {
+	switch x := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(x), 64)
+	}
+	return 0, fmt.Errorf("expected a number, got %v", v)
+}
+
+func usageLedgerPath() string {
+	if p := strings.TrimSpace(viper.GetString("usage.ledger")); p != "" {
+		return resolveConfigPath("usage.ledger", p)
+	}
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		home, _ := os.UserHomeDir()
+		state = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(state, "diffscribe", "usage.jsonl")
+}
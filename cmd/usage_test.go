@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rogwilco/diffscribe/internal/usage"
+)
+
+func TestAddPrices(t *testing.T) {
+	cases := []struct {
+		name   string
+		config any
+		want   map[string]usage.Price
+	}{
+		{"none", nil, map[string]usage.Price{}},
+		{"not a map", "cheap", map[string]usage.Price{}},
+		{
+			"plain names",
+			map[string]any{"mini": map[string]any{"input": 0.15, "output": 0.6}, "big": map[string]any{"input": 2, "output": int64(8)}},
+			map[string]usage.Price{"mini": {Input: 0.15, Output: 0.6}, "big": {Input: 2, Output: 8}},
+		},
+		{
+			"dotted names split into maps",
+			map[string]any{"gpt-4": map[string]any{
+				"1":      map[string]any{"input": 2.0, "output": 8.0},
+				"1-mini": map[string]any{"input": 0.4},
+			}},
+			map[string]usage.Price{"gpt-4.1": {Input: 2, Output: 8}, "gpt-4.1-mini": {Input: 0.4}},
+		},
+		{
+			"strings",
+			map[string]any{"local": map[string]any{"input": " 0.5 ", "output": "1"}},
+			map[string]usage.Price{"local": {Input: 0.5, Output: 1}},
+		},
+		{
+			"invalid values are skipped",
+			map[string]any{"bad": map[string]any{"input": "free"}, "worse": map[string]any{"output": []any{1}}, "ok": map[string]any{"output": 1}},
+			map[string]usage.Price{"ok": {Output: 1}},
+		},
+		{"price without a name", map[string]any{"input": 1, "output": 2}, map[string]usage.Price{}},
+	}
+	for _, tc := range cases {
+		got := map[string]usage.Price{}
+		addPrices(got, "", tc.config)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: prices = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUsagePricesFromConfig(t *testing.T) {
+	isolateConfig(t)
+	writeFile(t, ".diffscribe.yaml", `usage:
+  prices:
+    gpt-4.1: {input: 3, output: 9}
+    gpt-4.1-mini: {input: "0.5", output: 2}
+    acme.model-v1.5: {input: 1}
+`)
+	resetConfig()
+	prices := usagePrices()
+	for name, want := range map[string]usage.Price{
+		"gpt-4.1":         {Input: 3, Output: 9},
+		"gpt-4.1-mini":    {Input: 0.5, Output: 2},
+		"acme.model-v1.5": {Input: 1},
+		"gpt-4o-mini":     usage.DefaultPrices["gpt-4o-mini"],
+	} {
+		if got := prices[name]; got != want {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestUsageLedgerIsUserOnly(t *testing.T) {
+	home := isolateConfig(t)
+	state := filepath.Join(home, "state")
+	t.Setenv("XDG_STATE_HOME", state)
+	defaultLedger := filepath.Join(state, "diffscribe", "usage.jsonl")
+
+	writeFile(t, ".diffscribe.yaml", "usage:\n  ledger: /tmp/elsewhere.jsonl\n")
+	resetConfig()
+	if got := usageLedgerPath(); got != defaultLedger {
+		t.Errorf("project config: ledger = %s, want %s", got, defaultLedger)
+	}
+
+	global := filepath.Join(home, ".config", "diffscribe")
+	writeFile(t, filepath.Join(global, ".diffscribe.yaml"), "usage:\n  ledger: ledger.jsonl\n")
+	resetConfig()
+	if got, want := usageLedgerPath(), filepath.Join(global, "ledger.jsonl"); got != want {
+		t.Errorf("global config: ledger = %s, want %s", got, want)
+	}
+}
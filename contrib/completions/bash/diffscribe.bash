@@ -17,6 +17,8 @@ _diffscribe_candidates() {
     oid=$(command git stash create "${_diffscribe_stash_args[@]}" 2>/dev/null) || return
     [[ -n $oid ]] || return
     DIFFSCRIBE_STASH_COMMIT=$oid "${diffscribe_cmd[@]}" "$prefix" 2>/dev/null
+  elif [[ $mode == "all" ]]; then
+    "${diffscribe_cmd[@]}" --source all "$prefix" 2>/dev/null
   else
     "${diffscribe_cmd[@]}" "$prefix" 2>/dev/null
   fi
@@ -24,6 +26,43 @@ _diffscribe_candidates() {
 
 declare -a _diffscribe_stash_args=()
 
+# Prints "all" when the commit command line has -a/--all (alone or in a
+# bundle such as -am), so suggestions describe what git commit -a commits.
+# Only letters before the first option taking an argument count, so -m"add"
+# and -S<keyid> are not read as -a.
+_diffscribe_commit_source() {
+  local i token skip_next=0
+  for (( i=1; i<COMP_CWORD; i++ )); do
+    token=${COMP_WORDS[i]}
+    if (( skip_next )); then
+      skip_next=0
+      continue
+    fi
+    case $token in
+      --)
+        return 0
+        ;;
+      --all)
+        printf 'all'
+        return 0
+        ;;
+      -m|--message|-F|--file|-C|-c|-t|--reuse-message|--reedit-message|--template|--author|--date)
+        skip_next=1
+        ;;
+      --*)
+        ;;
+      -*)
+        if [[ $token =~ ^-[^mFcCStu]*a ]]; then
+          printf 'all'
+          return 0
+        fi
+        # A bundle ending in an option that takes an argument, such as -vm
+        [[ $token =~ ^-[^mFcCStu]*[mFcCt]$ ]] && skip_next=1
+        ;;
+    esac
+  done
+}
+
 _diffscribe_stash_save_prefix() {
   _diffscribe_stash_args=()
   local cword=${COMP_CWORD}
@@ -174,10 +213,11 @@ _git_commit() {
     return 0
   fi
 
-  # When previous token is -m or --message, use diffscribe suggestions for commit
-  if [[ "$prev" == "-m" || "$prev" == "--message" ]]; then
+  # When previous token is -m or --message (or a bundle such as -am), use
+  # diffscribe suggestions for commit
+  if [[ "$prev" == "-m" || "$prev" == "--message" || "$prev" == -[!-]*m ]]; then
     local IFS=$'\n'
-    COMPREPLY=( $(compgen -W "$(_diffscribe_candidates "$cur")" -- "$cur") )
+    COMPREPLY=( $(compgen -W "$(_diffscribe_candidates "$cur" "$(_diffscribe_commit_source)")" -- "$cur") )
     return 0
   fi
 
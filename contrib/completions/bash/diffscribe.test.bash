@@ -11,6 +11,8 @@ cat <<'EOF' >"$TMP_DIR/diffscribe"
 set -euo pipefail
 if [[ -n ${DIFFSCRIBE_STASH_COMMIT:-} ]]; then
   printf 'stash-candidate\n'
+elif [[ " $* " == *" --source all "* ]]; then
+  printf 'all-candidate\n'
 else
   printf 'commit-candidate\n'
 fi
@@ -56,6 +58,38 @@ fi
 [[ ${#COMPREPLY[@]} -gt 0 ]] || { echo "FAIL: no commit completions" >&2; exit 1; }
 assert_eq "commit-candidate" "${COMPREPLY[0]}" "bash commit completion"
 
+# Commit -a completion, as a separate flag and bundled with -m
+COMPREPLY=()
+COMP_WORDS=(git commit -a -m "")
+COMP_CWORD=4
+_git_commit
+assert_eq "all-candidate" "${COMPREPLY[0]-}" "bash commit -a completion"
+
+COMPREPLY=()
+COMP_WORDS=(git commit -am "")
+COMP_CWORD=3
+_git_commit
+assert_eq "all-candidate" "${COMPREPLY[0]-}" "bash commit -am completion"
+
+COMPREPLY=()
+COMP_WORDS=(git commit -va -m "")
+COMP_CWORD=4
+_git_commit
+assert_eq "all-candidate" "${COMPREPLY[0]-}" "bash commit -va completion"
+
+# An a in the argument of a bundled option is not -a
+COMPREPLY=()
+COMP_WORDS=(git commit "-madd x" -Sabcdef -m "")
+COMP_CWORD=5
+_git_commit
+assert_eq "commit-candidate" "${COMPREPLY[0]-}" "bash commit -m/-S argument completion"
+
+COMPREPLY=()
+COMP_WORDS=(git commit -vm -all -m "")
+COMP_CWORD=5
+_git_commit
+assert_eq "commit-candidate" "${COMPREPLY[0]-}" "bash commit -vm argument completion"
+
 # Stash push completion with flags/pathspec
 COMPREPLY=()
 COMP_WORDS=(git stash push --include-untracked -- src -m "")
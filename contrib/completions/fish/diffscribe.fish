@@ -50,16 +50,20 @@ function __diffscribe_fish_quantity
     end
 end
 
-function __diffscribe_fish_call --argument-names prefix
+function __diffscribe_fish_call --argument-names prefix source
     if not type -q diffscribe
         return
     end
     set -l qty (__diffscribe_fish_quantity)
+    set -l args --quantity $qty
+    if test "$source" = all
+        set -a args --source all
+    end
     set -l status_active 0
     if __diffscribe_fish_status_start
         set status_active 1
     end
-    set -l raw (command diffscribe --quantity $qty "$prefix" 2>/dev/null)
+    set -l raw (command diffscribe $args "$prefix" 2>/dev/null)
     set -l rc $status
     if test $status_active -eq 1
         __diffscribe_fish_status_finish $rc
@@ -70,9 +74,42 @@ function __diffscribe_fish_call --argument-names prefix
     printf '%s\n' $raw
 end
 
+# Prints "all" when the commit command line has -a/--all (alone or in a
+# bundle such as -am), so suggestions describe what git commit -a commits.
+# Only letters before the first option taking an argument count, so -m"add"
+# and -S<keyid> are not read as -a.
+function __diffscribe_fish_commit_source
+    set -l skip_next 0
+    for token in (commandline -opc)[2..-1]
+        if test $skip_next -eq 1
+            set skip_next 0
+            continue
+        end
+        switch $token
+            case --
+                return
+            case --all
+                echo all
+                return
+            case -m --message -F --file -C -c -t --reuse-message --reedit-message --template --author --date
+                set skip_next 1
+            case '--*'
+            case '-*'
+                if string match -qr -- '^-[^mFcCStu]*a' $token
+                    echo all
+                    return
+                end
+                # A bundle ending in an option that takes an argument, such as -vm
+                if string match -qr -- '^-[^mFcCStu]*[mFcCt]$' $token
+                    set skip_next 1
+                end
+        end
+    end
+end
+
 function __diffscribe_fish_commit
     set -l token (commandline -ct)
-    __diffscribe_fish_call $token
+    __diffscribe_fish_call $token (__diffscribe_fish_commit_source)
 end
 
 function __diffscribe_fish_stash --argument-names subcommand
@@ -23,6 +23,8 @@ tmp.mkdir(parents=True, exist_ok=True)
 set -euo pipefail
 if [[ -n ${DIFFSCRIBE_STASH_COMMIT:-} ]] ; then
   printf 'stash-candidate\n'
+elif [[ " $* " == *" --source all "* ]] ; then
+  printf 'all-candidate\n'
 else
   printf 'commit-candidate\n'
 fi
@@ -55,6 +57,10 @@ end
 set result (__diffscribe_fish_call 'fe')
 assert_eq commit-candidate "$result" "fish commit completion"
 
+# Commit -a completion
+set result (__diffscribe_fish_call 'fe' all)
+assert_eq all-candidate "$result" "fish commit -a completion"
+
 # Stash push completion with flags/pathspec
 set result (__diffscribe_fish_call '' '--include-untracked' -- src)
 assert_eq commit-candidate "$result" "fish stash push completion"
@@ -0,0 +1,54 @@
+package config
+
+//go:generate go run ../../tools/gen-schema ../../contrib/schema/diffscribe.schema.json
+
+import "encoding/json"
+
+// SchemaID is the $id of the published JSON Schema.
+const SchemaID = "https://raw.githubusercontent.com/nickawilliams/diffscribe/main/contrib/schema/diffscribe.schema.json"
+
+// JSONSchema renders the schema as a JSON Schema (draft 2020-12) document for
+// editor validation and autocompletion of .diffscribe.yaml files.
+func JSONSchema() ([]byte, error) {
+	doc := jsonSchema(Schema())
+	doc["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	doc["$id"] = SchemaID
+	doc["title"] = "diffscribe configuration"
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func jsonSchema(f *Field) map[string]any {
+	s := map[string]any{}
+	if f.Description != "" {
+		s["description"] = f.Description
+	}
+	switch f.Kind {
+	case String:
+		s["type"] = "string"
+	case Int:
+		s["type"] = "integer"
+	case Number:
+		s["type"] = "number"
+	case Bool:
+		s["type"] = "boolean"
+	case StringList:
+		s["type"] = "array"
+		s["items"] = map[string]any{"type": "string"}
+	case Object:
+		props := make(map[string]any, len(f.Fields))
+		for name, child := range f.Fields {
+			props[name] = jsonSchema(child)
+		}
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+	case Map:
+		s["type"] = "object"
+		s["additionalProperties"] = jsonSchema(f.Values)
+	}
+	return s
+}
@@ -0,0 +1,324 @@
+// Package config describes the configuration keys diffscribe understands and
+// validates settings maps against them.
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of value a key accepts.
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Number
+	Bool
+	StringList
+	Object // fixed set of fields
+	Map    // arbitrary names, each value described by Values
+)
+
+// Field describes a configuration key.
+type Field struct {
+	Kind        Kind
+	Description string
+	Fields      map[string]*Field // Object
+	Values      *Field            // Map
+	// Dotted marks a Map whose names may contain dots, such as model names
+	// like gpt-4.1. Viper splits those into nested maps, so a nested map that
+	// does not look like a value is treated as the rest of the name.
+	Dotted bool
+}
+
+// Problem is a single validation finding.
+type Problem struct {
+	Key     string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Key, p.Message)
+}
+
+var llmFields = map[string]*Field{
+	"api_key":               {Kind: String, Description: "API key for the LLM provider"},
+	"api_key_command":       {Kind: String, Description: "Shell command whose first output line is the API key"},
+	"provider":              {Kind: String, Description: "LLM provider (openai, openrouter, etc.)"},
+	"model":                 {Kind: String, Description: "LLM model identifier"},
+	"base_url":              {Kind: String, Description: "LLM API base URL"},
+	"temperature":           {Kind: Number, Description: "Sampling temperature"},
+	"quantity":              {Kind: Int, Description: "Number of suggestions to request (prefer the top-level quantity)"},
+	"max_completion_tokens": {Kind: Int, Description: "Max completion tokens to request (0 = provider default)"},
+	"max_repairs":           {Kind: Int, Description: "Follow-up requests allowed for fixing suggestions that break the format"},
+}
+
+// settingFields are the keys that may appear both at the top level and
+// inside a profile.
+func settingFields() map[string]*Field {
+	return map[string]*Field{
+		"llm":                {Kind: Object, Description: "LLM provider settings", Fields: llmFields},
+		"quantity":           {Kind: Int, Description: "Number of suggestions to request"},
+		"format":             {Kind: String, Description: "Commit message format preset or free-text description"},
+		"system_prompt":      {Kind: String, Description: "System prompt template"},
+		"user_prompt":        {Kind: String, Description: "User prompt template"},
+		"system_prompt_file": {Kind: String, Description: "File holding the system prompt template, relative to the config file"},
+		"user_prompt_file":   {Kind: String, Description: "File holding the user prompt template, relative to the config file"},
+		"prompt_includes":    {Kind: StringList, Description: "Globs of template files available to {{ template \"name\" . }} by base name"},
+		"branch": {Kind: Object, Description: "Branch name suggestions", Fields: map[string]*Field{
+			"format":             {Kind: String, Description: "Branch naming convention, e.g. type/TICKET-short-desc"},
+			"system_prompt":      {Kind: String, Description: "System prompt template for branch names"},
+			"user_prompt":        {Kind: String, Description: "User prompt template for branch names"},
+			"system_prompt_file": {Kind: String, Description: "File holding the branch system prompt template"},
+			"user_prompt_file":   {Kind: String, Description: "File holding the branch user prompt template"},
+		}},
+		"lint": {Kind: Object, Description: "Commit message lint rules", Fields: map[string]*Field{
+			"conventional":         {Kind: Bool, Description: "Require a Conventional Commits header"},
+			"types":                {Kind: StringList, Description: "Allowed commit types"},
+			"scopes":               {Kind: StringList, Description: "Allowed scopes (empty allows any)"},
+			"subject_max_length":   {Kind: Int, Description: "Maximum subject length (0 disables)"},
+			"body_wrap":            {Kind: Int, Description: "Maximum body line length (0 disables)"},
+			"imperative":           {Kind: Bool, Description: "Require an imperative description"},
+			"trailing_punctuation": {Kind: Bool, Description: "Reject subjects ending in punctuation"},
+			"trailers":             {Kind: StringList, Description: "Required trailers such as Signed-off-by"},
+		}},
+		"semantic": {Kind: Object, Description: "Summaries of changed declarations in source files", Fields: map[string]*Field{
+			"enabled":   {Kind: Bool, Description: "Add the functions, types and methods that changed to the prompt"},
+			"languages": {Kind: StringList, Description: "Languages to analyze: go, python, typescript (default all)"},
+		}},
+	}
+}
+
+// Schema returns the root of the configuration schema.
+func Schema() *Field {
+	root := settingFields()
+
+	profile := settingFields()
+	profile["match"] = &Field{Kind: Object, Description: "Select the profile automatically", Fields: map[string]*Field{
+		"remotes": {Kind: StringList, Description: "Globs matched against remote URLs"},
+		"paths":   {Kind: StringList, Description: "Globs matched against the working directory and its parents"},
+	}}
+
+	root["profile"] = &Field{Kind: String, Description: "Profile to apply"}
+	root["profiles"] = &Field{Kind: Map, Description: "Named configuration profiles", Values: &Field{Kind: Object, Fields: profile}}
+	root["usage"] = &Field{Kind: Object, Description: "Token usage accounting", Fields: map[string]*Field{
+		"enabled": {Kind: Bool, Description: "Record requests in the usage ledger"},
+		"ledger":  {Kind: String, Description: "Path of the JSONL usage ledger"},
+		"prices": {Kind: Map, Dotted: true, Description: "Model prices in USD per million tokens", Values: &Field{Kind: Object, Fields: map[string]*Field{
+			"input":  {Kind: Number, Description: "Price per million prompt tokens"},
+			"output": {Kind: Number, Description: "Price per million completion tokens"},
+		}}},
+	}}
+	root["daemon"] = &Field{Kind: Object, Description: "Background daemon (diffscribe daemon)", Fields: map[string]*Field{
+		"pregenerate":  {Kind: Bool, Description: "Generate suggestions in the background when the staged changes change"},
+		"debounce":     {Kind: String, Description: "How long the index must stay unchanged before pre-generating, e.g. 1500ms"},
+		"min_interval": {Kind: String, Description: "Minimum time between pre-generation requests to the provider, e.g. 10s"},
+	}}
+	root["git"] = &Field{Kind: Object, Description: "Reading the repository", Fields: map[string]*Field{
+		"backend": {Kind: String, Description: "How changes are read: exec (run git) or go-git (in-process)"},
+		"timeout": {Kind: String, Description: "How long reading the repository may take before failing, e.g. 10s"},
+	}}
+	root["serve"] = &Field{Kind: Object, Description: "Local HTTP/JSON API (diffscribe serve)", Fields: map[string]*Field{
+		"addr":         {Kind: String, Description: "Address to listen on, e.g. 127.0.0.1:7199"},
+		"token":        {Kind: String, Description: "Bearer token required on every request except /health"},
+		"cors_origins": {Kind: StringList, Description: "Browser origins allowed to call the API, or * for any"},
+	}}
+	root["formats"] = &Field{Kind: Map, Description: "Custom commit message format presets", Values: &Field{Kind: Object, Fields: map[string]*Field{
+		"description": {Kind: String, Description: "Short description shown by formats list"},
+		"guidance":    {Kind: String, Description: "Prompt guidance describing the format"},
+		"pattern":     {Kind: String, Description: "Regular expression a subject must match"},
+		"grammar":     {Kind: String, Description: "Header grammar, e.g. <type>[(<scope>)]: <description>"},
+		"types":       {Kind: StringList, Description: "Allowed types"},
+		"scopes":      {Kind: StringList, Description: "Allowed scopes"},
+		"examples":    {Kind: StringList, Description: "Example subjects used as few-shot prompts"},
+	}}}
+	return &Field{Kind: Object, Fields: root}
+}
+
+// Validate checks settings, as produced by viper's AllSettings, against the
+// schema. Problems are sorted by key.
+func Validate(settings map[string]any) []Problem {
+	var problems []Problem
+	validate(Schema(), "", settings, &problems)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Key < problems[j].Key })
+	return problems
+}
+
+func validate(f *Field, key string, value any, problems *[]Problem) {
+	report := func(format string, args ...any) {
+		*problems = append(*problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch f.Kind {
+	case Object, Map:
+		m, ok := value.(map[string]any)
+		if !ok {
+			report("expected a map, got %s", describe(value))
+			return
+		}
+		for name, v := range m {
+			child := f.Values
+			if f.Kind == Object {
+				child = f.Fields[strings.ToLower(name)]
+			} else if f.Dotted && isNameSegment(v, f.Values) {
+				child = f
+			}
+			if child == nil {
+				msg := "unknown key"
+				if s := suggest(strings.ToLower(name), f.Fields); s != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", join(key, s))
+				}
+				*problems = append(*problems, Problem{Key: join(key, name), Message: msg})
+				continue
+			}
+			validate(child, join(key, name), v, problems)
+		}
+	case String:
+		switch value.(type) {
+		case string, int, int64, float64, bool:
+		default:
+			report("expected a string, got %s", describe(value))
+		}
+	case Int:
+		if !isInt(value) {
+			report("expected an integer, got %s", describe(value))
+		}
+	case Number:
+		if !isNumber(value) {
+			report("expected a number, got %s", describe(value))
+		}
+	case Bool:
+		if !isBool(value) {
+			report("expected true or false, got %s", describe(value))
+		}
+	case StringList:
+		switch v := value.(type) {
+		case string:
+		case []any:
+			for i, item := range v {
+				if _, ok := item.(map[string]any); ok {
+					report("item %d: expected a string, got a map", i)
+				}
+			}
+		case []string:
+		default:
+			report("expected a list of strings, got %s", describe(value))
+		}
+	}
+}
+
+// isNameSegment reports whether v is a nested map produced by viper splitting
+// a dotted name, rather than an Object value: none of its keys are fields.
+func isNameSegment(v any, values *Field) bool {
+	m, ok := v.(map[string]any)
+	if !ok || values == nil || values.Kind != Object || len(m) == 0 {
+		return false
+	}
+	for name := range m {
+		if _, ok := values.Fields[strings.ToLower(name)]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func isInt(v any) bool {
+	switch x := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	case float64:
+		return x == float64(int64(x))
+	case string:
+		_, err := strconv.Atoi(strings.TrimSpace(x))
+		return err == nil
+	}
+	return false
+}
+
+func isNumber(v any) bool {
+	if isInt(v) {
+		return true
+	}
+	switch x := v.(type) {
+	case float32, float64:
+		return true
+	case string:
+		_, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return err == nil
+	}
+	return false
+}
+
+func isBool(v any) bool {
+	switch x := v.(type) {
+	case bool:
+		return true
+	case string:
+		_, err := strconv.ParseBool(strings.TrimSpace(x))
+		return err == nil
+	}
+	return false
+}
+
+func describe(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "nothing"
+	case string:
+		return strconv.Quote(x)
+	case map[string]any:
+		return "a map"
+	case []any:
+		return "a list"
+	}
+	return fmt.Sprint(v)
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// suggest returns the field name closest to name, if any is close enough to
+// be a plausible typo. Underscores are ignored, so apiKey suggests api_key.
+func suggest(name string, fields map[string]*Field) string {
+	best, bestDist := "", -1
+	squash := func(s string) string { return strings.ReplaceAll(s, "_", "") }
+	for candidate := range fields {
+		d := distance(squash(name), squash(candidate))
+		if d > max(2, len(candidate)/3) {
+			continue
+		}
+		if bestDist < 0 || d < bestDist || (d == bestDist && candidate < best) {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein edit distance between a and b.
+func distance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
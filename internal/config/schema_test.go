@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateAcceptsKnownKeys(t *testing.T) {
+	settings := map[string]any{
+		"format":   "kernel",
+		"quantity": 3,
+		"llm": map[string]any{
+			"model":       "gpt-4o",
+			"temperature": 0.4,
+		},
+		"lint": map[string]any{
+			"types":      []any{"feat", "fix"},
+			"imperative": "true",
+		},
+		"profiles": map[string]any{
+			"work": map[string]any{
+				"match": map[string]any{"remotes": []any{"*acme*"}},
+				"llm":   map[string]any{"model": "gpt-4o"},
+			},
+		},
+		"formats": map[string]any{
+			"team": map[string]any{"grammar": "<type>: <summary>"},
+		},
+	}
+	if problems := Validate(settings); len(problems) > 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateReportsProblems(t *testing.T) {
+	settings := map[string]any{
+		"quantity": "five",
+		"llm": map[string]any{
+			"temprature": 0.2,
+			"apikey":     "sk-test",
+		},
+		"profiles": map[string]any{
+			"work": map[string]any{"fromat": "kernel"},
+		},
+		"lint": "strict",
+	}
+	var got []string
+	for _, p := range Validate(settings) {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`lint: expected a map, got "strict"`,
+		`llm.apikey: unknown key (did you mean "llm.api_key"?)`,
+		`llm.temprature: unknown key (did you mean "llm.temperature"?)`,
+		`profiles.work.fromat: unknown key (did you mean "profiles.work.format"?)`,
+		`quantity: expected an integer, got "five"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateNoSuggestionForDistantKeys(t *testing.T) {
+	problems := Validate(map[string]any{"completely_unrelated": true})
+	if len(problems) != 1 || problems[0].Message != "unknown key" {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+}
+
+func TestValidateDottedPriceNames(t *testing.T) {
+	// viper splits gpt-4.1-custom into gpt-4 -> 1-custom.
+	settings := map[string]any{
+		"usage": map[string]any{
+			"prices": map[string]any{
+				"gpt-4": map[string]any{
+					"1-custom": map[string]any{"input": 1.5, "output": 6},
+				},
+				"o3": map[string]any{"input": "cheap"},
+			},
+		},
+	}
+	problems := Validate(settings)
+	if len(problems) != 1 || problems[0].String() != `usage.prices.o3.input: expected a number, got "cheap"` {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+}
+
+func TestJSONSchemaIsPublished(t *testing.T) {
+	want, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join("..", "..", "contrib", "schema", "diffscribe.schema.json"))
+	if err != nil {
+		t.Fatalf("read published schema: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("contrib/schema/diffscribe.schema.json is stale; run make schema")
+	}
+}
@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Cache holds suggestions by request key, grouped by repository so that
+// everything generated for a repository can be dropped when its index
+// changes. When full, the oldest entry is evicted.
+type Cache struct {
+	max     int
+	entries map[string]cacheEntry
+	order   []string
+}
+
+type cacheEntry struct {
+	repo        string
+	suggestions []string
+}
+
+// NewCache returns a cache holding at most max entries.
+func NewCache(max int) *Cache {
+	return &Cache{max: max, entries: map[string]cacheEntry{}}
+}
+
+// Get returns the suggestions stored under key.
+func (c *Cache) Get(key string) ([]string, bool) {
+	e, ok := c.entries[key]
+	return e.suggestions, ok
+}
+
+// Put stores suggestions for key, generated in repo.
+func (c *Cache) Put(repo, key string, suggestions []string) {
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = cacheEntry{repo: repo, suggestions: suggestions}
+	for len(c.order) > c.max {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// DropRepo removes every entry generated in repo.
+func (c *Cache) DropRepo(repo string) {
+	kept := c.order[:0]
+	for _, key := range c.order {
+		if c.entries[key].repo == repo {
+			delete(c.entries, key)
+			continue
+		}
+		kept = append(kept, key)
+	}
+	c.order = kept
+}
+
+// Len returns the number of cached entries.
+func (c *Cache) Len() int {
+	return len(c.entries)
+}
+
+// Key hashes the parts of a request that determine its suggestions.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%d:%s", len(p), p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Stamp summarizes the size and modification time of paths. It changes when
+// any of them is written, created or removed.
+func Stamp(paths ...string) string {
+	var b strings.Builder
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			b.WriteString("-;")
+			continue
+		}
+		fmt.Fprintf(&b, "%d:%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
@@ -0,0 +1,172 @@
+// Package daemon implements the Unix socket protocol spoken between the
+// diffscribe CLI and a long-running diffscribe daemon.
+//
+// Each connection carries newline-delimited JSON: the client writes a Request
+// and the daemon answers with exactly one Response, in order.
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Operations understood by the daemon.
+const (
+	OpPing    = "ping"
+	OpSuggest = "suggest"
+	OpStop    = "stop"
+)
+
+var (
+	// ErrRunning is returned by Listen when another daemon owns the socket.
+	ErrRunning = errors.New("daemon: already running")
+	// ErrUnsafeDir is returned when the socket's directory is not private
+	// to the current user.
+	ErrUnsafeDir = errors.New("daemon: unsafe socket directory")
+)
+
+// Request is a single call to the daemon.
+type Request struct {
+	Op string `json:"op"`
+	// Dir is the client's working directory.
+	Dir    string `json:"dir,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// Env holds the client's diffscribe and git environment variables, and
+	// Flags the persistent flags it was given, so the daemon resolves the
+	// same configuration.
+	Env   map[string]string `json:"env,omitempty"`
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+// Response answers a Request.
+type Response struct {
+	Suggestions []string `json:"suggestions,omitempty"`
+	// Cached reports that the suggestions came from the response cache.
+	Cached bool   `json:"cached,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Ping responses describe the daemon.
+	Version string    `json:"version,omitempty"`
+	PID     int       `json:"pid,omitempty"`
+	Started time.Time `json:"started,omitzero"`
+	Entries int       `json:"entries,omitempty"`
+}
+
+// Handler answers requests. Serve calls it from one goroutine per
+// connection.
+type Handler func(Request) Response
+
+// SocketPath returns the per-user socket location:
+// $DIFFSCRIBE_DAEMON_SOCKET, else $XDG_RUNTIME_DIR/diffscribe/daemon.sock,
+// else a diffscribe-<uid> directory under the system temp directory.
+func SocketPath() string {
+	if p := os.Getenv("DIFFSCRIBE_DAEMON_SOCKET"); p != "" {
+		return p
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "diffscribe", "daemon.sock")
+	}
+	return filepath.Join(os.TempDir(), "diffscribe-"+strconv.Itoa(os.Getuid()), "daemon.sock")
+}
+
+// Listen opens the socket at path, readable only by the current user, in a
+// directory that must be private to them (see CheckDir). A socket left
+// behind by a daemon that is no longer running is replaced.
+func Listen(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := CheckDir(dir); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, 200*time.Millisecond); err == nil {
+			conn.Close()
+			return nil, ErrRunning
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return listenPrivate(path)
+}
+
+// Serve answers requests on l until ctx is cancelled or the listener fails.
+// The socket file is removed when Serve returns.
+func Serve(ctx context.Context, l net.Listener, handle Handler) error {
+	defer os.Remove(l.Addr().String())
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveConn(conn, handle)
+		}()
+	}
+}
+
+func serveConn(conn net.Conn, handle Handler) {
+	defer conn.Close()
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	enc := json.NewEncoder(conn)
+	for sc.Scan() {
+		var req Request
+		resp := Response{}
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("daemon: invalid request: %v", err)
+		} else {
+			resp = handle(req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Call sends req to the daemon at path and waits up to timeout for the
+// answer. Connection errors mean no daemon is listening; the socket is not
+// dialed at all unless its directory passes CheckDir.
+func Call(path string, req Request, timeout time.Duration) (Response, error) {
+	if err := CheckDir(filepath.Dir(path)); err != nil {
+		return Response{}, err
+	}
+	conn, err := net.DialTimeout("unix", path, 100*time.Millisecond)
+	if err != nil {
+		return Response{}, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return Response{}, err
+	}
+	var resp Response
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&resp); err != nil {
+		return Response{}, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServeAndCall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "d.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected a private socket, got %v (%v)", info.Mode(), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, l, func(req Request) Response {
+			return Response{Suggestions: []string{req.Op + ":" + req.Prefix}}
+		})
+	}()
+
+	resp, err := Call(path, Request{Op: OpSuggest, Prefix: "feat: "}, time.Second)
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Suggestions, []string{"suggest:feat: "}) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	if _, err := Listen(path); !errors.Is(err, ErrRunning) {
+		t.Fatalf("expected ErrRunning while serving, got %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected socket to be removed, got %v", err)
+	}
+	if _, err := Call(path, Request{Op: OpPing}, time.Second); err == nil {
+		t.Fatalf("expected call to fail without a daemon")
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "d.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	// Leave the socket file behind, as a crashed daemon would.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = Listen(path)
+	if err != nil {
+		t.Fatalf("expected stale socket to be replaced, got %v", err)
+	}
+	l.Close()
+}
+
+func TestUnsafeDir(t *testing.T) {
+	shared := t.TempDir()
+	if err := os.Chmod(shared, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(shared, "d.sock")
+	if _, err := Listen(path); !errors.Is(err, ErrUnsafeDir) {
+		t.Fatalf("expected Listen to refuse a shared directory, got %v", err)
+	}
+	if _, err := Call(path, Request{Op: OpPing}, time.Second); !errors.Is(err, ErrUnsafeDir) {
+		t.Fatalf("expected Call to refuse a shared directory, got %v", err)
+	}
+
+	private := filepath.Join(t.TempDir(), "private")
+	if err := os.Mkdir(private, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(private, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(filepath.Join(link, "d.sock")); !errors.Is(err, ErrUnsafeDir) {
+		t.Fatalf("expected Listen to refuse a symbolic link, got %v", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	c.Put("/a", "k1", []string{"one"})
+	c.Put("/b", "k2", []string{"two"})
+	c.Put("/a", "k3", []string{"three"})
+	if _, ok := c.Get("k1"); ok {
+		t.Fatalf("expected oldest entry to be evicted")
+	}
+	c.DropRepo("/a")
+	if _, ok := c.Get("k3"); ok || c.Len() != 1 {
+		t.Fatalf("expected /a entries to be dropped, %d left", c.Len())
+	}
+	if got, ok := c.Get("k2"); !ok || got[0] != "two" {
+		t.Fatalf("expected /b entry to survive, got %v", got)
+	}
+}
+
+func TestKeyAndStamp(t *testing.T) {
+	if Key("ab", "c") == Key("a", "bc") {
+		t.Fatalf("key parts must not run together")
+	}
+	path := filepath.Join(t.TempDir(), "index")
+	missing := Stamp(path)
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	written := Stamp(path)
+	if written == missing {
+		t.Fatalf("stamp should change when the file appears")
+	}
+	if err := os.WriteFile(path, []byte("xy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if Stamp(path) == written {
+		t.Fatalf("stamp should change when the file is rewritten")
+	}
+}
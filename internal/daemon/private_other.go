@@ -0,0 +1,34 @@
+//go:build !unix
+
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// CheckDir only checks that dir is a directory: ownership and modes are
+// not Unix-style on this platform.
+func CheckDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrUnsafeDir, dir)
+	}
+	return nil
+}
+
+func listenPrivate(path string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
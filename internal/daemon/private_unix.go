@@ -0,0 +1,39 @@
+//go:build unix
+
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// CheckDir refuses a socket directory that another user owns or could
+// write to, since whoever controls it could stand in for the daemon and
+// receive the API keys clients forward. Symbolic links are refused too.
+func CheckDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok {
+		return fmt.Errorf("%w: %s is not a directory", ErrUnsafeDir, dir)
+	}
+	if uid := os.Getuid(); int(st.Uid) != uid {
+		return fmt.Errorf("%w: %s is owned by uid %d, not %d", ErrUnsafeDir, dir, st.Uid, uid)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		return fmt.Errorf("%w: %s has mode %#o, want 0700", ErrUnsafeDir, dir, perm)
+	}
+	return nil
+}
+
+// listenPrivate creates the socket with no permissions for group or
+// others, so there is no moment when another user could connect.
+func listenPrivate(path string) (net.Listener, error) {
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,250 @@
+// Package eval scores generated commit messages against a dataset of recorded
+// changes and the messages people actually wrote for them.
+package eval
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Case is one recorded change and its reference message. Source, Files and
+// Declarations are optional; cases recorded without them are replayed
+// without them.
+type Case struct {
+	ID     string `json:"id"`
+	Branch string `json:"branch,omitempty"`
+	// Source says which changes are described, such as a commit.
+	Source string   `json:"source,omitempty"`
+	Paths  []string `json:"paths"`
+	Files  []File   `json:"files,omitempty"`
+	// Declarations are recorded when semantic analysis was enabled.
+	Declarations []Declaration `json:"declarations,omitempty"`
+	Diff         string        `json:"diff"`
+	Message      string        `json:"message"`
+}
+
+// File describes how one file of a case changed, like llm.File.
+type File struct {
+	Status  string `json:"status"`
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+	Added   int    `json:"added,omitempty"`
+	Removed int    `json:"removed,omitempty"`
+	Binary  bool   `json:"binary,omitempty"`
+	OldMode string `json:"old_mode,omitempty"`
+	NewMode string `json:"new_mode,omitempty"`
+}
+
+// Declaration is one changed declaration of a case, like llm.Declaration.
+type Declaration struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// Subject returns the first line of the reference message.
+func (c Case) Subject() string {
+	return subject(c.Message)
+}
+
+// LoadDataset reads a JSONL dataset, one Case per line. Blank lines and lines
+// starting with # are ignored.
+func LoadDataset(path string) ([]Case, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeDataset(f, path)
+}
+
+func decodeDataset(r io.Reader, name string) ([]Case, error) {
+	var cases []Case
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var c Case
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		if strings.TrimSpace(c.Message) == "" {
+			return nil, fmt.Errorf("%s:%d: case has no reference message", name, line)
+		}
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("line-%d", line)
+		}
+		cases = append(cases, c)
+	}
+	return cases, sc.Err()
+}
+
+// WriteDataset writes cases as JSONL, the format LoadDataset reads.
+func WriteDataset(w io.Writer, cases []Case) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, c := range cases {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Score is the evaluation of one case under one configuration.
+type Score struct {
+	Case        string   `json:"case"`
+	Reference   string   `json:"reference"`
+	Suggestions []string `json:"suggestions"`
+	// Compliant counts suggestions that pass the format check.
+	Compliant int `json:"compliant"`
+	// WithinLimit counts suggestions whose subject fits the length limit.
+	WithinLimit int     `json:"within_limit"`
+	MeanLength  float64 `json:"mean_length"`
+	// Similarity is the best word overlap between a suggested subject and
+	// the reference subject; TopSimilarity only considers the first
+	// suggestion.
+	Similarity    float64 `json:"similarity"`
+	TopSimilarity float64 `json:"top_similarity"`
+	// Judge is the mean LLM-as-judge score (1-5), or 0 when not judged.
+	Judge  float64 `json:"judge,omitempty"`
+	Tokens int     `json:"tokens,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// ScoreSuggestions scores suggestions against the reference message. check
+// reports whether a suggestion complies with the format; maxLength is the
+// subject length limit (0 disables it).
+func ScoreSuggestions(c Case, suggestions []string, check func(string) bool, maxLength int) Score {
+	s := Score{Case: c.ID, Reference: c.Subject(), Suggestions: suggestions}
+	if len(suggestions) == 0 {
+		return s
+	}
+	total := 0
+	for i, sug := range suggestions {
+		subj := subject(sug)
+		n := utf8.RuneCountInString(subj)
+		total += n
+		if check == nil || check(sug) {
+			s.Compliant++
+		}
+		if maxLength <= 0 || n <= maxLength {
+			s.WithinLimit++
+		}
+		sim := Similarity(subj, s.Reference)
+		if i == 0 {
+			s.TopSimilarity = sim
+		}
+		s.Similarity = max(s.Similarity, sim)
+	}
+	s.MeanLength = float64(total) / float64(len(suggestions))
+	return s
+}
+
+// Similarity is the F1 score of the words shared by a and b, ignoring case
+// and punctuation: 1 for the same words, 0 for none in common.
+func Similarity(a, b string) float64 {
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	counts := make(map[string]int, len(wb))
+	for _, w := range wb {
+		counts[w]++
+	}
+	common := 0
+	for _, w := range wa {
+		if counts[w] > 0 {
+			counts[w]--
+			common++
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+	precision := float64(common) / float64(len(wa))
+	recall := float64(common) / float64(len(wb))
+	return 2 * precision * recall / (precision + recall)
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func subject(msg string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+	return strings.TrimSpace(first)
+}
+
+// Summary aggregates the scores of one configuration.
+type Summary struct {
+	Variant string `json:"variant"`
+	Cases   int    `json:"cases"`
+	Errors  int    `json:"errors"`
+	// Compliance and WithinLimit are fractions of all suggestions.
+	Compliance  float64 `json:"compliance"`
+	WithinLimit float64 `json:"within_limit"`
+	MeanLength  float64 `json:"mean_length"`
+	// Similarity and TopSimilarity are averaged over the cases that
+	// produced suggestions.
+	Similarity    float64 `json:"similarity"`
+	TopSimilarity float64 `json:"top_similarity"`
+	// Judge is averaged over judged cases; JudgedCases is how many.
+	Judge       float64 `json:"judge,omitempty"`
+	JudgedCases int     `json:"judged_cases,omitempty"`
+	Tokens      int     `json:"tokens"`
+}
+
+// Summarize aggregates scores for the named configuration.
+func Summarize(variant string, scores []Score) Summary {
+	sum := Summary{Variant: variant, Cases: len(scores)}
+	suggestions, answered := 0, 0
+	var length float64
+	for _, s := range scores {
+		sum.Tokens += s.Tokens
+		if s.Error != "" {
+			sum.Errors++
+		}
+		if s.Judge > 0 {
+			sum.Judge += s.Judge
+			sum.JudgedCases++
+		}
+		if len(s.Suggestions) == 0 {
+			continue
+		}
+		answered++
+		suggestions += len(s.Suggestions)
+		sum.Compliance += float64(s.Compliant)
+		sum.WithinLimit += float64(s.WithinLimit)
+		length += s.MeanLength * float64(len(s.Suggestions))
+		sum.Similarity += s.Similarity
+		sum.TopSimilarity += s.TopSimilarity
+	}
+	if suggestions > 0 {
+		sum.Compliance /= float64(suggestions)
+		sum.WithinLimit /= float64(suggestions)
+		sum.MeanLength = length / float64(suggestions)
+	}
+	if answered > 0 {
+		sum.Similarity /= float64(answered)
+		sum.TopSimilarity /= float64(answered)
+	}
+	if sum.JudgedCases > 0 {
+		sum.Judge /= float64(sum.JudgedCases)
+	}
+	return sum
+}
@@ -0,0 +1,95 @@
+package eval
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want float64
+	}{
+		{"fix: handle empty diff", "Fix: handle empty diff.", 1},
+		{"feat: add login", "docs: update readme", 0},
+		{"fix: handle empty diff", "fix: handle diff", 2 * 0.75 * 1 / 1.75},
+		{"", "fix: x", 0},
+	}
+	for _, c := range cases {
+		if got := Similarity(c.a, c.b); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestDatasetRoundTrip(t *testing.T) {
+	cases := []Case{
+		{ID: "abc", Paths: []string{"a.go"}, Diff: "+<x>", Message: "feat: add x\n\nbody"},
+		{ID: "def", Branch: "main", Paths: []string{"b.go"}, Diff: "-y", Message: "fix: drop y"},
+		{
+			ID:           "ghi",
+			Source:       "the commits in ghi",
+			Paths:        []string{"c.go", "d.go"},
+			Files:        []File{{Status: "renamed", Path: "d.go", OldPath: "c.go", Added: 2, Removed: 1}},
+			Declarations: []Declaration{{Path: "d.go", Status: "added", Kind: "func", Name: "Z", New: "func Z()"}},
+			Diff:         "+z",
+			Message:      "refactor: move z",
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteDataset(&buf, cases); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !strings.Contains(buf.String(), `+<x>`) {
+		t.Fatalf("expected unescaped HTML characters: %s", buf.String())
+	}
+	got, err := decodeDataset(strings.NewReader("# golden set\n\n"+buf.String()), "set.jsonl")
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, cases) {
+		t.Fatalf("round trip mismatch:\n%+v\n%+v", got, cases)
+	}
+	if got[0].Subject() != "feat: add x" {
+		t.Fatalf("unexpected subject %q", got[0].Subject())
+	}
+}
+
+func TestDatasetErrorsHaveLineNumbers(t *testing.T) {
+	_, err := decodeDataset(strings.NewReader(`{"message":"ok"}`+"\n{oops\n"), "set.jsonl")
+	if err == nil || !strings.HasPrefix(err.Error(), "set.jsonl:2:") {
+		t.Fatalf("expected line number in error, got %v", err)
+	}
+	_, err = decodeDataset(strings.NewReader(`{"diff":"+x"}`), "set.jsonl")
+	if err == nil || !strings.Contains(err.Error(), "no reference message") {
+		t.Fatalf("expected missing message error, got %v", err)
+	}
+}
+
+func TestScoreAndSummarize(t *testing.T) {
+	c := Case{ID: "1", Message: "fix: handle empty diff"}
+	conventional := func(s string) bool { return strings.Contains(s, ": ") }
+	s := ScoreSuggestions(c, []string{"update things", "fix: handle empty diff output"}, conventional, 20)
+	if s.Compliant != 1 || s.WithinLimit != 1 {
+		t.Fatalf("unexpected counts: %+v", s)
+	}
+	if s.TopSimilarity != 0 || s.Similarity <= 0.8 {
+		t.Fatalf("unexpected similarity: %+v", s)
+	}
+	if s.MeanLength != (13+29)/2.0 {
+		t.Fatalf("unexpected mean length %v", s.MeanLength)
+	}
+
+	s.Judge, s.Tokens = 4, 100
+	failed := Score{Case: "2", Error: "boom", Tokens: 10}
+	sum := Summarize("base", []Score{s, failed})
+	if sum.Cases != 2 || sum.Errors != 1 || sum.Tokens != 110 || sum.JudgedCases != 1 || sum.Judge != 4 {
+		t.Fatalf("unexpected summary: %+v", sum)
+	}
+	if sum.Compliance != 0.5 || sum.Similarity != s.Similarity {
+		t.Fatalf("failed cases should not dilute suggestion metrics: %+v", sum)
+	}
+}
@@ -0,0 +1,243 @@
+package format
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rogwilco/diffscribe/internal/lint"
+)
+
+// Preset is a named commit message format: the guidance inserted into the
+// prompt, a few examples for the model to imitate, and the rules used to
+// validate responses.
+type Preset struct {
+	Name        string
+	Description string
+	Guidance    string
+	Examples    []string
+
+	// Conventional enables Conventional Commit header parsing.
+	Conventional bool
+	// Pattern, when set, must match the subject line. Named groups "type",
+	// "scope" and "description" are checked like their Conventional
+	// counterparts.
+	Pattern *regexp.Regexp
+	Types   []string
+	Scopes  []string
+
+	Builtin bool
+}
+
+// Config is the shape of a custom preset in the formats config block.
+type Config struct {
+	Description string   `mapstructure:"description"`
+	Guidance    string   `mapstructure:"guidance"`
+	Pattern     string   `mapstructure:"pattern"`
+	Grammar     string   `mapstructure:"grammar"`
+	Types       []string `mapstructure:"types"`
+	Scopes      []string `mapstructure:"scopes"`
+	Examples    []string `mapstructure:"examples"`
+}
+
+var angularTypes = []string{"build", "ci", "docs", "feat", "fix", "perf", "refactor", "test"}
+
+var builtins = []Preset{
+	{
+		Name:        "conventional",
+		Description: "Conventional Commits: type(scope): description",
+		Guidance: `Conventional Commits: "type(scope): description". Use one of the allowed types,
+an optional lowercase scope naming the affected area, and "!" before the colon
+for breaking changes. Write the description in the imperative mood, starting
+with a lowercase letter.`,
+		Examples: []string{
+			"feat(auth): add password reset endpoint",
+			"fix: handle empty diff output",
+			"refactor(llm)!: replace provider interface",
+		},
+		Conventional: true,
+		Types:        lint.DefaultTypes,
+	},
+	{
+		Name:        "angular",
+		Description: "Angular convention: type(scope): subject with a fixed type list",
+		Guidance: `Angular commit convention: "type(scope): subject". The type must be one of
+build, ci, docs, feat, fix, perf, refactor or test. The scope names the
+affected package or module. The subject is imperative, lowercase and has no
+trailing period.`,
+		Examples: []string{
+			"feat(router): add lazy loading for feature modules",
+			"fix(forms): reset validation state on submit",
+			"docs(changelog): update release notes",
+		},
+		Conventional: true,
+		Types:        angularTypes,
+	},
+	{
+		Name:        "gitmoji",
+		Description: "gitmoji: :emoji: description",
+		Guidance: `gitmoji: start with a single gitmoji shortcode (e.g. :sparkles: for features,
+:bug: for fixes, :memo: for docs, :recycle: for refactors, :white_check_mark:
+for tests) followed by an imperative description.`,
+		Examples: []string{
+			":sparkles: add branch name suggestions",
+			":bug: fix crash on empty diff",
+			":memo: document lint rules",
+		},
+		Pattern: regexp.MustCompile(`^(?P<type>:[a-z0-9_+-]+:|[^\x00-\x7F]+) (?P<description>.+)$`),
+	},
+	{
+		Name:        "kernel",
+		Description: "Linux kernel style: subsystem: summary",
+		Guidance: `Linux kernel style: "subsystem: summary". The subsystem is the directory,
+package or driver being changed (nest with further "sub: " prefixes when
+useful). The summary is a short imperative sentence.`,
+		Examples: []string{
+			"net/ipv4: fix checksum offload on loopback",
+			"cmd: add branch subcommand",
+			"llm: openai: parse usage from responses",
+		},
+		Pattern: regexp.MustCompile(`^(?P<scope>[A-Za-z0-9_./-]+(?:: [A-Za-z0-9_./-]+)*): (?P<description>.+)$`),
+	},
+	{
+		Name:        "jira-prefixed",
+		Description: "Jira-prefixed: TICKET-123 summary",
+		Guidance: `Start with the Jira ticket key (for example ABC-123), taken from the branch
+name when it contains one, followed by a space and a capitalized imperative
+summary.`,
+		Examples: []string{
+			"ABC-123 Add password reset endpoint",
+			"OPS-42 Fix retry loop in deploy script",
+		},
+		Pattern: regexp.MustCompile(`^(?P<ticket>[A-Z][A-Z0-9]+-[0-9]+):? (?P<description>.+)$`),
+	},
+	{
+		Name:        "plain",
+		Description: "Plain imperative summary without prefixes",
+		Guidance: `A plain, capitalized summary in the imperative mood with no type, scope or
+ticket prefix.`,
+		Examples: []string{
+			"Add password reset endpoint",
+			"Handle empty diff output",
+		},
+	},
+}
+
+func init() {
+	for i := range builtins {
+		builtins[i].Builtin = true
+	}
+}
+
+// Builtins returns the presets shipped with diffscribe.
+func Builtins() []Preset {
+	out := make([]Preset, len(builtins))
+	copy(out, builtins)
+	return out
+}
+
+// All returns the built-in presets followed by the custom ones, sorted by
+// name. Custom presets replace built-ins with the same name.
+func All(custom map[string]Config) ([]Preset, error) {
+	byName := make(map[string]Preset)
+	for _, p := range builtins {
+		byName[p.Name] = p
+	}
+	for name, cfg := range custom {
+		p, err := FromConfig(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		byName[p.Name] = p
+	}
+
+	out := make([]Preset, 0, len(byName))
+	for _, p := range byName {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Builtin != out[j].Builtin {
+			return out[i].Builtin
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// Lookup finds a preset by name. When no preset matches, the value is
+// treated as a free-text description of the desired format, which is how the
+// format setting worked before presets existed.
+func Lookup(value string, custom map[string]Config) (Preset, error) {
+	name := strings.ToLower(strings.TrimSpace(value))
+	all, err := All(custom)
+	if err != nil {
+		return Preset{}, err
+	}
+	for _, p := range all {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Preset{
+		Name:         "custom",
+		Description:  value,
+		Guidance:     value,
+		Conventional: strings.Contains(name, "conventional"),
+	}, nil
+}
+
+// FromConfig builds a preset from its config block. A pattern takes
+// precedence over a grammar; with neither, only the generic lint rules apply.
+func FromConfig(name string, cfg Config) (Preset, error) {
+	p := Preset{
+		Name:        strings.ToLower(strings.TrimSpace(name)),
+		Description: cfg.Description,
+		Guidance:    cfg.Guidance,
+		Examples:    cfg.Examples,
+		Types:       cfg.Types,
+		Scopes:      cfg.Scopes,
+	}
+	if p.Guidance == "" {
+		p.Guidance = p.Description
+	}
+
+	switch {
+	case cfg.Pattern != "":
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return Preset{}, fmt.Errorf("format %s: invalid pattern: %w", name, err)
+		}
+		p.Pattern = re
+	case cfg.Grammar == "conventional":
+		p.Conventional = true
+	case cfg.Grammar != "":
+		re, err := CompileGrammar(cfg.Grammar)
+		if err != nil {
+			return Preset{}, fmt.Errorf("format %s: %w", name, err)
+		}
+		p.Pattern = re
+	}
+	return p, nil
+}
+
+// Rules returns the lint rules that describe this preset's header. Generic
+// settings such as lengths are left for the caller to fill in.
+func (p Preset) Rules() lint.Rules {
+	return lint.Rules{
+		Conventional: p.Conventional,
+		Pattern:      p.Pattern,
+		PatternName:  p.Name,
+		Types:        p.Types,
+		Scopes:       p.Scopes,
+	}
+}
+
+// Validate checks a single candidate against the preset's header rules.
+func (p Preset) Validate(candidate string) []string {
+	var problems []string
+	for _, v := range lint.LintSubject(candidate, p.Rules()) {
+		problems = append(problems, v.Message)
+	}
+	return problems
+}
@@ -0,0 +1,109 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltinsValidateExamples(t *testing.T) {
+	for _, p := range Builtins() {
+		if len(p.Examples) == 0 {
+			t.Fatalf("preset %s has no examples", p.Name)
+		}
+		for _, ex := range p.Examples {
+			if problems := p.Validate(ex); len(problems) > 0 {
+				t.Fatalf("preset %s rejects its own example %q: %v", p.Name, ex, problems)
+			}
+		}
+	}
+}
+
+func TestBuiltinsReject(t *testing.T) {
+	cases := map[string]string{
+		"conventional":  "Add login form",
+		"angular":       "chore: bump deps",
+		"gitmoji":       "feat: add login form",
+		"kernel":        "Add login form",
+		"jira-prefixed": "add login form",
+	}
+	for name, subject := range cases {
+		p, err := Lookup(name, nil)
+		if err != nil {
+			t.Fatalf("lookup %s: %v", name, err)
+		}
+		if len(p.Validate(subject)) == 0 {
+			t.Fatalf("preset %s accepted %q", name, subject)
+		}
+	}
+}
+
+func TestLookupFreeText(t *testing.T) {
+	p, err := Lookup("Conventional Commit style (prefix + summary)", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Name != "custom" || !p.Conventional || p.Guidance != "Conventional Commit style (prefix + summary)" {
+		t.Fatalf("unexpected free-text preset: %+v", p)
+	}
+}
+
+func TestLookupCustom(t *testing.T) {
+	custom := map[string]Config{
+		"team": {
+			Description: "Team style",
+			Grammar:     `\[<ticket>\] <type>: <summary>`,
+			Types:       []string{"add", "fix"},
+		},
+		"conventional": {Description: "overridden", Pattern: `^x: .+$`},
+	}
+	p, err := Lookup("team", custom)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if problems := p.Validate("[ABC-1] add: login form"); len(problems) > 0 {
+		t.Fatalf("expected valid subject, got %v", problems)
+	}
+	if problems := p.Validate("[ABC-1] feat: login form"); len(problems) != 1 || !strings.Contains(problems[0], "type") {
+		t.Fatalf("expected type violation, got %v", problems)
+	}
+
+	all, err := All(custom)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, p := range all {
+		if p.Name == "conventional" && p.Builtin {
+			t.Fatalf("expected custom preset to replace built-in conventional")
+		}
+	}
+	if last := all[len(all)-1]; last.Name != "team" {
+		t.Fatalf("expected custom presets after built-ins, got %s last", last.Name)
+	}
+}
+
+func TestFromConfigErrors(t *testing.T) {
+	if _, err := FromConfig("bad", Config{Pattern: "("}); err == nil {
+		t.Fatalf("expected invalid pattern error")
+	}
+	if _, err := FromConfig("bad", Config{Grammar: "<type"}); err == nil {
+		t.Fatalf("expected grammar error")
+	}
+}
+
+func TestCompileGrammar(t *testing.T) {
+	re, err := CompileGrammar("<type>[(<scope>)][!]: <description>")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, ok := range []string{"feat: add x", "feat(cli)!: add x"} {
+		if !re.MatchString(ok) {
+			t.Fatalf("expected %q to match %s", ok, re)
+		}
+	}
+	if re.MatchString("feat add x") {
+		t.Fatalf("expected missing colon to fail")
+	}
+	if _, err := CompileGrammar("<type>]"); err == nil {
+		t.Fatalf("expected unbalanced bracket error")
+	}
+}
@@ -0,0 +1,91 @@
+package format
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// placeholderPatterns maps grammar placeholders to the text they accept.
+// Unknown placeholders match a single word.
+var placeholderPatterns = map[string]string{
+	"type":        `[A-Za-z]+`,
+	"scope":       `[^()\r\n]+`,
+	"ticket":      `[A-Z][A-Z0-9]+-[0-9]+`,
+	"emoji":       `:[a-z0-9_+-]+:|[^\x00-\x7F]+`,
+	"subsystem":   `[A-Za-z0-9_./-]+`,
+	"description": `.+`,
+	"summary":     `.+`,
+}
+
+var placeholderName = regexp.MustCompile(`^[a-z_]+$`)
+
+// CompileGrammar turns a small header grammar into an anchored regular
+// expression. Placeholders are written as <name>, optional parts are wrapped
+// in [brackets], a backslash escapes the next character, and everything else
+// is matched literally, e.g.
+//
+//	<type>[(<scope>)][!]: <description>
+//	\[<ticket>\] <summary>
+//
+// Placeholders become named groups, so "type", "scope" and "description" take
+// part in type, scope and mood checks.
+func CompileGrammar(grammar string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	depth := 0
+	seen := make(map[string]bool)
+	for i := 0; i < len(grammar); i++ {
+		switch c := grammar[i]; c {
+		case '<':
+			end := strings.IndexByte(grammar[i:], '>')
+			if end < 0 {
+				return nil, fmt.Errorf("grammar: unterminated placeholder at offset %d", i)
+			}
+			name := grammar[i+1 : i+end]
+			if !placeholderName.MatchString(name) {
+				return nil, fmt.Errorf("grammar: invalid placeholder <%s>", name)
+			}
+			pattern, ok := placeholderPatterns[name]
+			if !ok {
+				pattern = `[^\s:()\[\]]+`
+			}
+			if name == "summary" {
+				name = "description"
+			}
+			if seen[name] {
+				fmt.Fprintf(&b, "(?:%s)", pattern)
+			} else {
+				fmt.Fprintf(&b, "(?P<%s>%s)", name, pattern)
+				seen[name] = true
+			}
+			i += end
+		case '\\':
+			if i+1 == len(grammar) {
+				return nil, fmt.Errorf("grammar: trailing backslash")
+			}
+			r, size := utf8.DecodeRuneInString(grammar[i+1:])
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			i += size
+		case '[':
+			b.WriteString("(?:")
+			depth++
+		case ']':
+			if depth == 0 {
+				return nil, fmt.Errorf("grammar: unbalanced ] at offset %d", i)
+			}
+			b.WriteString(")?")
+			depth--
+		default:
+			r, size := utf8.DecodeRuneInString(grammar[i:])
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			i += size - 1
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("grammar: unbalanced [")
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,272 @@
+package gitrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// emptyTree is the object name of the empty tree.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// execCollector runs git in dir.
+type execCollector struct {
+	dir string
+}
+
+func openExec(ctx context.Context, dir string) (Collector, error) {
+	g := &execCollector{dir: dir}
+	if _, err := g.git(ctx, "rev-parse", "--git-dir"); err != nil {
+		if strings.Contains(err.Error(), "not a git repository") {
+			return nil, ErrNotRepository
+		}
+		return nil, err
+	}
+	return g, nil
+}
+
+// git runs a git command and returns its output. Failures include git's
+// stderr; running out of time wraps the context's error.
+func (g *execCollector) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	var out, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("git %s: %w", args[0], ctx.Err())
+		}
+		var exitErr *exec.ExitError
+		if msg := strings.TrimSpace(stderr.String()); errors.As(err, &exitErr) && msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out.String(), nil
+}
+
+// change runs args with --raw (--name-status with modes and object ids),
+// --numstat and a patch, followed by tail (revisions and pathspecs).
+func (g *execCollector) change(ctx context.Context, args []string, tail ...string) (Change, error) {
+	with := func(flags ...string) []string {
+		return append(append(append([]string{}, args...), flags...), tail...)
+	}
+	raw, err := g.git(ctx, with("--raw", "--no-abbrev", "-M", "-C", "-z")...)
+	if err != nil {
+		return Change{}, err
+	}
+	numstat, err := g.git(ctx, with("--numstat", "-M", "-C", "-z")...)
+	if err != nil {
+		return Change{}, err
+	}
+	diff, err := g.git(ctx, with("--patch", "--unified=0")...)
+	if err != nil {
+		return Change{}, err
+	}
+	files, blobs, err := parseRaw(raw)
+	if err != nil {
+		return Change{}, err
+	}
+	if err := addNumstat(files, numstat); err != nil {
+		return Change{}, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return Change{Paths: filePaths(files), Files: files, Diff: diff, contents: g.contents(blobs)}, nil
+}
+
+// blobPair holds the object ids of both sides of a file change: empty where
+// the file does not exist or is a submodule, and all zeros for a file only
+// in the work tree.
+type blobPair [2]string
+
+// contents reads file versions by the object ids recorded for them, keyed
+// by path.
+func (g *execCollector) contents(blobs map[string]blobPair) func(context.Context, FileChange) ([]byte, []byte, error) {
+	return func(ctx context.Context, f FileChange) (before, after []byte, err error) {
+		ids, ok := blobs[f.Path]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s is not part of the change", f.Path)
+		}
+		if before, err = g.blob(ctx, ids[0], f.Path); err != nil {
+			return nil, nil, err
+		}
+		if after, err = g.blob(ctx, ids[1], f.Path); err != nil {
+			return nil, nil, err
+		}
+		return before, after, nil
+	}
+}
+
+// blob reads an object, or the work tree file at path for an all-zero id.
+func (g *execCollector) blob(ctx context.Context, oid, path string) ([]byte, error) {
+	if oid == "" {
+		return nil, nil
+	}
+	if strings.Trim(oid, "0") != "" {
+		out, err := g.git(ctx, "cat-file", "blob", oid)
+		return []byte(out), err
+	}
+	top, err := g.git(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(strings.TrimSpace(top), filepath.FromSlash(path)))
+}
+
+var rawStatuses = map[byte]string{
+	'A': StatusAdded,
+	'M': StatusModified,
+	'D': StatusDeleted,
+	'R': StatusRenamed,
+	'C': StatusCopied,
+	'T': StatusTypeChanged,
+	'U': StatusUnmerged,
+}
+
+// parseRaw parses git diff --raw -z output:
+// ":<old mode> <new mode> <old oid> <new oid> <status>\0<path>\0", with a
+// second path for renames and copies. The object ids are returned by path.
+func parseRaw(out string) ([]FileChange, map[string]blobPair, error) {
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	var files []FileChange
+	blobs := map[string]blobPair{}
+	for i := 0; i < len(fields); {
+		if fields[i] == "" {
+			i++
+			continue
+		}
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 || meta[4] == "" || i+1 >= len(fields) {
+			return nil, nil, fmt.Errorf("unexpected git diff --raw output %q", fields[i])
+		}
+		f := FileChange{Status: rawStatuses[meta[4][0]], Path: fields[i+1]}
+		if f.Status == "" {
+			f.Status = StatusModified
+		}
+		i += 2
+		if f.Status == StatusRenamed || f.Status == StatusCopied {
+			if i >= len(fields) {
+				return nil, nil, fmt.Errorf("unexpected git diff --raw output: missing path after %q", f.Path)
+			}
+			f.OldPath, f.Path = f.Path, fields[i]
+			i++
+		}
+		if oldMode, newMode := meta[0], meta[1]; oldMode != newMode && oldMode != "000000" && newMode != "000000" {
+			f.OldMode, f.NewMode = oldMode, newMode
+		}
+		var ids blobPair
+		for side, mode := range meta[:2] {
+			if mode != "000000" && mode != "160000" {
+				ids[side] = meta[2+side]
+			}
+		}
+		blobs[f.Path] = ids
+		files = append(files, f)
+	}
+	return files, blobs, nil
+}
+
+// addNumstat fills in line counts and binary flags from git diff --numstat
+// -z output: "<added>\t<removed>\t<path>\0", or for renames and copies
+// "<added>\t<removed>\t\0<old path>\0<new path>\0". Binary files count "-".
+func addNumstat(files []FileChange, out string) error {
+	byPath := map[string]*FileChange{}
+	for i := range files {
+		byPath[files[i].Path] = &files[i]
+	}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(fields); {
+		if fields[i] == "" {
+			i++
+			continue
+		}
+		counts := strings.SplitN(fields[i], "\t", 3)
+		if len(counts) != 3 {
+			return fmt.Errorf("unexpected git diff --numstat output %q", fields[i])
+		}
+		path := counts[2]
+		i++
+		if path == "" {
+			if i+1 >= len(fields) {
+				return fmt.Errorf("unexpected git diff --numstat output: missing rename paths")
+			}
+			path = fields[i+1]
+			i += 2
+		}
+		f := byPath[path]
+		if f == nil {
+			continue
+		}
+		if counts[0] == "-" {
+			f.Binary = true
+			continue
+		}
+		f.Added, _ = strconv.Atoi(counts[0])
+		f.Removed, _ = strconv.Atoi(counts[1])
+	}
+	return nil
+}
+
+func (g *execCollector) Branch(ctx context.Context) (string, error) {
+	out, err := g.git(ctx, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		// Detached HEAD.
+		return "HEAD", nil
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (g *execCollector) Staged(ctx context.Context, pathspecs ...string) (Change, error) {
+	return g.change(ctx, []string{"diff", "--cached"}, append([]string{"--"}, pathspecs...)...)
+}
+
+func (g *execCollector) Unstaged(ctx context.Context, pathspecs ...string) (Change, error) {
+	return g.change(ctx, []string{"diff"}, append([]string{"--"}, pathspecs...)...)
+}
+
+func (g *execCollector) All(ctx context.Context, pathspecs ...string) (Change, error) {
+	base := "HEAD"
+	if _, err := g.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		if ctx.Err() != nil {
+			return Change{}, err
+		}
+		// Nothing is committed yet.
+		base = emptyTree
+	}
+	return g.change(ctx, []string{"diff"}, append([]string{base, "--"}, pathspecs...)...)
+}
+
+func (g *execCollector) Stash(ctx context.Context, oid string) (Change, error) {
+	return g.change(ctx, []string{"stash", "show", "--include-untracked"}, oid)
+}
+
+func (g *execCollector) Range(ctx context.Context, rng string) (Change, error) {
+	if strings.HasPrefix(rng, "-") {
+		return Change{}, fmt.Errorf("invalid revision range %q", rng)
+	}
+	if strings.Contains(rng, "..") {
+		return g.change(ctx, []string{"diff"}, rng, "--")
+	}
+	// A root commit has no parent for rng^! to exclude; compare it with the
+	// empty tree instead.
+	if _, err := g.git(ctx, "rev-parse", "--verify", "--quiet", rng+"^{commit}"); err != nil {
+		return Change{}, fmt.Errorf("unknown revision %q", rng)
+	}
+	if _, err := g.git(ctx, "rev-parse", "--verify", "--quiet", rng+"^"); err != nil {
+		if ctx.Err() != nil {
+			return Change{}, err
+		}
+		return g.change(ctx, []string{"diff"}, emptyTree, rng, "--")
+	}
+	return g.change(ctx, []string{"diff"}, rng+"^!", "--")
+}
@@ -0,0 +1,127 @@
+// Package gitrepo reads the changes diffscribe describes from a git
+// repository, either by running git (the exec backend) or in-process with
+// go-git.
+package gitrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Backend names.
+const (
+	BackendExec  = "exec"
+	BackendGoGit = "go-git"
+)
+
+// Backends lists the available backends.
+var Backends = []string{BackendExec, BackendGoGit}
+
+// ErrNotRepository is returned when the directory is not inside a git
+// repository.
+var ErrNotRepository = errors.New("not a git repository")
+
+// Change is a set of changed paths and their diff without context lines,
+// like git diff --unified=0.
+type Change struct {
+	// Paths lists every path touched, including both sides of a rename.
+	Paths []string
+	Files []FileChange
+	Diff  string
+
+	// contents loads both versions of a file in Files.
+	contents func(ctx context.Context, f FileChange) (before, after []byte, err error)
+}
+
+// Contents returns the content of f, one of the change's Files, before and
+// after the change. A side on which the file does not exist is nil, as are
+// both sides of binary and unmerged files.
+func (c Change) Contents(ctx context.Context, f FileChange) (before, after []byte, err error) {
+	if c.contents == nil || f.Binary || f.Status == StatusUnmerged {
+		return nil, nil, nil
+	}
+	return c.contents(ctx, f)
+}
+
+// File statuses.
+const (
+	StatusAdded       = "added"
+	StatusModified    = "modified"
+	StatusDeleted     = "deleted"
+	StatusRenamed     = "renamed"
+	StatusCopied      = "copied"
+	StatusTypeChanged = "type-changed"
+	StatusUnmerged    = "unmerged"
+)
+
+// FileChange describes how one file changed, like a line of git diff
+// --name-status combined with --numstat.
+type FileChange struct {
+	Status string
+	Path   string
+	// OldPath is the source of a rename or copy.
+	OldPath string
+	// Added and Removed count lines; both are zero for binary files.
+	Added   int
+	Removed int
+	Binary  bool
+	// OldMode and NewMode are set, in octal, when the mode changed.
+	OldMode string
+	NewMode string
+}
+
+// Collector reads changes from a repository. Every method honors the
+// context's deadline. Pathspecs limit the paths considered and, as in git,
+// are relative to the directory the collector was opened for.
+type Collector interface {
+	// Branch returns the current branch name, or HEAD when detached.
+	Branch(ctx context.Context) (string, error)
+	// Staged returns the changes between HEAD and the index.
+	Staged(ctx context.Context, pathspecs ...string) (Change, error)
+	// Unstaged returns the changes between the index and the work tree.
+	Unstaged(ctx context.Context, pathspecs ...string) (Change, error)
+	// All returns the changes between HEAD and the work tree in tracked
+	// files, as git commit -a would commit them.
+	All(ctx context.Context, pathspecs ...string) (Change, error)
+	// Stash returns the changes recorded in a stash commit, including
+	// untracked files.
+	Stash(ctx context.Context, oid string) (Change, error)
+	// Range returns the changes in a revision range such as main..HEAD or
+	// main...HEAD, or those made by a single commit.
+	Range(ctx context.Context, rng string) (Change, error)
+}
+
+// Open returns a collector for the repository containing dir (the working
+// directory when empty). It returns ErrNotRepository when there is none.
+func Open(ctx context.Context, backend, dir string) (Collector, error) {
+	switch backend {
+	case "", BackendExec:
+		return openExec(ctx, dir)
+	case BackendGoGit:
+		return openGoGit(dir)
+	}
+	return nil, fmt.Errorf("unknown git backend %q (want exec or go-git)", backend)
+}
+
+// filePaths returns the sorted paths touched by files.
+func filePaths(files []FileChange) []string {
+	set := map[string]struct{}{}
+	for _, f := range files {
+		set[f.Path] = struct{}{}
+		if f.Status == StatusRenamed {
+			set[f.OldPath] = struct{}{}
+		}
+	}
+	return sortedPaths(set)
+}
+
+func sortedPaths(set map[string]struct{}) []string {
+	paths := make([]string, 0, len(set))
+	for p := range set {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,368 @@
+package gitrepo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitCommand prepares git in dir with a fixed identity and no user
+// configuration.
+func gitCommand(dir string, args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+		"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+	return cmd
+}
+
+// runGit runs git in dir and fails the test if it fails.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := gitCommand(dir, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// fixture creates a repository with two commits, a staged change and an
+// unstaged one.
+func fixture(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) { runGit(t, dir, args...) }
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q", "-b", "main")
+	write("a.txt", "one\ntwo\n")
+	write("gone.txt", "bye\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	write("a.txt", "one\ntwo\nthree\n")
+	git("rm", "-q", "gone.txt")
+	git("commit", "-q", "-am", "second")
+
+	write("b.txt", "new\n")
+	git("add", "b.txt")
+	write("a.txt", "zero\none\ntwo\nthree\n")
+	// Keep the index stat data from matching so the unstaged change is
+	// noticed even within the file system's timestamp granularity.
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func collectors(t *testing.T, dir string) map[string]Collector {
+	t.Helper()
+	all := map[string]Collector{}
+	for _, backend := range Backends {
+		c, err := Open(context.Background(), backend, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		all[backend] = c
+	}
+	return all
+}
+
+func assertChange(t *testing.T, backend string, got Change, paths []string, lines ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(got.Paths, paths) {
+		t.Errorf("%s: paths = %v, want %v", backend, got.Paths, paths)
+	}
+	for _, line := range lines {
+		if !strings.Contains(got.Diff, line+"\n") {
+			t.Errorf("%s: diff missing %q:\n%s", backend, line, got.Diff)
+		}
+	}
+}
+
+func TestCollectors(t *testing.T) {
+	dir := fixture(t)
+	ctx := context.Background()
+	for backend, c := range collectors(t, dir) {
+		branch, err := c.Branch(ctx)
+		if err != nil || branch != "main" {
+			t.Errorf("%s: branch = %q (%v)", backend, branch, err)
+		}
+
+		staged, err := c.Staged(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, staged, []string{"b.txt"}, "+++ b/b.txt", "+new")
+
+		unstaged, err := c.Unstaged(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, unstaged, []string{"a.txt"}, "+zero")
+		if strings.Contains(unstaged.Diff, " one") {
+			t.Errorf("%s: diff has context lines:\n%s", backend, unstaged.Diff)
+		}
+
+		all, err := c.All(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, all, []string{"a.txt", "b.txt"}, "+zero", "+new")
+
+		limited, err := c.All(ctx, "b.txt")
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, limited, []string{"b.txt"}, "+new")
+
+		none, err := c.Staged(ctx, "a.txt")
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, none, []string{})
+
+		commit, err := c.Range(ctx, "HEAD")
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, commit, []string{"a.txt", "gone.txt"}, "+three", "-bye")
+
+		rng, err := c.Range(ctx, "HEAD~1..HEAD")
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		if !reflect.DeepEqual(rng.Paths, commit.Paths) {
+			t.Errorf("%s: range paths = %v, want %v", backend, rng.Paths, commit.Paths)
+		}
+
+		root, err := c.Range(ctx, "HEAD~1")
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, root, []string{"a.txt", "gone.txt"}, "+one", "+bye")
+
+		if _, err := c.Range(ctx, "nope"); err == nil {
+			t.Errorf("%s: expected an error for an unknown revision", backend)
+		}
+	}
+}
+
+func TestFileMetadata(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	write := func(name, content string, mode os.FileMode) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, dir, "init", "-q", "-b", "main")
+	write("f.txt", "a\nb\nc\n", 0o644)
+	write("run.sh", "echo hi\n", 0o644)
+	write("logo.bin", "\x00\x01", 0o644)
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+
+	runGit(t, dir, "mv", "f.txt", "g.txt")
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write("logo.bin", "\x00\x02", 0o644)
+	write("new.txt", "one\ntwo\n", 0o644)
+	runGit(t, dir, "add", "-A")
+
+	want := []FileChange{
+		{Status: StatusRenamed, Path: "g.txt", OldPath: "f.txt"},
+		{Status: StatusModified, Path: "logo.bin", Binary: true},
+		{Status: StatusAdded, Path: "new.txt", Added: 2},
+		{Status: StatusModified, Path: "run.sh", OldMode: "100644", NewMode: "100755"},
+	}
+	ctx := context.Background()
+	for backend, c := range collectors(t, dir) {
+		got, err := c.Staged(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		if !reflect.DeepEqual(got.Files, want) {
+			t.Errorf("%s: files = %+v\nwant %+v", backend, got.Files, want)
+		}
+		if paths := []string{"f.txt", "g.txt", "logo.bin", "new.txt", "run.sh"}; !reflect.DeepEqual(got.Paths, paths) {
+			t.Errorf("%s: paths = %v, want %v", backend, got.Paths, paths)
+		}
+	}
+}
+
+func TestUnmerged(t *testing.T) {
+	dir := fixture(t)
+	git := func(args ...string) { runGit(t, dir, args...) }
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("commit", "-q", "-am", "third")
+	git("checkout", "-q", "-b", "side")
+	write("a.txt", "side\n")
+	git("commit", "-q", "-am", "side")
+	git("checkout", "-q", "main")
+	write("a.txt", "main\n")
+	git("commit", "-q", "-am", "main")
+	if err := gitCommand(dir, "merge", "-q", "side").Run(); err == nil {
+		t.Fatal("expected the merge to conflict")
+	}
+	write("b.txt", "merged\n")
+	git("add", "b.txt")
+
+	ctx := context.Background()
+	for backend, c := range collectors(t, dir) {
+		staged, err := c.Staged(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		want := []FileChange{
+			{Status: StatusUnmerged, Path: "a.txt"},
+			{Status: StatusModified, Path: "b.txt", Added: 1, Removed: 1},
+		}
+		if !reflect.DeepEqual(staged.Files, want) {
+			t.Errorf("%s: staged files = %+v\nwant %+v", backend, staged.Files, want)
+		}
+		assertChange(t, backend, staged, []string{"a.txt", "b.txt"}, "+merged")
+
+		// As with git diff HEAD, the conflicted file is compared as it is
+		// in the work tree, conflict markers and all.
+		all, err := c.All(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		want[0] = FileChange{Status: StatusModified, Path: "a.txt", Added: 4}
+		if !reflect.DeepEqual(all.Files, want) {
+			t.Errorf("%s: all files = %+v\nwant %+v", backend, all.Files, want)
+		}
+		assertChange(t, backend, all, []string{"a.txt", "b.txt"}, "+side", "+merged")
+	}
+}
+
+func TestContents(t *testing.T) {
+	dir := fixture(t)
+	ctx := context.Background()
+	for backend, c := range collectors(t, dir) {
+		cases := []struct {
+			name          string
+			collect       func() (Change, error)
+			before, after string
+			absent        string
+		}{
+			{"staged", func() (Change, error) { return c.Staged(ctx) }, "", "new\n", "before"},
+			{"unstaged", func() (Change, error) { return c.Unstaged(ctx) }, "one\ntwo\nthree\n", "zero\none\ntwo\nthree\n", ""},
+			{"deleted", func() (Change, error) { return c.Range(ctx, "HEAD") }, "bye\n", "", "after"},
+		}
+		for _, tc := range cases {
+			change, err := tc.collect()
+			if err != nil {
+				t.Fatalf("%s: %v", backend, err)
+			}
+			f := change.Files[len(change.Files)-1]
+			before, after, err := change.Contents(ctx, f)
+			if err != nil {
+				t.Fatalf("%s %s: %v", backend, tc.name, err)
+			}
+			if string(before) != tc.before || string(after) != tc.after {
+				t.Errorf("%s %s: contents of %s = %q, %q; want %q, %q", backend, tc.name, f.Path, before, after, tc.before, tc.after)
+			}
+			if (tc.absent == "before") != (before == nil) || (tc.absent == "after") != (after == nil) {
+				t.Errorf("%s %s: want only the %q side missing, got %v, %v", backend, tc.name, tc.absent, before == nil, after == nil)
+			}
+		}
+	}
+}
+
+func TestStash(t *testing.T) {
+	dir := fixture(t)
+	if err := os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("u\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "stash", "push", "-q", "--include-untracked")
+	oid := runGit(t, dir, "rev-parse", "stash@{0}")
+	ctx := context.Background()
+	for backend, c := range collectors(t, dir) {
+		got, err := c.Stash(ctx, oid)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, got, []string{"a.txt", "b.txt", "untracked.txt"}, "+zero", "+new", "+u")
+	}
+}
+
+func TestGitDirEnvironment(t *testing.T) {
+	work := fixture(t)
+	gitDir := filepath.Join(t.TempDir(), "repo.git")
+	if err := os.Rename(filepath.Join(work, ".git"), gitDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_DIR", gitDir)
+	t.Setenv("GIT_WORK_TREE", work)
+	elsewhere := t.TempDir()
+	ctx := context.Background()
+	for backend, c := range collectors(t, elsewhere) {
+		staged, err := c.Staged(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, staged, []string{"b.txt"}, "+new")
+		unstaged, err := c.Unstaged(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		assertChange(t, backend, unstaged, []string{"a.txt"}, "+zero")
+	}
+}
+
+func TestNotRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	for _, backend := range Backends {
+		if _, err := Open(context.Background(), backend, dir); !errors.Is(err, ErrNotRepository) {
+			t.Errorf("%s: expected ErrNotRepository, got %v", backend, err)
+		}
+	}
+	if _, err := Open(context.Background(), "svn", dir); err == nil {
+		t.Errorf("expected an error for an unknown backend")
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	dir := fixture(t)
+	c, err := Open(context.Background(), BackendExec, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if _, err := c.Staged(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,804 @@
+package gitrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+	utildiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// mergedStage is the stage of an index entry without conflicts. go-git's
+// index.Merged constant shares its value with index.AncestorMode, while
+// decoded entries use git's 0.
+const mergedStage index.Stage = 0
+
+// binaryProbe is how much of a file is searched for a NUL byte to decide
+// whether it is binary, as git does.
+const binaryProbe = 8000
+
+// goGitCollector reads the repository in-process.
+type goGitCollector struct {
+	repo *git.Repository
+	// prefix is the opened directory relative to the top of the work tree,
+	// which pathspecs are relative to.
+	prefix string
+}
+
+// openGoGit opens the repository containing dir. Like git, it uses $GIT_DIR
+// and $GIT_WORK_TREE when set; a $GIT_DIR without $GIT_WORK_TREE has dir as
+// its work tree.
+func openGoGit(dir string) (Collector, error) {
+	if dir == "" {
+		dir = "."
+	}
+	gitDir, workTree := os.Getenv("GIT_DIR"), os.Getenv("GIT_WORK_TREE")
+	if gitDir == "" {
+		repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+		if errors.Is(err, git.ErrRepositoryNotExists) {
+			return nil, ErrNotRepository
+		}
+		if err != nil {
+			return nil, err
+		}
+		if workTree == "" {
+			return newGoGitCollector(repo, dir), nil
+		}
+		repo, err = git.Open(repo.Storer, osfs.New(resolve(dir, workTree)))
+		if err != nil {
+			return nil, err
+		}
+		return newGoGitCollector(repo, dir), nil
+	}
+
+	gitDir = resolve(dir, gitDir)
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); err != nil {
+		return nil, ErrNotRepository
+	}
+	if workTree == "" {
+		workTree = dir
+	}
+	fs, err := dotGitFilesystem(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := git.Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), osfs.New(resolve(dir, workTree)))
+	if err != nil {
+		return nil, err
+	}
+	return newGoGitCollector(repo, dir), nil
+}
+
+func newGoGitCollector(repo *git.Repository, dir string) *goGitCollector {
+	g := &goGitCollector{repo: repo}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return g
+	}
+	top, cwd := wt.Filesystem.Root(), resolve(dir, ".")
+	if resolved, err := filepath.EvalSymlinks(top); err == nil {
+		top = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(cwd); err == nil {
+		cwd = resolved
+	}
+	if rel, err := filepath.Rel(top, cwd); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		g.prefix = filepath.ToSlash(rel)
+	}
+	return g
+}
+
+// dotGitFilesystem opens a git directory, joining a linked worktree's
+// private directory with the common one it names.
+func dotGitFilesystem(gitDir string) (billy.Filesystem, error) {
+	fs := osfs.New(gitDir)
+	b, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if errors.Is(err, os.ErrNotExist) {
+		return fs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dotgit.NewRepositoryFilesystem(fs, osfs.New(resolve(gitDir, strings.TrimSpace(string(b))))), nil
+}
+
+// resolve makes path absolute relative to dir.
+func resolve(dir, path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func (g *goGitCollector) Branch(ctx context.Context) (string, error) {
+	ref, err := g.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+	if ref.Type() == plumbing.SymbolicReference {
+		return ref.Target().Short(), nil
+	}
+	return "HEAD", nil
+}
+
+// index reads $GIT_INDEX_FILE when git set one, as it does for hooks and
+// the editor during git commit -a, and the repository's index otherwise.
+func (g *goGitCollector) index() (*index.Index, error) {
+	path := os.Getenv("GIT_INDEX_FILE")
+	if path == "" {
+		return g.repo.Storer.Index()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx := &index.Index{}
+	if err := index.NewDecoder(f).Decode(idx); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return idx, nil
+}
+
+// headFiles maps the paths in HEAD's tree to their blobs. An unborn branch
+// has none.
+func (g *goGitCollector) headFiles() (map[string]*file, error) {
+	files := map[string]*file{}
+	head, err := g.repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	commit, err := g.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files[f.Name] = &file{path: f.Name, hash: f.Hash, mode: f.Mode}
+		return nil
+	})
+	return files, err
+}
+
+func (g *goGitCollector) Staged(ctx context.Context, pathspecs ...string) (Change, error) {
+	idx, err := g.index()
+	if err != nil {
+		return Change{}, err
+	}
+	head, err := g.headFiles()
+	if err != nil {
+		return Change{}, err
+	}
+
+	match := newPathspec(g.prefix, pathspecs)
+	var b changeBuilder
+	staged := map[string]bool{}
+	for _, e := range idx.Entries {
+		if err := ctx.Err(); err != nil {
+			return Change{}, err
+		}
+		if !match.matches(e.Name) {
+			continue
+		}
+		staged[e.Name] = true
+		if e.Stage != mergedStage {
+			// Unmerged paths are listed without a diff, like git.
+			b.unmerged(e.Name)
+			continue
+		}
+		to := indexFile(e)
+		if err := g.addChange(&b, head[e.Name], to, g.blob(to)); err != nil {
+			return Change{}, err
+		}
+	}
+	if err := g.addDeletions(&b, head, staged, match); err != nil {
+		return Change{}, err
+	}
+	return b.change()
+}
+
+func (g *goGitCollector) Unstaged(ctx context.Context, pathspecs ...string) (Change, error) {
+	wt, err := g.repo.Worktree()
+	if err != nil {
+		return Change{}, err
+	}
+	idx, err := g.index()
+	if err != nil {
+		return Change{}, err
+	}
+
+	match := newPathspec(g.prefix, pathspecs)
+	var b changeBuilder
+	for _, e := range idx.Entries {
+		if err := ctx.Err(); err != nil {
+			return Change{}, err
+		}
+		if e.Stage != mergedStage || !match.matches(e.Name) {
+			continue
+		}
+		to, load, err := g.worktreeFile(wt.Filesystem, e)
+		if err != nil {
+			return Change{}, err
+		}
+		from := indexFile(e)
+		if err := g.addChange(&b, from, to, load); err != nil {
+			return Change{}, err
+		}
+	}
+	return b.change()
+}
+
+func (g *goGitCollector) All(ctx context.Context, pathspecs ...string) (Change, error) {
+	wt, err := g.repo.Worktree()
+	if err != nil {
+		return Change{}, err
+	}
+	idx, err := g.index()
+	if err != nil {
+		return Change{}, err
+	}
+	head, err := g.headFiles()
+	if err != nil {
+		return Change{}, err
+	}
+
+	match := newPathspec(g.prefix, pathspecs)
+	var b changeBuilder
+	tracked := map[string]bool{}
+	for _, e := range idx.Entries {
+		if err := ctx.Err(); err != nil {
+			return Change{}, err
+		}
+		if !match.matches(e.Name) {
+			continue
+		}
+		if tracked[e.Name] {
+			// A later stage of a conflicted path.
+			continue
+		}
+		tracked[e.Name] = true
+		// Like git diff HEAD, a conflicted path is compared as the file in
+		// the work tree; its stage entries carry no stat data, so it is read.
+		to, load, err := g.worktreeFile(wt.Filesystem, e)
+		if err != nil {
+			return Change{}, err
+		}
+		if err := g.addChange(&b, head[e.Name], to, load); err != nil {
+			return Change{}, err
+		}
+	}
+	if err := g.addDeletions(&b, head, tracked, match); err != nil {
+		return Change{}, err
+	}
+	return b.change()
+}
+
+// addChange adds the change from one version of a file to another unless
+// they are the same. Either may be nil for additions and deletions.
+func (g *goGitCollector) addChange(b *changeBuilder, from, to *file, loadTo func() ([]byte, error)) error {
+	if from != nil && to != nil && from.hash == to.hash && from.mode == to.mode {
+		return nil
+	}
+	if from == nil && to == nil {
+		return nil
+	}
+	return b.add(from, to, g.blob(from), loadTo)
+}
+
+// addDeletions adds the matching files in head that are not in kept.
+func (g *goGitCollector) addDeletions(b *changeBuilder, head map[string]*file, kept map[string]bool, match pathspec) error {
+	for name, from := range head {
+		if kept[name] || !match.matches(name) {
+			continue
+		}
+		if err := b.add(from, nil, g.blob(from), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexFile(e *index.Entry) *file {
+	return &file{path: e.Name, hash: e.Hash, mode: e.Mode}
+}
+
+// worktreeFile returns the work tree's version of an index entry and a
+// loader for its content, or nil when the file was deleted.
+func (g *goGitCollector) worktreeFile(fs billy.Filesystem, e *index.Entry) (*file, func() ([]byte, error), error) {
+	staged := indexFile(e)
+	if e.Mode == filemode.Submodule {
+		return staged, g.blob(staged), nil
+	}
+	info, err := fs.Lstat(e.Name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// Unchanged size and modification time mean an unchanged file, as in
+	// git's own stat check.
+	if int64(e.Size) == info.Size() && e.ModifiedAt.Equal(info.ModTime()) {
+		return staged, g.blob(staged), nil
+	}
+	content, mode, err := readWorktreeFile(fs, e.Name, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := &file{path: e.Name, hash: plumbing.ComputeHash(plumbing.BlobObject, content), mode: mode}
+	return f, func() ([]byte, error) { return content, nil }, nil
+}
+
+func readWorktreeFile(fs billy.Filesystem, name string, info os.FileInfo) ([]byte, filemode.FileMode, error) {
+	mode, err := filemode.NewFromOSFileMode(info.Mode())
+	if err != nil {
+		return nil, 0, err
+	}
+	if mode == filemode.Symlink {
+		sl, ok := fs.(billy.Symlink)
+		if !ok {
+			return nil, 0, fmt.Errorf("cannot read symlink %s", name)
+		}
+		target, err := sl.Readlink(name)
+		return []byte(target), mode, err
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	return content, mode, err
+}
+
+func (g *goGitCollector) Stash(ctx context.Context, oid string) (Change, error) {
+	stash, err := g.commit(oid)
+	if err != nil {
+		return Change{}, err
+	}
+	base, err := stash.Parent(0)
+	if err != nil {
+		return Change{}, fmt.Errorf("%s is not a stash commit: %w", oid, err)
+	}
+	var b changeBuilder
+	if err := g.addTreeDiff(ctx, &b, base, stash); err != nil {
+		return Change{}, err
+	}
+	// The third parent, when present, records the untracked files.
+	if stash.NumParents() > 2 {
+		untracked, err := stash.Parent(2)
+		if err != nil {
+			return Change{}, err
+		}
+		if err := g.addTreeDiff(ctx, &b, nil, untracked); err != nil {
+			return Change{}, err
+		}
+	}
+	return b.change()
+}
+
+func (g *goGitCollector) Range(ctx context.Context, rng string) (Change, error) {
+	var from, to *object.Commit
+	var err error
+	switch {
+	case strings.Contains(rng, "..."):
+		left, right, _ := strings.Cut(rng, "...")
+		var a *object.Commit
+		if a, err = g.commit(orHead(left)); err != nil {
+			return Change{}, err
+		}
+		if to, err = g.commit(orHead(right)); err != nil {
+			return Change{}, err
+		}
+		bases, err := a.MergeBase(to)
+		if err != nil {
+			return Change{}, err
+		}
+		if len(bases) == 0 {
+			return Change{}, fmt.Errorf("%s: no merge base", rng)
+		}
+		from = bases[0]
+	case strings.Contains(rng, ".."):
+		left, right, _ := strings.Cut(rng, "..")
+		if from, err = g.commit(orHead(left)); err != nil {
+			return Change{}, err
+		}
+		if to, err = g.commit(orHead(right)); err != nil {
+			return Change{}, err
+		}
+	default:
+		if to, err = g.commit(rng); err != nil {
+			return Change{}, err
+		}
+		if to.NumParents() > 0 {
+			if from, err = to.Parent(0); err != nil {
+				return Change{}, err
+			}
+		}
+	}
+
+	var b changeBuilder
+	if err := g.addTreeDiff(ctx, &b, from, to); err != nil {
+		return Change{}, err
+	}
+	return b.change()
+}
+
+func orHead(rev string) string {
+	if rev == "" {
+		return "HEAD"
+	}
+	return rev
+}
+
+func (g *goGitCollector) commit(rev string) (*object.Commit, error) {
+	hash, err := g.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("unknown revision %q: %w", rev, err)
+	}
+	return g.repo.CommitObject(*hash)
+}
+
+// addTreeDiff adds the changes from one commit's tree to another's. A nil
+// from commit stands for the empty tree.
+func (g *goGitCollector) addTreeDiff(ctx context.Context, b *changeBuilder, from, to *object.Commit) error {
+	var fromTree, toTree *object.Tree
+	var err error
+	if from != nil {
+		if fromTree, err = from.Tree(); err != nil {
+			return err
+		}
+	}
+	if toTree, err = to.Tree(); err != nil {
+		return err
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, fromTree, toTree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		b.paths(c.From.Name, c.To.Name)
+	}
+	patch, err := changes.PatchContext(ctx)
+	if err != nil {
+		return err
+	}
+	b.patches = append(b.patches, patch.FilePatches()...)
+	return nil
+}
+
+// blob returns a loader for f's content, or nil when f is nil.
+func (g *goGitCollector) blob(f *file) func() ([]byte, error) {
+	if f == nil {
+		return nil
+	}
+	return func() ([]byte, error) {
+		if f.mode == filemode.Submodule {
+			return []byte("Subproject commit " + f.hash.String() + "\n"), nil
+		}
+		blob, err := g.repo.BlobObject(f.hash)
+		if err != nil {
+			return nil, err
+		}
+		r, err := blob.Reader()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+}
+
+// pathspec matches repository paths against git pathspecs. Each names a
+// file or directory, or is a glob, relative to the collector's directory;
+// a leading ":/" makes it relative to the top level instead.
+type pathspec []string
+
+func newPathspec(prefix string, specs []string) pathspec {
+	var ps pathspec
+	for _, s := range specs {
+		if rest, ok := strings.CutPrefix(s, ":/"); ok {
+			s = rest
+		} else {
+			s = path.Join(prefix, filepath.ToSlash(s))
+		}
+		ps = append(ps, path.Clean("/" + s)[1:])
+	}
+	return ps
+}
+
+func (ps pathspec) matches(name string) bool {
+	if len(ps) == 0 {
+		return true
+	}
+	for _, s := range ps {
+		if s == "" || name == s || strings.HasPrefix(name, s+"/") {
+			return true
+		}
+		if strings.ContainsAny(s, "*?[") {
+			if ok, _ := path.Match(s, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changeBuilder accumulates changed paths and file patches.
+type changeBuilder struct {
+	set     map[string]struct{}
+	patches []diff.FilePatch
+	// conflicts are unmerged paths, which have no patch.
+	conflicts []FileChange
+}
+
+// unmerged records a conflicted path once, although the index holds an
+// entry for each of its stages.
+func (b *changeBuilder) unmerged(name string) {
+	for _, c := range b.conflicts {
+		if c.Path == name {
+			return
+		}
+	}
+	b.paths(name)
+	b.conflicts = append(b.conflicts, FileChange{Status: StatusUnmerged, Path: name})
+}
+
+func (b *changeBuilder) paths(names ...string) {
+	if b.set == nil {
+		b.set = map[string]struct{}{}
+	}
+	for _, n := range names {
+		if n != "" {
+			b.set[n] = struct{}{}
+		}
+	}
+}
+
+// add records a change from one file version to another; either may be nil
+// for additions and deletions.
+func (b *changeBuilder) add(from, to *file, loadFrom, loadTo func() ([]byte, error)) error {
+	var src, dst []byte
+	var err error
+	if loadFrom != nil {
+		if src, err = loadFrom(); err != nil {
+			return err
+		}
+	}
+	if loadTo != nil {
+		if dst, err = loadTo(); err != nil {
+			return err
+		}
+	}
+	p := &filePatch{from: from, to: to, binary: isBinary(src) || isBinary(dst)}
+	if !p.binary {
+		for _, d := range utildiff.Do(string(src), string(dst)) {
+			op := diff.Equal
+			switch d.Type {
+			case diffmatchpatch.DiffInsert:
+				op = diff.Add
+			case diffmatchpatch.DiffDelete:
+				op = diff.Delete
+			}
+			p.chunks = append(p.chunks, chunk{content: d.Text, op: op})
+		}
+	}
+	if from != nil {
+		b.paths(from.path)
+	}
+	if to != nil {
+		b.paths(to.path)
+	}
+	b.patches = append(b.patches, p)
+	return nil
+}
+
+func (b *changeBuilder) change() (Change, error) {
+	var buf bytes.Buffer
+	if len(b.patches) > 0 {
+		if err := diff.NewUnifiedEncoder(&buf, 0).Encode(patch(b.patches)); err != nil {
+			return Change{}, err
+		}
+	}
+	files := append([]FileChange{}, b.conflicts...)
+	hashes := make([]plumbing.Hash, len(files))
+	for _, p := range b.patches {
+		files = append(files, fileChange(p))
+		// The blob that exists on one side of an addition or deletion.
+		var h plumbing.Hash
+		if from, to := p.Files(); from == nil {
+			h = to.Hash()
+		} else if to == nil {
+			h = from.Hash()
+		}
+		hashes = append(hashes, h)
+	}
+	files = pairRenames(files, hashes)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return Change{Paths: sortedPaths(b.set), Files: files, Diff: buf.String(), contents: b.contents}, nil
+}
+
+// contents rebuilds both versions of f from the chunks of the patches that
+// have it on either side; their Equal chunks hold the unchanged text.
+func (b *changeBuilder) contents(ctx context.Context, f FileChange) (before, after []byte, err error) {
+	oldPath := f.Path
+	if f.OldPath != "" {
+		oldPath = f.OldPath
+	}
+	found := false
+	for _, p := range b.patches {
+		from, to := p.Files()
+		if from != nil && from.Path() == oldPath && before == nil {
+			before, found = patchSide(p, diff.Delete), true
+		}
+		if to != nil && to.Path() == f.Path && after == nil {
+			after, found = patchSide(p, diff.Add), true
+		}
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("%s is not part of the change", f.Path)
+	}
+	return before, after, nil
+}
+
+// patchSide joins the Equal chunks of p with those of the given operation.
+func patchSide(p diff.FilePatch, op diff.Operation) []byte {
+	content := []byte{}
+	for _, c := range p.Chunks() {
+		if c.Type() == diff.Equal || c.Type() == op {
+			content = append(content, c.Content()...)
+		}
+	}
+	return content
+}
+
+// fileChange summarizes a file patch.
+func fileChange(p diff.FilePatch) FileChange {
+	from, to := p.Files()
+	f := FileChange{Binary: p.IsBinary()}
+	switch {
+	case from == nil:
+		f.Status, f.Path = StatusAdded, to.Path()
+	case to == nil:
+		f.Status, f.Path = StatusDeleted, from.Path()
+	default:
+		f.Status, f.Path = StatusModified, to.Path()
+		if from.Path() != to.Path() {
+			f.Status, f.OldPath = StatusRenamed, from.Path()
+		}
+		if from.Mode() != to.Mode() {
+			if !from.Mode().IsFile() || !to.Mode().IsFile() || (from.Mode() == filemode.Symlink) != (to.Mode() == filemode.Symlink) {
+				f.Status = StatusTypeChanged
+			}
+			f.OldMode, f.NewMode = fmt.Sprintf("%06o", uint32(from.Mode())), fmt.Sprintf("%06o", uint32(to.Mode()))
+		}
+	}
+	if f.Binary {
+		return f
+	}
+	for _, c := range p.Chunks() {
+		n := strings.Count(c.Content(), "\n")
+		if c.Content() != "" && !strings.HasSuffix(c.Content(), "\n") {
+			n++
+		}
+		switch c.Type() {
+		case diff.Add:
+			f.Added += n
+		case diff.Delete:
+			f.Removed += n
+		}
+	}
+	return f
+}
+
+// pairRenames turns a deletion and an addition of the same blob, given by
+// hashes, into a rename. Unlike git, only exact renames are found outside
+// tree diffs.
+func pairRenames(files []FileChange, hashes []plumbing.Hash) []FileChange {
+	deleted := map[plumbing.Hash]int{}
+	for i, f := range files {
+		if f.Status == StatusDeleted && !hashes[i].IsZero() {
+			deleted[hashes[i]] = i
+		}
+	}
+	if len(deleted) == 0 {
+		return files
+	}
+	gone := map[int]bool{}
+	for i, f := range files {
+		if f.Status != StatusAdded || hashes[i].IsZero() {
+			continue
+		}
+		j, ok := deleted[hashes[i]]
+		if !ok || gone[j] {
+			continue
+		}
+		gone[j] = true
+		files[i] = FileChange{Status: StatusRenamed, Path: f.Path, OldPath: files[j].Path, Binary: f.Binary}
+	}
+	kept := files[:0]
+	for i, f := range files {
+		if !gone[i] {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binaryProbe)], 0) >= 0
+}
+
+// file, filePatch, chunk and patch implement go-git's diff interfaces for
+// changes that are not between two trees.
+type file struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (f *file) Hash() plumbing.Hash     { return f.hash }
+func (f *file) Mode() filemode.FileMode { return f.mode }
+func (f *file) Path() string            { return f.path }
+
+type filePatch struct {
+	from, to *file
+	binary   bool
+	chunks   []diff.Chunk
+}
+
+func (p *filePatch) IsBinary() bool       { return p.binary }
+func (p *filePatch) Chunks() []diff.Chunk { return p.chunks }
+
+func (p *filePatch) Files() (diff.File, diff.File) {
+	// Typed nil pointers would not compare equal to nil in the encoder.
+	var from, to diff.File
+	if p.from != nil {
+		from = p.from
+	}
+	if p.to != nil {
+		to = p.to
+	}
+	return from, to
+}
+
+type chunk struct {
+	content string
+	op      diff.Operation
+}
+
+func (c chunk) Content() string      { return c.content }
+func (c chunk) Type() diff.Operation { return c.op }
+
+type patch []diff.FilePatch
+
+func (p patch) FilePatches() []diff.FilePatch { return p }
+func (p patch) Message() string               { return "" }
@@ -0,0 +1,209 @@
+// Package httpapi implements the HTTP/JSON API served by diffscribe serve:
+// routing, token authentication, CORS and error responses. What the
+// endpoints do is supplied by a Backend.
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxBodyBytes caps request bodies; commit messages and options are small.
+const maxBodyBytes = 1 << 20
+
+// SuggestRequest is the body of POST /suggest.
+type SuggestRequest struct {
+	// Repo is a path inside the repository; empty means the server's
+	// working directory.
+	Repo   string `json:"repo"`
+	Prefix string `json:"prefix"`
+	// Mode selects which changes to describe.
+	Mode string `json:"mode"`
+	// Quantity overrides the number of suggestions when positive.
+	Quantity int `json:"quantity"`
+}
+
+// LintRequest is the body of POST /lint.
+type LintRequest struct {
+	Repo    string `json:"repo"`
+	Message string `json:"message"`
+}
+
+// Backend answers the API's requests. The returned values are encoded as the
+// JSON response body.
+type Backend interface {
+	Suggest(SuggestRequest) (any, error)
+	Lint(LintRequest) (any, error)
+}
+
+// Error is an error with the HTTP status it should be reported with. Other
+// errors from a Backend are reported as 500.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// BadRequest returns a 400 error.
+func BadRequest(format string, args ...any) *Error {
+	return &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// Options configures the handler.
+type Options struct {
+	// Token, when set, must be sent as "Authorization: Bearer <token>" on
+	// every request except GET /health.
+	Token string
+	// Origins lists the browser origins allowed to call the API, or "*" for
+	// any. Requests from other origins are rejected.
+	Origins []string
+	// Hosts, when set, restricts the Host header to these names, which
+	// defeats DNS rebinding against a server bound to loopback.
+	Hosts []string
+	// Version is reported by GET /health.
+	Version string
+}
+
+// NewHandler returns the API handler.
+func NewHandler(b Backend, opts Options) http.Handler {
+	h := &handler{backend: b, opts: opts}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", h.health)
+	mux.HandleFunc("POST /suggest", h.suggest)
+	mux.HandleFunc("POST /lint", h.lint)
+	return h.wrap(mux)
+}
+
+type handler struct {
+	backend Backend
+	opts    Options
+}
+
+// LoopbackHosts are the Host names of a server bound to loopback.
+var LoopbackHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// IsLoopback reports whether addr (host:port) listens only on loopback.
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (h *handler) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(h.opts.Hosts) > 0 {
+			host := r.Host
+			if name, _, err := net.SplitHostPort(host); err == nil {
+				host = name
+			}
+			host = strings.Trim(host, "[]")
+			if !slices.Contains(h.opts.Hosts, strings.ToLower(host)) {
+				writeError(w, &Error{Status: http.StatusForbidden, Message: "host not allowed"})
+				return
+			}
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if !h.originAllowed(origin) {
+				writeError(w, &Error{Status: http.StatusForbidden, Message: "origin not allowed"})
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		if h.opts.Token != "" && r.URL.Path != "/health" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, &Error{Status: http.StatusUnauthorized, Message: "missing or invalid token"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) originAllowed(origin string) bool {
+	return slices.Contains(h.opts.Origins, "*") || slices.Contains(h.opts.Origins, origin)
+}
+
+func (h *handler) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "version": h.opts.Version})
+}
+
+func (h *handler) suggest(w http.ResponseWriter, r *http.Request) {
+	var req SuggestRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	respond(w, func() (any, error) { return h.backend.Suggest(req) })
+}
+
+func (h *handler) lint(w http.ResponseWriter, r *http.Request) {
+	var req LintRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	respond(w, func() (any, error) { return h.backend.Lint(req) })
+}
+
+// decode reads a JSON body. Requiring the JSON content type means browsers
+// must pass a CORS preflight before sending one.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		writeError(w, &Error{Status: http.StatusUnsupportedMediaType, Message: "Content-Type must be application/json"})
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, BadRequest("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func respond(w http.ResponseWriter, fn func() (any, error)) {
+	result, err := fn()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		status = apiErr.Status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeBackend struct {
+	suggest SuggestRequest
+}
+
+func (b *fakeBackend) Suggest(req SuggestRequest) (any, error) {
+	b.suggest = req
+	if req.Mode == "bogus" {
+		return nil, BadRequest("unknown mode %q", req.Mode)
+	}
+	if req.Mode == "boom" {
+		return nil, errors.New("provider down")
+	}
+	return map[string][]string{"suggestions": {req.Prefix + "add x"}}, nil
+}
+
+func (b *fakeBackend) Lint(req LintRequest) (any, error) {
+	return map[string]bool{"valid": req.Message != ""}, nil
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string, header map[string]string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		if k == "Host" {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var out map[string]any
+	if rec.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q", method, path, rec.Body.String())
+		}
+	}
+	return rec, out
+}
+
+func TestHandlerEndpoints(t *testing.T) {
+	b := &fakeBackend{}
+	h := NewHandler(b, Options{Version: "1.2.3"})
+
+	rec, out := do(t, h, "GET", "/health", "", nil)
+	if rec.Code != 200 || out["status"] != "ok" || out["version"] != "1.2.3" {
+		t.Fatalf("unexpected health response %d %v", rec.Code, out)
+	}
+
+	rec, out = do(t, h, "POST", "/suggest", `{"repo":"/r","prefix":"feat: ","mode":"staged","quantity":2}`, nil)
+	if rec.Code != 200 || out["suggestions"].([]any)[0] != "feat: add x" {
+		t.Fatalf("unexpected suggest response %d %v", rec.Code, out)
+	}
+	if b.suggest != (SuggestRequest{Repo: "/r", Prefix: "feat: ", Mode: "staged", Quantity: 2}) {
+		t.Fatalf("unexpected decoded request %+v", b.suggest)
+	}
+
+	rec, out = do(t, h, "POST", "/lint", `{"message":"fix: x"}`, nil)
+	if rec.Code != 200 || out["valid"] != true {
+		t.Fatalf("unexpected lint response %d %v", rec.Code, out)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	h := NewHandler(&fakeBackend{}, Options{})
+	cases := []struct {
+		method, path, body string
+		header             map[string]string
+		status             int
+	}{
+		{"POST", "/suggest", `{"mode":"bogus"}`, nil, 400},
+		{"POST", "/suggest", `{"mode":"boom"}`, nil, 500},
+		{"POST", "/suggest", `{"unknown":1}`, nil, 400},
+		{"POST", "/suggest", `{`, nil, 400},
+		{"POST", "/lint", `{}`, map[string]string{"Content-Type": "text/plain"}, 415},
+		{"GET", "/suggest", "", nil, 405},
+		{"GET", "/nope", "", nil, 404},
+	}
+	for _, c := range cases {
+		rec, out := do(t, h, c.method, c.path, c.body, c.header)
+		if rec.Code != c.status {
+			t.Fatalf("%s %s %s: expected %d, got %d", c.method, c.path, c.body, c.status, rec.Code)
+		}
+		if c.status != 404 && c.status != 405 && out["error"] == nil {
+			t.Fatalf("%s %s: expected an error body, got %q", c.method, c.path, rec.Body.String())
+		}
+	}
+}
+
+func TestHandlerToken(t *testing.T) {
+	h := NewHandler(&fakeBackend{}, Options{Token: "s3cret"})
+	if rec, _ := do(t, h, "POST", "/lint", `{"message":"x"}`, nil); rec.Code != 401 {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+	if rec, _ := do(t, h, "POST", "/lint", `{"message":"x"}`, map[string]string{"Authorization": "Bearer wrong"}); rec.Code != 401 {
+		t.Fatalf("expected 401 with a wrong token, got %d", rec.Code)
+	}
+	if rec, _ := do(t, h, "POST", "/lint", `{"message":"x"}`, map[string]string{"Authorization": "Bearer s3cret"}); rec.Code != 200 {
+		t.Fatalf("expected 200 with the token, got %d", rec.Code)
+	}
+	if rec, _ := do(t, h, "GET", "/health", "", nil); rec.Code != 200 {
+		t.Fatalf("expected health to be open, got %d", rec.Code)
+	}
+}
+
+func TestHandlerCORSAndHosts(t *testing.T) {
+	h := NewHandler(&fakeBackend{}, Options{Origins: []string{"http://app.test"}, Hosts: LoopbackHosts})
+
+	rec, _ := do(t, h, "OPTIONS", "/suggest", "", map[string]string{"Origin": "http://app.test", "Host": "127.0.0.1:7000"})
+	if rec.Code != 204 || rec.Header().Get("Access-Control-Allow-Origin") != "http://app.test" {
+		t.Fatalf("unexpected preflight %d %v", rec.Code, rec.Header())
+	}
+	if !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Fatalf("expected Authorization to be allowed, got %v", rec.Header())
+	}
+
+	rec, _ = do(t, h, "POST", "/lint", `{"message":"x"}`, map[string]string{"Origin": "http://evil.test", "Host": "localhost:7000"})
+	if rec.Code != 403 {
+		t.Fatalf("expected 403 for a foreign origin, got %d", rec.Code)
+	}
+
+	rec, _ = do(t, h, "POST", "/lint", `{"message":"x"}`, map[string]string{"Host": "attacker.test:7000"})
+	if rec.Code != 403 {
+		t.Fatalf("expected 403 for a foreign host, got %d", rec.Code)
+	}
+	rec, _ = do(t, h, "POST", "/lint", `{"message":"x"}`, map[string]string{"Host": "[::1]:7000"})
+	if rec.Code != 200 {
+		t.Fatalf("expected IPv6 loopback host to be allowed, got %d", rec.Code)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:7000": true,
+		"localhost:7000": true,
+		"[::1]:7000":     true,
+		"0.0.0.0:7000":   false,
+		":7000":          false,
+		"10.0.0.2:7000":  false,
+	} {
+		if got := IsLoopback(addr); got != want {
+			t.Fatalf("IsLoopback(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
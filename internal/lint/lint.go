@@ -0,0 +1,289 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rules controls which checks Lint applies to a commit message.
+type Rules struct {
+	Conventional bool
+	// Pattern, when set, must match the subject. Its named groups "type",
+	// "scope" and "description" are checked like Conventional headers.
+	Pattern             *regexp.Regexp
+	PatternName         string
+	Types               []string
+	Scopes              []string
+	SubjectMaxLength    int
+	BodyWrap            int
+	Imperative          bool
+	TrailingPunctuation bool
+	Trailers            []string
+}
+
+// DefaultTypes lists the Conventional Commit types accepted when a rule set
+// does not provide its own.
+var DefaultTypes = []string{"build", "chore", "ci", "docs", "feat", "fix", "perf", "refactor", "revert", "style", "test"}
+
+// Violation describes a single rule failure.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("line %d: %s: %s", v.Line, v.Rule, v.Message)
+}
+
+// Header is a parsed Conventional Commit header.
+type Header struct {
+	Type        string
+	Scope       string
+	Breaking    bool
+	Description string
+}
+
+var headerPattern = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()\r\n]*)\))?(!)?: (.*)$`)
+
+// ParseHeader splits a Conventional Commit subject into its parts.
+func ParseHeader(subject string) (Header, bool) {
+	m := headerPattern.FindStringSubmatch(subject)
+	if m == nil {
+		return Header{}, false
+	}
+	return Header{Type: m[1], Scope: m[2], Breaking: m[3] == "!", Description: m[4]}, true
+}
+
+// Lint checks a complete commit message, as found in COMMIT_EDITMSG.
+func Lint(msg string, rules Rules) []Violation {
+	lines := messageLines(msg)
+	if len(lines) == 0 {
+		return []Violation{{Rule: "empty", Line: 1, Message: "commit message is empty"}}
+	}
+
+	out := LintSubject(lines[0], rules)
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		out = append(out, Violation{Rule: "body-separator", Line: 2, Message: "separate the subject from the body with a blank line"})
+	}
+	if rules.BodyWrap > 0 {
+		for i, line := range lines[1:] {
+			if n := utf8.RuneCountInString(line); n > rules.BodyWrap && strings.Contains(line, " ") {
+				out = append(out, Violation{
+					Rule:    "body-wrap",
+					Line:    i + 2,
+					Message: fmt.Sprintf("line is %d characters (wrap at %d)", n, rules.BodyWrap),
+				})
+			}
+		}
+	}
+	if len(rules.Trailers) > 0 {
+		present := trailerKeys(lines)
+		for _, want := range rules.Trailers {
+			if _, ok := present[strings.ToLower(want)]; !ok {
+				out = append(out, Violation{Rule: "trailer", Line: len(lines), Message: fmt.Sprintf("missing required %q trailer", want)})
+			}
+		}
+	}
+	return out
+}
+
+// LintSubject applies only the rules that concern the subject line. It is the
+// check used for generated candidates, which never carry bodies or trailers.
+func LintSubject(subject string, rules Rules) []Violation {
+	subject = strings.TrimRight(subject, " \t")
+	var out []Violation
+	add := func(rule, msg string) {
+		out = append(out, Violation{Rule: rule, Line: 1, Message: msg})
+	}
+
+	if strings.TrimSpace(subject) == "" {
+		add("empty", "subject is empty")
+		return out
+	}
+
+	description := subject
+	if rules.Conventional {
+		h, ok := ParseHeader(subject)
+		if !ok {
+			add("conventional", `subject must look like "type(scope): description"`)
+		} else {
+			description = h.Description
+			types := rules.Types
+			if len(types) == 0 {
+				types = DefaultTypes
+			}
+			if !contains(types, h.Type) {
+				add("type", fmt.Sprintf("type %q is not one of %s", h.Type, strings.Join(types, ", ")))
+			}
+			if len(rules.Scopes) > 0 && h.Scope != "" && !contains(rules.Scopes, h.Scope) {
+				add("scope", fmt.Sprintf("scope %q is not one of %s", h.Scope, strings.Join(rules.Scopes, ", ")))
+			}
+			if strings.TrimSpace(h.Description) == "" {
+				add("conventional", "description after the colon is empty")
+			}
+		}
+	}
+	if rules.Pattern != nil {
+		if m := rules.Pattern.FindStringSubmatch(subject); m == nil {
+			add("format", fmt.Sprintf("subject does not match the %s format", fallback(rules.PatternName, "configured")))
+		} else {
+			groups := make(map[string]string)
+			for i, name := range rules.Pattern.SubexpNames() {
+				if name != "" {
+					groups[name] = m[i]
+				}
+			}
+			if d, ok := groups["description"]; ok {
+				description = d
+			}
+			if t := groups["type"]; t != "" && len(rules.Types) > 0 && !contains(rules.Types, t) {
+				add("type", fmt.Sprintf("type %q is not one of %s", t, strings.Join(rules.Types, ", ")))
+			}
+			if sc := groups["scope"]; sc != "" && len(rules.Scopes) > 0 && !contains(rules.Scopes, sc) {
+				add("scope", fmt.Sprintf("scope %q is not one of %s", sc, strings.Join(rules.Scopes, ", ")))
+			}
+		}
+	}
+
+	if rules.SubjectMaxLength > 0 {
+		if n := utf8.RuneCountInString(subject); n > rules.SubjectMaxLength {
+			add("subject-length", fmt.Sprintf("subject is %d characters (max %d)", n, rules.SubjectMaxLength))
+		}
+	}
+	if rules.TrailingPunctuation && endsWithPunctuation(subject) {
+		add("subject-punctuation", "subject must not end with punctuation")
+	}
+	if rules.Imperative {
+		if word, base, ok := nonImperative(description); ok {
+			add("imperative", fmt.Sprintf("use the imperative mood (%q instead of %q)", base, word))
+		}
+	}
+	return out
+}
+
+// Repair applies the mechanical fixes Lint knows how to make to a single-line
+// candidate: lowercasing the type, dropping trailing punctuation and rewriting
+// a non-imperative leading verb. Problems that need judgement are left alone.
+func Repair(subject string, rules Rules) string {
+	subject = strings.TrimSpace(subject)
+	if rules.TrailingPunctuation {
+		subject = strings.TrimRightFunc(subject, func(r rune) bool {
+			return isTrailingPunctuation(r) || unicode.IsSpace(r)
+		})
+	}
+
+	head, description := "", subject
+	if rules.Conventional {
+		if h, ok := ParseHeader(subject); ok {
+			head = strings.TrimSuffix(subject, h.Description)
+			head = strings.Replace(head, h.Type, strings.ToLower(h.Type), 1)
+			description = h.Description
+		}
+	} else if rules.Pattern != nil {
+		if i := rules.Pattern.SubexpIndex("description"); i > 0 {
+			if loc := rules.Pattern.FindStringSubmatchIndex(subject); loc != nil && loc[2*i] >= 0 {
+				head, description = subject[:loc[2*i]], subject[loc[2*i]:]
+			}
+		}
+	}
+	if rules.Imperative {
+		if word, base, ok := nonImperative(description); ok {
+			if first, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(first) {
+				base = strings.ToUpper(base[:1]) + base[1:]
+			}
+			description = base + strings.TrimPrefix(description, word)
+		}
+	}
+	return head + description
+}
+
+// messageLines strips git comment lines and everything below the scissors
+// marker, then trims trailing blank lines.
+func messageLines(msg string) []string {
+	lines, _ := messageLineRefs(msg)
+	return lines
+}
+
+// SourceLine maps the line number of a Violation, which counts lines after
+// comments and leading blank lines are dropped, back to the line of msg it
+// refers to. Both are 1-based; 0 means the line does not exist.
+func SourceLine(msg string, line int) int {
+	_, refs := messageLineRefs(msg)
+	if line < 1 || line > len(refs) {
+		return 0
+	}
+	return refs[line-1] + 1
+}
+
+// messageLineRefs returns the lines Lint checks and, for each, its 0-based
+// index in msg.
+func messageLineRefs(msg string) ([]string, []int) {
+	var lines []string
+	var refs []int
+	for i, line := range strings.Split(strings.ReplaceAll(msg, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, "# ") && strings.Contains(line, ">8") {
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t"))
+		refs = append(refs, i)
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines, refs = lines[1:], refs[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines, refs = lines[:len(lines)-1], refs[:len(refs)-1]
+	}
+	return lines, refs
+}
+
+var trailerPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*): \S`)
+
+// trailerKeys returns the lowercased keys found in the final paragraph.
+func trailerKeys(lines []string) map[string]struct{} {
+	keys := make(map[string]struct{})
+	if len(lines) < 3 {
+		return keys
+	}
+	start := len(lines) - 1
+	for start > 1 && strings.TrimSpace(lines[start-1]) != "" {
+		start--
+	}
+	for _, line := range lines[start:] {
+		if m := trailerPattern.FindStringSubmatch(line); m != nil {
+			keys[strings.ToLower(m[1])] = struct{}{}
+		}
+	}
+	return keys
+}
+
+func endsWithPunctuation(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return isTrailingPunctuation(r)
+}
+
+func isTrailingPunctuation(r rune) bool {
+	return strings.ContainsRune(".,;:", r)
+}
+
+func fallback(v, alt string) string {
+	if v == "" {
+		return alt
+	}
+	return v
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package lint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var conventionalRules = Rules{
+	Conventional:        true,
+	SubjectMaxLength:    50,
+	BodyWrap:            72,
+	Imperative:          true,
+	TrailingPunctuation: true,
+}
+
+func rulesOf(vs []Violation) []string {
+	var out []string
+	for _, v := range vs {
+		out = append(out, v.Rule)
+	}
+	return out
+}
+
+func TestParseHeader(t *testing.T) {
+	h, ok := ParseHeader("feat(api)!: drop v1 endpoints")
+	if !ok {
+		t.Fatalf("expected header to parse")
+	}
+	want := Header{Type: "feat", Scope: "api", Breaking: true, Description: "drop v1 endpoints"}
+	if !reflect.DeepEqual(h, want) {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+	if _, ok := ParseHeader("just a sentence"); ok {
+		t.Fatalf("expected plain sentence to be rejected")
+	}
+}
+
+func TestLintSubject(t *testing.T) {
+	cases := []struct {
+		name    string
+		subject string
+		rules   Rules
+		want    []string
+	}{
+		{"valid", "feat(cli): add branch command", conventionalRules, nil},
+		{"not conventional", "Add branch command", conventionalRules, []string{"conventional"}},
+		{"unknown type", "feature: add branch command", conventionalRules, []string{"type"}},
+		{"unknown scope", "fix(db): handle nil rows", Rules{Conventional: true, Scopes: []string{"cli", "llm"}}, []string{"scope"}},
+		{"too long", "feat: " + strings.Repeat("x", 60), conventionalRules, []string{"subject-length"}},
+		{"punctuation", "fix: handle nil rows.", conventionalRules, []string{"subject-punctuation"}},
+		{"past tense", "fix: fixed nil rows", conventionalRules, []string{"imperative"}},
+		{"third person", "docs: Updates readme", conventionalRules, []string{"imperative"}},
+		{"plain allows anything", "Added things.", Rules{}, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rulesOf(LintSubject(tc.subject, tc.rules)); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLint(t *testing.T) {
+	msg := "feat: add lint command\n" +
+		"body starts too early\n" +
+		strings.Repeat("word ", 20) + "\n" +
+		"\n" +
+		"Refs: #12\n" +
+		"# Please enter the commit message for your changes.\n"
+	rules := conventionalRules
+	rules.Trailers = []string{"Refs", "Signed-off-by"}
+
+	got := Lint(msg, rules)
+	if want := []string{"body-separator", "body-wrap", "trailer"}; !reflect.DeepEqual(rulesOf(got), want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if !strings.Contains(got[2].Message, "Signed-off-by") {
+		t.Fatalf("expected missing Signed-off-by, got %s", got[2])
+	}
+}
+
+func TestLint_Empty(t *testing.T) {
+	got := Lint("# only comments\n\n", conventionalRules)
+	if len(got) != 1 || got[0].Rule != "empty" {
+		t.Fatalf("expected empty violation, got %v", got)
+	}
+}
+
+func TestLint_IgnoresScissors(t *testing.T) {
+	msg := "fix: handle nil rows\n# ------------------------ >8 ------------------------\n" + strings.Repeat("diff ", 40)
+	if got := Lint(msg, conventionalRules); len(got) != 0 {
+		t.Fatalf("expected no violations, got %v", got)
+	}
+}
+
+func TestSourceLine(t *testing.T) {
+	msg := "\n# comment\nfeat: add thing\n# another\n\n" + strings.Repeat("word ", 20) + "\n"
+	got := Lint(msg, conventionalRules)
+	if len(got) != 1 || got[0].Rule != "body-wrap" {
+		t.Fatalf("expected a body-wrap violation, got %v", got)
+	}
+	if line := SourceLine(msg, got[0].Line); line != 6 {
+		t.Fatalf("expected body-wrap on line 6 of the message, got %d", line)
+	}
+	if line := SourceLine(msg, 1); line != 3 {
+		t.Fatalf("expected subject on line 3, got %d", line)
+	}
+	if line := SourceLine(msg, 9); line != 0 {
+		t.Fatalf("expected 0 for a missing line, got %d", line)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	cases := map[string]string{
+		"Fix: Fixed nil rows.":       "fix: Fix nil rows",
+		"feat(cli): adding branches": "feat(cli): add branches",
+		"chore: tidy go.mod":         "chore: tidy go.mod",
+	}
+	for in, want := range cases {
+		if got := Repair(in, conventionalRules); got != want {
+			t.Fatalf("Repair(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package lint
+
+import "strings"
+
+// imperativeVerbs are the verbs commit subjects most often start with. The
+// mood check only flags inflections of these, which keeps false positives on
+// nouns and adjectives to a minimum.
+var imperativeVerbs = []string{
+	"add", "adjust", "allow", "apply", "avoid", "bump", "change", "clean",
+	"convert", "correct", "create", "delete", "deprecate", "disable", "document",
+	"drop", "enable", "ensure", "expose", "extract", "fix", "handle", "hide",
+	"implement", "improve", "include", "introduce", "limit", "make", "merge",
+	"migrate", "move", "optimize", "prevent", "refactor", "reduce", "release",
+	"remove", "rename", "replace", "restore", "revert", "rework", "show",
+	"simplify", "skip", "split", "support", "switch", "tidy", "tweak", "update",
+	"upgrade", "use", "validate",
+}
+
+var inflections = buildInflections()
+
+func buildInflections() map[string]string {
+	forms := make(map[string]string)
+	for _, verb := range imperativeVerbs {
+		for _, form := range inflect(verb) {
+			if form != verb {
+				forms[form] = verb
+			}
+		}
+	}
+	// Irregular forms the suffix rules get wrong.
+	delete(forms, "maked")
+	delete(forms, "splitted")
+	forms["made"] = "make"
+	forms["shown"] = "show"
+	return forms
+}
+
+func inflect(verb string) []string {
+	last := verb[len(verb)-1]
+	stem := verb[:len(verb)-1]
+	switch {
+	case last == 'e':
+		return []string{verb + "s", verb + "d", stem + "ing"}
+	case last == 'y' && !strings.ContainsRune("aeiou", rune(verb[len(verb)-2])):
+		return []string{stem + "ies", stem + "ied", verb + "ing"}
+	case strings.HasSuffix(verb, "x") || strings.HasSuffix(verb, "sh") || strings.HasSuffix(verb, "ch") || strings.HasSuffix(verb, "s"):
+		return []string{verb + "es", verb + "ed", verb + "ing"}
+	case verb == "drop" || verb == "skip" || verb == "split":
+		return []string{verb + "s", verb + string(last) + "ed", verb + string(last) + "ing"}
+	default:
+		return []string{verb + "s", verb + "ed", verb + "ing"}
+	}
+}
+
+// nonImperative reports whether the description starts with an inflected
+// form of a known verb, returning that word and its imperative base.
+func nonImperative(description string) (string, string, bool) {
+	fields := strings.Fields(description)
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	word := fields[0]
+	base, ok := inflections[strings.ToLower(word)]
+	if !ok {
+		return "", "", false
+	}
+	return word, base, true
+}
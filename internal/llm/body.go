@@ -0,0 +1,39 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const bodySystemPrompt = `You write the body of git commit messages. Explain what changed and why in
+plain prose for a reviewer reading the history later: the motivation, the
+approach and any notable consequences. Do not repeat the subject line, do not
+list every file, and do not use markdown headings.`
+
+// GenerateBody asks the provider for a commit message body to follow
+// subject. cfg's system prompt is replaced with one written for bodies.
+func GenerateBody(ctx context.Context, data Context, subject string, cfg Config) (Result, error) {
+	cfg.SystemPrompt = bodySystemPrompt
+	cfg.Quantity = 1
+	cfg.MaxRepairs = 0
+
+	var res Result
+	bodies, _, err := generate(ctx, cfg, buildBodyPrompt(data, subject), nil, nil, &res.Usage)
+	res.Suggestions = bodies
+	return res, err
+}
+
+func buildBodyPrompt(data Context, subject string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Commit subject: %s\n", strings.TrimSpace(subject))
+	fmt.Fprintf(&b, "Changed files (%d):\n", len(data.Paths))
+	for _, p := range data.Paths {
+		fmt.Fprintf(&b, "- %s\n", p)
+	}
+	b.WriteString("\nDiff (truncated when necessary):\n")
+	b.WriteString(data.Diff)
+	b.WriteString("\n\nWrite one commit message body of one or two short paragraphs.\n")
+	b.WriteString("Respond with a JSON array containing that body as a single string (no markdown, no prose outside it).")
+	return b.String()
+}
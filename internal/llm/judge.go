@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const judgeSystemPrompt = `You grade git commit messages. For each candidate, judge how accurately and
+specifically it describes the diff, using the human-written reference message
+as a guide to intent rather than wording. Score from 1 (wrong or vacuous) to 5
+(as good as or better than the reference).`
+
+// Judgement is the outcome of Judge.
+type Judgement struct {
+	// Scores holds a 1-5 score per candidate, in order; 0 means the model
+	// did not score that candidate.
+	Scores []int
+	Usage  Usage
+}
+
+var judgeLine = regexp.MustCompile(`^\s*(\d+)\s*[:.)=-]\s*([1-5])\b`)
+
+// Judge asks the model to score candidate messages for the change described
+// by data against the message a human wrote for it. cfg's prompts are
+// replaced with the judge's own.
+func Judge(ctx context.Context, data Context, reference string, candidates []string, cfg Config) (Judgement, error) {
+	res := Judgement{Scores: make([]int, len(candidates))}
+	if len(candidates) == 0 {
+		return res, nil
+	}
+	cfg.SystemPrompt = judgeSystemPrompt
+	cfg.Quantity = len(candidates)
+	cfg.MaxRepairs = 0
+
+	lines, _, err := generate(ctx, cfg, buildJudgePrompt(data, reference, candidates), nil, nil, &res.Usage)
+	if err != nil {
+		return res, err
+	}
+	for _, line := range lines {
+		m := judgeLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		i, _ := strconv.Atoi(m[1])
+		score, _ := strconv.Atoi(m[2])
+		if i >= 1 && i <= len(candidates) {
+			res.Scores[i-1] = score
+		}
+	}
+	return res, nil
+}
+
+func buildJudgePrompt(data Context, reference string, candidates []string) string {
+	var b strings.Builder
+	b.WriteString("Diff (truncated when necessary):\n")
+	b.WriteString(data.Diff)
+	fmt.Fprintf(&b, "\n\nReference message:\n%s\n\nCandidates:\n", strings.TrimSpace(reference))
+	for i, c := range candidates {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, c)
+	}
+	fmt.Fprintf(&b, "\nReturn %d strings of the form \"<candidate number>: <score>\", one per candidate.\n", len(candidates))
+	b.WriteString("Respond with a JSON array of strings (no markdown, no prose).")
+	return b.String()
+}
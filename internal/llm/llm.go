@@ -13,9 +13,86 @@ import (
 // Context carries the git information we send to the LLM.
 type Context struct {
 	Branch string
+	// Source says which changes are described, such as the staged ones.
+	Source string
 	Paths  []string
-	Diff   string
-	Prefix string
+	// Files describes each changed file; when empty, Paths is listed.
+	Files []File
+	// Declarations lists how the functions, types and methods in changed
+	// source files changed, when semantic analysis is enabled.
+	Declarations []Declaration
+	Diff         string
+	Prefix       string
+}
+
+// File describes how one file changed.
+type File struct {
+	// Status is added, modified, deleted, renamed, copied, type-changed or
+	// unmerged.
+	Status string
+	Path   string
+	// OldPath is the source of a rename or copy.
+	OldPath string
+	Added   int
+	Removed int
+	Binary  bool
+	// OldMode and NewMode are set, in octal, when the mode changed.
+	OldMode string
+	NewMode string
+}
+
+// String summarizes the change on one line, such as
+// "renamed a.go -> b.go (+2 -1)" or "modified run.sh (mode 100644 -> 100755)".
+func (f File) String() string {
+	var b strings.Builder
+	b.WriteString(f.Status)
+	b.WriteByte(' ')
+	if f.OldPath != "" {
+		b.WriteString(f.OldPath + " -> ")
+	}
+	b.WriteString(f.Path)
+	var notes []string
+	if f.OldMode != "" || f.NewMode != "" {
+		notes = append(notes, fmt.Sprintf("mode %s -> %s", f.OldMode, f.NewMode))
+	}
+	if f.Binary {
+		notes = append(notes, "binary")
+	} else if f.Added > 0 || f.Removed > 0 {
+		notes = append(notes, fmt.Sprintf("+%d -%d", f.Added, f.Removed))
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(notes, ", "))
+	}
+	return b.String()
+}
+
+// Declaration describes how one declaration in a source file changed.
+type Declaration struct {
+	Path string
+	// Status is added, removed, changed (the signature changed) or
+	// modified (only the body changed).
+	Status string
+	// Kind is what is declared, such as func, method, type or class.
+	Kind string
+	Name string
+	// Old and New are the signatures before and after; Old is empty for
+	// additions and New for removals.
+	Old string
+	New string
+}
+
+// String summarizes the change, such as "added func Parse(s string) error"
+// or "changed func Run() -> func Run(ctx context.Context)".
+func (d Declaration) String() string {
+	switch d.Status {
+	case "added":
+		return "added " + d.New
+	case "removed":
+		return "removed " + d.Old
+	case "changed":
+		return "changed " + d.Old + " -> " + d.New
+	}
+	return d.Status + " " + fallback(d.New, d.Old)
 }
 
 // Config controls how we call the OpenAI API.
@@ -29,30 +106,142 @@ type Config struct {
 	MaxCompletionTokens int
 	SystemPrompt        string
 	UserPrompt          string
+
+	// MaxSubjectLength flags candidates whose first line is longer than this
+	// many characters (0 disables the check).
+	MaxSubjectLength int
+	// AllowTrailingPunctuation disables the trailing punctuation check.
+	AllowTrailingPunctuation bool
+	// Validator reports format problems with a candidate beyond the built-in
+	// checks, e.g. a disallowed Conventional Commit type or scope.
+	Validator Validator
+	// MaxRepairs bounds how many follow-up requests are sent asking the model
+	// to fix candidates that fail validation (0 disables repairs).
+	MaxRepairs int
 }
 
+// Validator returns a human-readable description of each problem found with a
+// candidate, or nothing when it is acceptable.
+type Validator func(candidate string) []string
+
 var httpClient = &http.Client{Timeout: 25 * time.Second}
 
 var ErrInvalidConfig = errors.New("llm: invalid config")
 
+// Result is the outcome of a commit message request.
+type Result struct {
+	Suggestions []string
+	// PrefixCorrections counts candidates returned by the model that did not
+	// start with Context.Prefix and had to be spliced, re-requested or dropped.
+	PrefixCorrections int
+	// PrefixDropped counts candidates removed only because they could not be
+	// made to continue Context.Prefix; those that fail other checks too would
+	// have been discarded anyway.
+	PrefixDropped int
+	// Usage is the token consumption of every request made, including repairs.
+	Usage Usage
+}
+
 // GenerateCommitMessages calls OpenAI and returns the suggested commit messages.
+// Use Generate for token usage and prefix statistics.
 func GenerateCommitMessages(ctx context.Context, data Context, cfg Config) ([]string, error) {
-	if err := validateConfig(cfg); err != nil {
-		return nil, err
+	res, err := Generate(ctx, data, cfg)
+	return res.Suggestions, err
+}
+
+// Generate requests commit messages and guarantees that every suggestion
+// continues data.Prefix. Candidates that fail validation are sent back to the
+// model for repair, up to cfg.MaxRepairs times.
+func Generate(ctx context.Context, data Context, cfg Config) (Result, error) {
+	prompt := commitPrompt(data, cfg)
+
+	var res Result
+	fix := func(msgs []string) []string {
+		out, corrected := enforcePrefix(msgs, data.Prefix)
+		res.PrefixCorrections += corrected
+		return out
 	}
-	provider, err := newProvider(cfg)
+	good, bad, err := generate(ctx, cfg, prompt, fix, candidateChecker(data, cfg), &res.Usage)
 	if err != nil {
-		return nil, err
+		return res, err
+	}
+	// Candidates that still fail validation are only used when nothing better
+	// is left, but the prefix is never negotiable.
+	kept, dropped := requirePrefix(bad, data.Prefix)
+	unprefixed := candidateChecker(Context{}, cfg)
+	for _, c := range dropped {
+		if len(unprefixed(c)) == 0 {
+			res.PrefixDropped++
+		}
+	}
+	res.Suggestions = good
+	if len(good) == 0 {
+		res.Suggestions = kept
 	}
+	return res, nil
+}
+
+// GenerateBranchNames asks the provider for branch name candidates describing
+// the same changes. Callers are expected to sanitize the results.
+func GenerateBranchNames(ctx context.Context, data Context, cfg Config) (Result, error) {
 	prompt := cfg.UserPrompt
 	if strings.TrimSpace(prompt) == "" {
-		prompt = buildPrompt(data, cfg.Quantity)
+		prompt = buildBranchPrompt(data, cfg.Quantity)
+	}
+	var res Result
+	names, _, err := generate(ctx, cfg, prompt, nil, nil, &res.Usage)
+	res.Suggestions = names
+	return res, err
+}
+
+// generate sends the prompt and, when check is set, runs the repair loop. fix
+// is applied to every batch of candidates before they are checked. It returns
+// the candidates that pass check and those that still fail after repairs.
+// Token usage of every request is added to usage.
+func generate(ctx context.Context, cfg Config, prompt string, fix func([]string) []string, check Validator, usage *Usage) (good, bad []string, err error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, nil, err
+	}
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages := initialMessages(cfg, prompt)
+	msgs, err := complete(ctx, provider, cfg, messages, usage)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fix != nil {
+		msgs = fix(msgs)
+	}
+	if check == nil {
+		return msgs, nil, nil
+	}
+	good, bad = repair(ctx, provider, cfg, messages, msgs, fix, check, usage)
+	return good, bad, nil
+}
+
+func commitPrompt(data Context, cfg Config) string {
+	if strings.TrimSpace(cfg.UserPrompt) == "" {
+		return buildPrompt(data, cfg.Quantity)
 	}
+	return cfg.UserPrompt
+}
 
-	messages := []Message{
+func initialMessages(cfg Config, prompt string) []Message {
+	return []Message{
 		{Role: "system", Content: cfg.SystemPrompt},
 		{Role: "user", Content: prompt},
 	}
+}
+
+func complete(ctx context.Context, provider Provider, cfg Config, messages []Message, usage *Usage) ([]string, error) {
+	if local, ok := provider.(localProvider); ok {
+		completion, err := local.Complete(ctx, cfg, messages)
+		usage.Add(completion.Usage)
+		return completion.Suggestions, err
+	}
 
 	req, err := provider.BuildRequest(ctx, cfg, messages)
 	if err != nil {
@@ -65,15 +254,38 @@ func GenerateCommitMessages(ctx context.Context, data Context, cfg Config) ([]st
 	}
 	defer resp.Body.Close()
 
-	return provider.ParseResponse(resp)
+	completion, err := provider.ParseResponse(resp)
+	usage.Add(completion.Usage)
+	return completion.Suggestions, err
 }
 
 func buildPrompt(data Context, max int) string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "Repository branch: %s\n", fallback(data.Branch, "unknown"))
-	fmt.Fprintf(&b, "Changed files (%d max shown):\n", len(data.Paths))
-	for _, p := range data.Paths {
-		fmt.Fprintf(&b, "- %s\n", p)
+	if data.Source != "" {
+		fmt.Fprintf(&b, "Describing: %s\n", data.Source)
+	}
+	if len(data.Files) > 0 {
+		added, removed := 0, 0
+		for _, f := range data.Files {
+			added += f.Added
+			removed += f.Removed
+		}
+		fmt.Fprintf(&b, "Changed files (%d, +%d -%d):\n", len(data.Files), added, removed)
+		for _, f := range data.Files {
+			fmt.Fprintf(&b, "- %s\n", f)
+		}
+	} else {
+		fmt.Fprintf(&b, "Changed files (%d max shown):\n", len(data.Paths))
+		for _, p := range data.Paths {
+			fmt.Fprintf(&b, "- %s\n", p)
+		}
+	}
+	if len(data.Declarations) > 0 {
+		b.WriteString("Changed declarations:\n")
+		for _, d := range data.Declarations {
+			fmt.Fprintf(&b, "- %s: %s\n", d.Path, d)
+		}
 	}
 	if trimmed := strings.TrimSpace(data.Prefix); trimmed != "" {
 		fmt.Fprintf(&b, "\nExisting commit message prefix: %s\n", trimmed)
@@ -88,6 +300,25 @@ func buildPrompt(data Context, max int) string {
 	return b.String()
 }
 
+func buildBranchPrompt(data Context, max int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Current branch: %s\n", fallback(data.Branch, "unknown"))
+	fmt.Fprintf(&b, "Changed files (%d):\n", len(data.Paths))
+	for _, p := range data.Paths {
+		fmt.Fprintf(&b, "- %s\n", p)
+	}
+	if trimmed := strings.TrimSpace(data.Prefix); trimmed != "" {
+		fmt.Fprintf(&b, "\nHint from the user: %s\n", trimmed)
+	}
+	b.WriteString("\nDiff (truncated when necessary):\n")
+	b.WriteString(data.Diff)
+	b.WriteString("\n\nReturn up to ")
+	fmt.Fprintf(&b, "%d", max)
+	b.WriteString(" git branch name suggestions using lowercase words separated by hyphens.\n")
+	b.WriteString("Respond with a JSON array of strings (no markdown, no prose).")
+	return b.String()
+}
+
 func fallback(v, alt string) string {
 	if strings.TrimSpace(v) == "" {
 		return alt
@@ -96,7 +327,7 @@ func fallback(v, alt string) string {
 }
 
 func validateConfig(cfg Config) error {
-	if strings.TrimSpace(cfg.APIKey) == "" {
+	if strings.TrimSpace(cfg.APIKey) == "" && !IsLocal(cfg.Provider) {
 		return fmt.Errorf("%w: api key is required", ErrInvalidConfig)
 	}
 	if strings.TrimSpace(cfg.Provider) == "" {
@@ -105,7 +336,7 @@ func validateConfig(cfg Config) error {
 	if strings.TrimSpace(cfg.Model) == "" {
 		return fmt.Errorf("%w: model identifier is required", ErrInvalidConfig)
 	}
-	if strings.TrimSpace(cfg.BaseURL) == "" {
+	if strings.TrimSpace(cfg.BaseURL) == "" && !IsLocal(cfg.Provider) {
 		return fmt.Errorf("%w: base URL is required", ErrInvalidConfig)
 	}
 	if strings.TrimSpace(cfg.SystemPrompt) == "" {
@@ -3,6 +3,7 @@ package llm
 import (
 	"context"
 	"errors"
+	"io"
 	"math"
 	"net/http"
 	"net/http/httptest"
@@ -90,6 +91,66 @@ func TestBuildPrompt(t *testing.T) {
 	}
 }
 
+func TestBuildPromptFiles(t *testing.T) {
+	prompt := buildPrompt(Context{
+		Paths: []string{"a.go", "b.go", "logo.png", "run.sh"},
+		Files: []File{
+			{Status: "renamed", OldPath: "a.go", Path: "b.go", Added: 2, Removed: 1},
+			{Status: "added", Path: "logo.png", Binary: true},
+			{Status: "modified", Path: "run.sh", OldMode: "100644", NewMode: "100755"},
+		},
+		Declarations: []Declaration{
+			{Path: "b.go", Status: "changed", Kind: "func", Name: "Run", Old: "func Run()", New: "func Run(n int)"},
+			{Path: "b.go", Status: "modified", Kind: "type", Name: "T", Old: "type T struct", New: "type T struct"},
+			{Path: "b.go", Status: "removed", Kind: "func", Name: "Stop", Old: "func Stop()"},
+		},
+	}, 3)
+	for _, want := range []string{
+		"Changed files (3, +2 -1):",
+		"- renamed a.go -> b.go (+2 -1)\n",
+		"- added logo.png (binary)\n",
+		"- modified run.sh (mode 100644 -> 100755)\n",
+		"Changed declarations:\n- b.go: changed func Run() -> func Run(n int)\n- b.go: modified type T struct\n- b.go: removed func Stop()\n",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("missing %q in prompt: %s", want, prompt)
+		}
+	}
+}
+
+func TestBuildBranchPrompt(t *testing.T) {
+	prompt := buildBranchPrompt(Context{Branch: "main", Paths: []string{"cmd/root.go"}, Diff: "diff", Prefix: "login"}, 4)
+	if !strings.Contains(prompt, "Current branch: main") {
+		t.Fatalf("missing branch in prompt: %s", prompt)
+	}
+	if !strings.Contains(prompt, "Hint from the user: login") {
+		t.Fatalf("missing hint in prompt: %s", prompt)
+	}
+	if !strings.Contains(prompt, "Return up to 4 git branch name suggestions") {
+		t.Fatalf("missing quantity in prompt: %s", prompt)
+	}
+}
+
+func TestGenerateBranchNames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"[\"feat/add-login\"]"}}]}`))
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{APIKey: "k", Provider: "openai", Model: "m", BaseURL: srv.URL, Temperature: 1, Quantity: 1, SystemPrompt: "s"}
+	got, err := GenerateBranchNames(context.Background(), Context{}, cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if !reflect.DeepEqual(got.Suggestions, []string{"feat/add-login"}) {
+		t.Fatalf("unexpected branch names: %v", got.Suggestions)
+	}
+}
+
 func TestGenerateCommitMessages_Success(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -120,6 +181,80 @@ func TestGenerateCommitMessages_Success(t *testing.T) {
 	}
 }
 
+func TestGenerateCommitMessages_Repair(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) == 1 {
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"[\"feat: add docs\", \"feature: add readme.\"]"}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"[\"docs: add readme\"]"}}]}`))
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{
+		APIKey:       "k",
+		Provider:     "openai",
+		Model:        "m",
+		BaseURL:      srv.URL,
+		Temperature:  1,
+		Quantity:     2,
+		SystemPrompt: "system",
+		MaxRepairs:   2,
+		Validator: func(c string) []string {
+			if strings.HasPrefix(c, "feature:") {
+				return []string{"type feature is not allowed"}
+			}
+			return nil
+		},
+	}
+
+	got, err := GenerateCommitMessages(context.Background(), Context{}, cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"feat: add docs", "docs: add readme"}) {
+		t.Fatalf("unexpected suggestions: %v", got)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("expected one repair request, got %d requests", len(bodies))
+	}
+	if !strings.Contains(bodies[1], "type feature is not allowed") || !strings.Contains(bodies[1], "ends with trailing punctuation") {
+		t.Fatalf("repair request does not quote violations: %s", bodies[1])
+	}
+}
+
+func TestGenerateCommitMessages_RepairBounded(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"[\"` + strings.Repeat("x", 20) + `\"]"}}]}`))
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{APIKey: "k", Provider: "openai", Model: "m", BaseURL: srv.URL, Temperature: 1, Quantity: 1, SystemPrompt: "s", MaxSubjectLength: 10, MaxRepairs: 2}
+	got, err := GenerateCommitMessages(context.Background(), Context{}, cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 1 request and 2 repairs, got %d", requests)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected unrepaired candidate to be kept when nothing else is left, got %v", got)
+	}
+}
+
 func TestGenerateCommitMessages_HTTPError(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad", http.StatusBadRequest)
@@ -273,3 +408,106 @@ func BenchmarkGenerateCommitMessages(b *testing.B) {
 		}
 	}
 }
+
+func TestGenerate_SumsUsageAcrossRepairs(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		content := `[\"feat: add docs\", \"feature: add readme\"]`
+		if calls > 1 {
+			content = `[\"docs: add readme\"]`
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"` + content + `"}}],"usage":{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120}}`))
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{
+		APIKey: "k", Provider: "openai", Model: "m", BaseURL: srv.URL, Quantity: 2, SystemPrompt: "s", MaxRepairs: 1,
+		Validator: func(c string) []string {
+			if strings.HasPrefix(c, "feature:") {
+				return []string{"type feature is not allowed"}
+			}
+			return nil
+		},
+	}
+	res, err := Generate(context.Background(), Context{}, cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	want := Usage{PromptTokens: 200, CompletionTokens: 40, TotalTokens: 240, Requests: 2}
+	if res.Usage != want {
+		t.Fatalf("expected usage %+v, got %+v", want, res.Usage)
+	}
+}
+
+func TestGenerate_FakeProvider(t *testing.T) {
+	cfg := Config{Provider: "fake", Model: "m", Quantity: 2, SystemPrompt: "s"}
+	data := Context{Paths: []string{"internal/llm/llm.go"}, Diff: "+x"}
+	res, err := Generate(context.Background(), data, cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	want := []string{"chore: update llm.go", "feat: extend llm.go"}
+	if !reflect.DeepEqual(res.Suggestions, want) {
+		t.Fatalf("unexpected suggestions: %v", res.Suggestions)
+	}
+	if res.Usage != (Usage{}) {
+		t.Fatalf("fake provider should not report usage, got %+v", res.Usage)
+	}
+}
+
+func TestJudge(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"[\"2: 5\", \"1: 3\", \"9: 4\"]"}}]}`))
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{APIKey: "k", Provider: "openai", Model: "m", BaseURL: srv.URL, Quantity: 5, SystemPrompt: "s"}
+	got, err := Judge(context.Background(), Context{Diff: "+x"}, "fix: handle x", []string{"chore: x", "fix: handle x", "docs: x"}, cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if !reflect.DeepEqual(got.Scores, []int{3, 5, 0}) {
+		t.Fatalf("unexpected scores: %v", got.Scores)
+	}
+	if !strings.Contains(body, "Reference message:") || !strings.Contains(body, "2. fix: handle x") {
+		t.Fatalf("judge prompt missing reference or candidates: %s", body)
+	}
+}
+
+func TestGenerateBody(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"[\"Explain the change.\"]"}}]}`))
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{APIKey: "k", Provider: "openai", Model: "m", BaseURL: srv.URL, Quantity: 5, SystemPrompt: "subject rules"}
+	got, err := GenerateBody(context.Background(), Context{Paths: []string{"a.go"}, Diff: "+x"}, "feat: add x", cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if !reflect.DeepEqual(got.Suggestions, []string{"Explain the change."}) {
+		t.Fatalf("unexpected body: %v", got.Suggestions)
+	}
+	if strings.Contains(body, "subject rules") || !strings.Contains(body, "Commit subject: feat: add x") {
+		t.Fatalf("expected the body prompts, got %s", body)
+	}
+}
@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// subjectHeader matches a type or tag header such as "fix: " or
+// "feat(api)!: " at the start of a subject.
+var subjectHeader = regexp.MustCompile(`^[\w-]+(\([^)]*\))?!?:\s`)
+
+// ContinuePrefix rewrites candidate so it starts with exactly what the user
+// typed. Case and whitespace differences are ignored when matching, and a
+// candidate that only repeats the tail of the prefix (e.g. "add docs" for the
+// prefix "feat: ad") is spliced onto it, unless it has a header of its own
+// ("fix: crash" for "feat: fix"). It reports false when the candidate cannot
+// be reconciled with the prefix.
+func ContinuePrefix(candidate, prefix string) (string, bool) {
+	if strings.TrimSpace(prefix) == "" {
+		return candidate, true
+	}
+	if n := matchFolded(candidate, prefix); n >= 0 {
+		return joinPrefix(prefix, candidate[n:]), true
+	}
+	if subjectHeader.MatchString(strings.TrimSpace(candidate)) {
+		return candidate, false
+	}
+	for _, start := range wordStarts(prefix) {
+		if n := matchFolded(candidate, prefix[start:]); n >= 0 {
+			return joinPrefix(prefix, candidate[n:]), true
+		}
+	}
+	return candidate, false
+}
+
+// enforcePrefix applies ContinuePrefix to every candidate. Candidates that
+// cannot be reconciled are returned unchanged so the repair loop can ask for
+// them again; corrected counts every candidate that did not already start with
+// the exact prefix.
+func enforcePrefix(candidates []string, prefix string) (out []string, corrected int) {
+	out = make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		fixed, ok := ContinuePrefix(c, prefix)
+		if !ok || fixed != c {
+			corrected++
+		}
+		out = append(out, fixed)
+	}
+	return normalize(out), corrected
+}
+
+// requirePrefix drops candidates that still do not continue the prefix.
+func requirePrefix(candidates []string, prefix string) (out, dropped []string) {
+	for _, c := range candidates {
+		if matchFolded(c, prefix) >= 0 {
+			out = append(out, c)
+			continue
+		}
+		dropped = append(dropped, c)
+	}
+	return out, dropped
+}
+
+// matchFolded returns how many bytes of s match want when case and whitespace
+// are ignored, or -1 when s does not start with want.
+func matchFolded(s, want string) int {
+	i := 0
+	for _, w := range want {
+		if unicode.IsSpace(w) {
+			continue
+		}
+		for i < len(s) {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			i += size
+		}
+		if i >= len(s) {
+			return -1
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if unicode.ToLower(r) != unicode.ToLower(w) {
+			return -1
+		}
+		i += size
+	}
+	return i
+}
+
+// wordStarts lists the byte offsets of every word in s after the first, so
+// the longest tail is tried first.
+func wordStarts(s string) []int {
+	var starts []int
+	prevSpace := false
+	for i, r := range s {
+		if i > 0 && prevSpace && !unicode.IsSpace(r) {
+			starts = append(starts, i)
+		}
+		prevSpace = unicode.IsSpace(r)
+	}
+	return starts
+}
+
+func joinPrefix(prefix, rest string) string {
+	if r, _ := utf8.DecodeLastRuneInString(prefix); unicode.IsSpace(r) {
+		return prefix + strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+	return prefix + rest
+}
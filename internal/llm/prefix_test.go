@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestContinuePrefix(t *testing.T) {
+	cases := []struct {
+		candidate string
+		prefix    string
+		want      string
+		ok        bool
+	}{
+		{"feat: add docs", "", "feat: add docs", true},
+		{"feat: add docs", "feat: ", "feat: add docs", true},
+		{"Feat:  Add docs", "feat: add", "feat: add docs", true},
+		{"feat:add docs", "feat: ", "feat: add docs", true},
+		{"add docs for cli", "feat(cli): ad", "feat(cli): add docs for cli", true},
+		{"docs for cli", "feat(cli): add", "docs for cli", false},
+		{"fix: handle nil", "feat: ", "fix: handle nil", false},
+		{"fix: crash on start", "feat: fix", "fix: crash on start", false},
+		{"fix(api)!: drop v1", "feat: fix", "fix(api)!: drop v1", false},
+		{"fix crash on start", "feat: fix", "feat: fix crash on start", true},
+	}
+	for _, tc := range cases {
+		got, ok := ContinuePrefix(tc.candidate, tc.prefix)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("ContinuePrefix(%q, %q) = %q, %v; want %q, %v", tc.candidate, tc.prefix, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestEnforcePrefix(t *testing.T) {
+	got, corrected := enforcePrefix([]string{"feat: add docs", "FEAT: add tests", "fix: nil"}, "feat: add")
+	if !reflect.DeepEqual(got, []string{"feat: add docs", "feat: add tests", "fix: nil"}) {
+		t.Fatalf("unexpected candidates: %v", got)
+	}
+	if corrected != 2 {
+		t.Fatalf("expected 2 corrections, got %d", corrected)
+	}
+}
+
+func TestGenerate_EnforcesPrefix(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"[\"Feat: add docs\", \"docs for cli\", \"feat: add tests\"]"}}]}`))
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{APIKey: "k", Provider: "openai", Model: "m", BaseURL: srv.URL, Temperature: 1, Quantity: 3, SystemPrompt: "s"}
+	res, err := Generate(context.Background(), Context{Prefix: "feat: add"}, cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if !reflect.DeepEqual(res.Suggestions, []string{"feat: add docs", "feat: add tests"}) {
+		t.Fatalf("unexpected suggestions: %v", res.Suggestions)
+	}
+	if res.PrefixCorrections != 2 || res.PrefixDropped != 1 {
+		t.Fatalf("unexpected report: corrections=%d dropped=%d", res.PrefixCorrections, res.PrefixDropped)
+	}
+}
+
+func TestGenerate_CountsOnlyPrefixDrops(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"[\"feat: fix flaky tests\", \"fix: crash on start\", \"refactor: rewrite the whole scheduler from scratch\", \"docs: note it.\"]"}}]}`))
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{APIKey: "k", Provider: "openai", Model: "m", BaseURL: srv.URL, Temperature: 1, Quantity: 4, SystemPrompt: "s", MaxSubjectLength: 30}
+	res, err := Generate(context.Background(), Context{Prefix: "feat: fix"}, cfg)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if !reflect.DeepEqual(res.Suggestions, []string{"feat: fix flaky tests"}) {
+		t.Fatalf("unexpected suggestions: %v", res.Suggestions)
+	}
+	// The fix candidate keeps its own type instead of being spliced, and is
+	// the only one dropped for the prefix alone: the others are too long or
+	// end in punctuation.
+	if res.PrefixDropped != 1 {
+		t.Fatalf("expected 1 prefix drop, got %d", res.PrefixDropped)
+	}
+}
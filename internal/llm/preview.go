@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Preview is the first request Generate would send for the same inputs.
+type Preview struct {
+	Method   string
+	URL      string
+	Header   http.Header // Authorization is masked
+	Body     []byte
+	Messages []Message
+}
+
+// PreviewCommitMessages builds the request Generate would send first, without
+// sending it. The API key may be empty.
+func PreviewCommitMessages(ctx context.Context, data Context, cfg Config) (Preview, error) {
+	check := cfg
+	if strings.TrimSpace(check.APIKey) == "" {
+		check.APIKey = "unset"
+	}
+	if err := validateConfig(check); err != nil {
+		return Preview{}, err
+	}
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	messages := initialMessages(cfg, commitPrompt(data, cfg))
+	req, err := provider.BuildRequest(ctx, cfg, messages)
+	if err != nil {
+		return Preview{}, err
+	}
+	var body []byte
+	if req.Body != nil {
+		defer req.Body.Close()
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return Preview{}, err
+		}
+	}
+
+	header := req.Header.Clone()
+	if auth := header.Get("Authorization"); auth != "" {
+		header.Set("Authorization", maskCredential(auth))
+	}
+	return Preview{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Header:   header,
+		Body:     body,
+		Messages: messages,
+	}, nil
+}
+
+// EstimateTokens approximates the token count of s at roughly four
+// characters per token, which is close enough for budgeting English prose
+// and code without a provider-specific tokenizer.
+func EstimateTokens(s string) int {
+	n := utf8.RuneCountInString(s)
+	return (n + 3) / 4
+}
+
+// maskCredential hides all but the last four characters of the credential in
+// an Authorization header value, keeping the scheme.
+func maskCredential(value string) string {
+	scheme, token, ok := strings.Cut(value, " ")
+	if !ok {
+		scheme, token = "", value
+	}
+	masked := strings.Repeat("*", 8)
+	if len(token) > 12 {
+		masked += token[len(token)-4:]
+	}
+	if scheme == "" {
+		return masked
+	}
+	return scheme + " " + masked
+}
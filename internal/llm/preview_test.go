@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPreviewCommitMessages(t *testing.T) {
+	oldClient := httpClient
+	httpClient = &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatalf("preview must not send a request")
+		return nil, nil
+	})}
+	defer func() { httpClient = oldClient }()
+
+	cfg := Config{
+		APIKey:       "sk-test-secret-1234",
+		Provider:     "openai",
+		Model:        "gpt-test",
+		BaseURL:      "http://example.com/v1/chat/completions",
+		Quantity:     3,
+		SystemPrompt: "system",
+	}
+	p, err := PreviewCommitMessages(context.Background(), Context{Paths: []string{"a.go"}, Diff: "diff"}, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Method != http.MethodPost || p.URL != cfg.BaseURL {
+		t.Fatalf("unexpected request line: %s %s", p.Method, p.URL)
+	}
+	if got := p.Header.Get("Authorization"); got != "Bearer ********1234" {
+		t.Fatalf("expected masked authorization, got %q", got)
+	}
+
+	var body openAIRequest
+	if err := json.Unmarshal(p.Body, &body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if body.Model != "gpt-test" || len(body.Messages) != 2 || !strings.Contains(body.Messages[1].Content, "a.go") {
+		t.Fatalf("unexpected body: %+v", body)
+	}
+	if strings.Contains(string(p.Body), "secret") {
+		t.Fatalf("body leaks the API key")
+	}
+}
+
+func TestPreviewCommitMessages_NoAPIKey(t *testing.T) {
+	cfg := Config{Provider: "openai", Model: "m", BaseURL: "http://x", Quantity: 1, SystemPrompt: "s"}
+	p, err := PreviewCommitMessages(context.Background(), Context{}, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := p.Header.Get("Authorization"); got != "Bearer ********" {
+		t.Fatalf("unexpected authorization %q", got)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if got := EstimateTokens(""); got != 0 {
+		t.Fatalf("expected 0, got %d", got)
+	}
+	if got := EstimateTokens(strings.Repeat("a", 9)); got != 3 {
+		t.Fatalf("expected 3, got %d", got)
+	}
+}
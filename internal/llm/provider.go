@@ -23,7 +23,42 @@ type ProviderCapabilities struct {
 type Provider interface {
 	Capabilities() ProviderCapabilities
 	BuildRequest(ctx context.Context, cfg Config, messages []Message) (*http.Request, error)
-	ParseResponse(resp *http.Response) ([]string, error)
+	ParseResponse(resp *http.Response) (Completion, error)
+}
+
+// localProvider is implemented by providers that answer without sending an
+// HTTP request.
+type localProvider interface {
+	Complete(ctx context.Context, cfg Config, messages []Message) (Completion, error)
+}
+
+// Completion is a parsed provider response.
+type Completion struct {
+	Suggestions []string
+	Usage       Usage
+}
+
+// Usage is the token consumption reported by the provider. In a Result it is
+// summed over every request made, including repairs.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Requests         int
+}
+
+// Add accumulates o into u.
+func (u *Usage) Add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+	u.Requests += o.Requests
+}
+
+// IsLocal reports whether the named provider answers without network access
+// or credentials.
+func IsLocal(provider string) bool {
+	return strings.EqualFold(strings.TrimSpace(provider), "fake")
 }
 
 func newProvider(cfg Config) (Provider, error) {
@@ -35,6 +70,8 @@ func newProvider(cfg Config) (Provider, error) {
 	switch name {
 	case "openai":
 		return openAIProvider{}, nil
+	case "fake":
+		return fakeProvider{}, nil
 	default:
 		return nil, fmt.Errorf("llm: unsupported provider %q", cfg.Provider)
 	}
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// fakeURL is the request URL reported for the fake provider, which never
+// sends it.
+const fakeURL = "fake://diffscribe"
+
+// fakeProvider answers locally with suggestions derived from the changed
+// files listed in the prompt. It needs no API key or network access and
+// always returns the same output for the same prompt, which makes it useful
+// for tests and CI runs of diffscribe eval.
+type fakeProvider struct{}
+
+var fakeTemplates = []string{
+	"chore: update %s",
+	"feat: extend %s",
+	"fix: correct %s",
+	"refactor: simplify %s",
+	"docs: describe %s",
+}
+
+func (fakeProvider) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{}
+}
+
+func (fakeProvider) BuildRequest(ctx context.Context, cfg Config, messages []Message) (*http.Request, error) {
+	body, err := json.Marshal(struct {
+		Model    string    `json:"model"`
+		Messages []Message `json:"messages"`
+	}{cfg.Model, messages})
+	if err != nil {
+		return nil, err
+	}
+	return http.NewRequestWithContext(ctx, http.MethodPost, fakeURL, bytes.NewReader(body))
+}
+
+func (fakeProvider) ParseResponse(resp *http.Response) (Completion, error) {
+	return Completion{}, errors.New("fake: responses are produced locally")
+}
+
+// Complete implements localProvider. Usage is left empty so fake runs are
+// never billed in the usage ledger.
+func (fakeProvider) Complete(ctx context.Context, cfg Config, messages []Message) (Completion, error) {
+	subject := fakeSubject(messages)
+	n := cfg.Quantity
+	if n <= 0 {
+		n = 1
+	}
+	n = min(n, len(fakeTemplates))
+	suggestions := make([]string, n)
+	for i := range suggestions {
+		suggestions[i] = strings.Replace(fakeTemplates[i], "%s", subject, 1)
+	}
+	return Completion{Suggestions: suggestions}, nil
+}
+
+// fakeSubject names the first file listed as "- path" in the prompt, or
+// "changes" when there is none.
+func fakeSubject(messages []Message) string {
+	for _, m := range messages {
+		if m.Role != "user" {
+			continue
+		}
+		for _, line := range strings.Split(m.Content, "\n") {
+			if p, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok && p != "" && !strings.ContainsAny(p, " \t") {
+				return path.Base(p)
+			}
+		}
+	}
+	return "changes"
+}
@@ -48,22 +48,32 @@ func (openAIProvider) BuildRequest(ctx context.Context, cfg Config, messages []M
 	return req, nil
 }
 
-func (openAIProvider) ParseResponse(resp *http.Response) ([]string, error) {
+func (openAIProvider) ParseResponse(resp *http.Response) (Completion, error) {
 	if resp.StatusCode >= 300 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("openai: %s: %s", resp.Status, strings.TrimSpace(string(bodyBytes)))
+		return Completion{}, fmt.Errorf("openai: %s: %s", resp.Status, strings.TrimSpace(string(bodyBytes)))
 	}
 
 	var parsed openAIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return nil, err
+		return Completion{}, err
+	}
+	usage := Usage{
+		PromptTokens:     parsed.Usage.PromptTokens,
+		CompletionTokens: parsed.Usage.CompletionTokens,
+		TotalTokens:      parsed.Usage.TotalTokens,
+		Requests:         1,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	}
 	if len(parsed.Choices) == 0 {
-		return nil, errors.New("openai: empty response")
+		return Completion{Usage: usage}, errors.New("openai: empty response")
 	}
 
 	content := strings.TrimSpace(parsed.Choices[0].Message.Content)
-	return parseSuggestions(content)
+	suggestions, err := parseSuggestions(content)
+	return Completion{Suggestions: suggestions, Usage: usage}, err
 }
 
 type openAIRequest struct {
@@ -85,6 +95,11 @@ type openAIResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
 }
 
 type openAIResponseFormat struct {
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// candidateChecker combines the built-in checks with cfg.Validator.
+func candidateChecker(data Context, cfg Config) Validator {
+	prefix := strings.TrimSpace(data.Prefix)
+	return func(candidate string) []string {
+		var problems []string
+		subject, _, _ := strings.Cut(candidate, "\n")
+		if cfg.MaxSubjectLength > 0 {
+			if n := utf8.RuneCountInString(subject); n > cfg.MaxSubjectLength {
+				problems = append(problems, fmt.Sprintf("first line is %d characters, limit is %d", n, cfg.MaxSubjectLength))
+			}
+		}
+		if prefix != "" && matchFolded(candidate, prefix) < 0 {
+			problems = append(problems, fmt.Sprintf("does not start with the prefix %q", prefix))
+		}
+		if !cfg.AllowTrailingPunctuation && strings.ContainsAny(lastRune(subject), ".,;:") {
+			problems = append(problems, "ends with trailing punctuation")
+		}
+		if cfg.Validator != nil {
+			problems = append(problems, cfg.Validator(candidate)...)
+		}
+		return problems
+	}
+}
+
+// repair sends candidates that fail check back to the model, quoting the
+// problems, until they pass or cfg.MaxRepairs follow-ups have been sent.
+func repair(ctx context.Context, provider Provider, cfg Config, messages []Message, msgs []string, fix func([]string) []string, check Validator, usage *Usage) (good, bad []string) {
+	good, bad = partition(msgs, check)
+	for attempt := 0; attempt < cfg.MaxRepairs && len(bad) > 0; attempt++ {
+		reply, _ := json.Marshal(msgs)
+		messages = append(messages,
+			Message{Role: "assistant", Content: string(reply)},
+			Message{Role: "user", Content: buildRepairPrompt(bad, check)},
+		)
+		fixed, err := complete(ctx, provider, cfg, messages, usage)
+		if err != nil {
+			break
+		}
+		if fix != nil {
+			fixed = fix(fixed)
+		}
+		msgs = fixed
+		newGood, newBad := partition(fixed, check)
+		good = append(good, newGood...)
+		bad = newBad
+	}
+
+	return normalize(good), normalize(bad)
+}
+
+func partition(msgs []string, check Validator) (good, bad []string) {
+	for _, m := range msgs {
+		if len(check(m)) == 0 {
+			good = append(good, m)
+		} else {
+			bad = append(bad, m)
+		}
+	}
+	return good, bad
+}
+
+func buildRepairPrompt(bad []string, check Validator) string {
+	var b strings.Builder
+	b.WriteString("Some suggestions do not follow the formatting rules:\n")
+	for _, m := range bad {
+		fmt.Fprintf(&b, "- %q: %s\n", m, strings.Join(check(m), "; "))
+	}
+	fmt.Fprintf(&b, "\nRewrite those %d suggestions so they fix every listed problem while keeping their meaning.\n", len(bad))
+	b.WriteString("Respond with a JSON array of the corrected strings only.")
+	return b.String()
+}
+
+func lastRune(s string) string {
+	r, size := utf8.DecodeLastRuneInString(s)
+	if size == 0 {
+		return ""
+	}
+	return string(r)
+}
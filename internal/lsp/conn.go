@@ -0,0 +1,151 @@
+// Package lsp implements the parts of the Language Server Protocol used by
+// diffscribe lsp: JSON-RPC 2.0 messages framed with Content-Length headers,
+// and the protocol types exchanged for commit message buffers.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeRequestCancelled answers a request the client cancelled with
+	// $/cancelRequest.
+	CodeRequestCancelled = -32800
+)
+
+// Message is an incoming request, notification or response. Requests carry an
+// ID and a Method, notifications only a Method, and responses only an ID.
+type Message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// IsRequest reports whether m expects a response.
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("lsp: %s (%d)", e.Message, e.Code)
+}
+
+// Conn reads and writes framed messages. Writes may come from several
+// goroutines.
+type Conn struct {
+	r      *bufio.Reader
+	mu     sync.Mutex
+	w      io.Writer
+	nextID int
+}
+
+// NewConn returns a connection reading from r and writing to w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: bufio.NewReader(r), w: w}
+}
+
+// Read returns the next message. It returns io.EOF when the input ends
+// cleanly between messages.
+func (c *Conn) Read() (*Message, error) {
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("lsp: invalid header: %w", err)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("lsp: invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, fmt.Errorf("lsp: short message: %w", err)
+	}
+	var m Message
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, &Error{Code: CodeParseError, Message: err.Error()}
+	}
+	return &m, nil
+}
+
+// Reply answers the request with the given ID. A nil result is sent as null.
+func (c *Conn) Reply(id json.RawMessage, result any) error {
+	return c.write(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  any             `json:"result"`
+	}{"2.0", id, result})
+}
+
+// ReplyError answers the request with the given ID with an error.
+func (c *Conn) ReplyError(id json.RawMessage, code int, message string) error {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return c.write(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   Error           `json:"error"`
+	}{"2.0", id, Error{Code: code, Message: message}})
+}
+
+// Notify sends a notification.
+func (c *Conn) Notify(method string, params any) error {
+	return c.write(struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{"2.0", method, params})
+}
+
+// Call sends a request to the client. The response arrives through Read
+// like any other message; diffscribe does not wait for it.
+func (c *Conn) Call(method string, params any) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.mu.Unlock()
+	return c.write(struct {
+		JSONRPC string `json:"jsonrpc"`
+		ID      string `json:"id"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{"2.0", "diffscribe-" + strconv.Itoa(id), method, params})
+}
+
+func (c *Conn) write(v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
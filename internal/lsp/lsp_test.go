@@ -0,0 +1,99 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func frame(body string) string {
+	return "Content-Length: " + itoa(len(body)) + "\r\n\r\n" + body
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func TestConnRead(t *testing.T) {
+	in := frame(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`) +
+		"Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n" +
+		frame(`{"jsonrpc":"2.0","method":"initialized"}`)
+	c := NewConn(strings.NewReader(in), io.Discard)
+
+	m, err := c.Read()
+	if err != nil || m.Method != "initialize" || !m.IsRequest() {
+		t.Fatalf("unexpected first message %+v (%v)", m, err)
+	}
+	m, err = c.Read()
+	if err != nil || m.Method != "initialized" || m.IsRequest() {
+		t.Fatalf("unexpected second message %+v (%v)", m, err)
+	}
+	if _, err := c.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestConnReadRejectsBadFrames(t *testing.T) {
+	c := NewConn(strings.NewReader("Content-Length: nope\r\n\r\n{}"), io.Discard)
+	if _, err := c.Read(); err == nil {
+		t.Fatalf("expected an error for a bad length")
+	}
+	c = NewConn(strings.NewReader(frame(`{oops`)), io.Discard)
+	var rpcErr *Error
+	if _, err := c.Read(); !errors.As(err, &rpcErr) || rpcErr.Code != CodeParseError {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+}
+
+func TestConnWrite(t *testing.T) {
+	var out bytes.Buffer
+	c := NewConn(strings.NewReader(""), &out)
+	_ = c.Reply(json.RawMessage("7"), nil)
+	_ = c.ReplyError(nil, CodeMethodNotFound, "nope")
+	_ = c.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: "file:///x", Diagnostics: []Diagnostic{}})
+
+	r := NewConn(&out, io.Discard)
+	var bodies []string
+	for {
+		m, err := r.Read()
+		if err != nil {
+			break
+		}
+		b, _ := json.Marshal(m)
+		bodies = append(bodies, string(b))
+	}
+	want := []string{
+		`{"id":7,"result":null}`,
+		`{"id":null,"error":{"code":-32601,"message":"nope"}}`,
+		`{"method":"textDocument/publishDiagnostics","params":{"uri":"file:///x","diagnostics":[]}}`,
+	}
+	if strings.Join(bodies, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected messages:\n%s", strings.Join(bodies, "\n"))
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	line := "feat: 🎉 add"
+	if n := UTF16Len(line); n != 12 {
+		t.Fatalf("expected 12 UTF-16 units, got %d", n)
+	}
+	if off := ByteOffset(line, 8); line[:off] != "feat: 🎉" {
+		t.Fatalf("unexpected prefix %q", line[:off])
+	}
+	if off := ByteOffset(line, 99); off != len(line) {
+		t.Fatalf("expected offset to clamp, got %d", off)
+	}
+}
+
+func TestURIToPath(t *testing.T) {
+	if got := URIToPath("file:///repo/.git/COMMIT%20EDITMSG"); got != "/repo/.git/COMMIT EDITMSG" {
+		t.Fatalf("unexpected path %q", got)
+	}
+	if got := URIToPath("untitled:1"); got != "untitled:1" {
+		t.Fatalf("expected non-file URI unchanged, got %q", got)
+	}
+}
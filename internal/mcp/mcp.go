@@ -0,0 +1,191 @@
+// Package mcp implements a Model Context Protocol server that exposes tools
+// over stdio: one JSON-RPC 2.0 message per line in each direction.
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ProtocolVersion is the newest protocol revision the server speaks.
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions are the revisions the server accepts from a client, in
+// addition to ProtocolVersion.
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Tool describes a tool and the function that runs it.
+type Tool struct {
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description"`
+	// InputSchema is the JSON Schema of the arguments object.
+	InputSchema map[string]any `json:"inputSchema"`
+	// Handler receives the raw arguments object. Its error is returned to
+	// the client as a failed tool call rather than a protocol error.
+	Handler func(args json.RawMessage) (Result, error) `json:"-"`
+}
+
+// Content is a block of tool output. diffscribe only produces text.
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Result is the outcome of a tool call.
+type Result struct {
+	Content []Content `json:"content"`
+	// StructuredContent repeats the result as a JSON object for clients
+	// that parse it.
+	StructuredContent any  `json:"structuredContent,omitempty"`
+	IsError           bool `json:"isError,omitempty"`
+}
+
+// TextResult returns a result holding text and its structured form.
+func TextResult(text string, structured any) Result {
+	return Result{Content: []Content{{Type: "text", Text: text}}, StructuredContent: structured}
+}
+
+// Server answers MCP requests for a fixed set of tools.
+type Server struct {
+	Name    string
+	Version string
+	// Instructions tells the client how the tools are meant to be used.
+	Instructions string
+	Tools        []Tool
+}
+
+type message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// Serve reads requests from r and writes responses to w until r ends.
+// Requests are answered in order.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var m message
+		if err := json.Unmarshal(line, &m); err != nil {
+			if err := enc.Encode(errorResponse(nil, &rpcError{Code: CodeParseError, Message: err.Error()})); err != nil {
+				return err
+			}
+			continue
+		}
+		if m.Method == "" || len(m.ID) == 0 {
+			// Notifications and responses need no answer.
+			continue
+		}
+		result, err := s.handle(m)
+		var resp any
+		if err != nil {
+			resp = errorResponse(m.ID, err)
+		} else {
+			resp = struct {
+				JSONRPC string          `json:"jsonrpc"`
+				ID      json.RawMessage `json:"id"`
+				Result  any             `json:"result"`
+			}{"2.0", m.ID, result}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func errorResponse(id json.RawMessage, err error) any {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	e, ok := err.(*rpcError)
+	if !ok {
+		e = &rpcError{Code: CodeInternalError, Message: err.Error()}
+	}
+	return struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   *rpcError       `json:"error"`
+	}{"2.0", id, e}
+}
+
+func (s *Server) handle(m message) (any, error) {
+	switch m.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(m.Params, &p)
+		version := ProtocolVersion
+		if slices.Contains(supportedVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]string{"name": s.Name, "version": s.Version},
+			"instructions":    s.Instructions,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		tools := s.Tools
+		if tools == nil {
+			tools = []Tool{}
+		}
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, &rpcError{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		for _, t := range s.Tools {
+			if t.Name != p.Name {
+				continue
+			}
+			args := p.Arguments
+			if len(args) == 0 || string(args) == "null" {
+				args = json.RawMessage("{}")
+			}
+			res, err := t.Handler(args)
+			if err != nil {
+				return Result{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+			}
+			if res.Content == nil {
+				res.Content = []Content{}
+			}
+			return res, nil
+		}
+		return nil, &rpcError{Code: CodeInvalidParams, Message: fmt.Sprintf("unknown tool %q", p.Name)}
+	}
+	return nil, &rpcError{Code: CodeMethodNotFound, Message: "method not found: " + m.Method}
+}
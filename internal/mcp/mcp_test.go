@@ -0,0 +1,108 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func serve(t *testing.T, s *Server, requests ...string) []map[string]any {
+	t.Helper()
+	var out bytes.Buffer
+	if err := s.Serve(strings.NewReader(strings.Join(requests, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	var responses []map[string]any
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var m map[string]any
+		if err := dec.Decode(&m); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		responses = append(responses, m)
+	}
+	return responses
+}
+
+func testServer() *Server {
+	return &Server{
+		Name:    "test",
+		Version: "1",
+		Tools: []Tool{{
+			Name:        "echo",
+			Description: "Echo the text argument.",
+			InputSchema: map[string]any{"type": "object"},
+			Handler: func(args json.RawMessage) (Result, error) {
+				var in struct {
+					Text string `json:"text"`
+				}
+				if err := json.Unmarshal(args, &in); err != nil {
+					return Result{}, err
+				}
+				if in.Text == "" {
+					return Result{}, errors.New("text is required")
+				}
+				return TextResult(in.Text, map[string]string{"text": in.Text}), nil
+			},
+		}},
+	}
+}
+
+func TestServeInitialize(t *testing.T) {
+	resp := serve(t, testServer(),
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"ping"}`,
+	)
+	if len(resp) != 3 {
+		t.Fatalf("expected 3 responses (none for the notification), got %d", len(resp))
+	}
+	if v := resp[0]["result"].(map[string]any)["protocolVersion"]; v != "2024-11-05" {
+		t.Fatalf("expected the client's supported version, got %v", v)
+	}
+	if v := resp[1]["result"].(map[string]any)["protocolVersion"]; v != ProtocolVersion {
+		t.Fatalf("expected the server's version for an unknown one, got %v", v)
+	}
+}
+
+func TestServeTools(t *testing.T) {
+	resp := serve(t, testServer(),
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"nope"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"resources/list"}`,
+		`{not json`,
+	)
+	if len(resp) != 6 {
+		t.Fatalf("expected 6 responses, got %d", len(resp))
+	}
+
+	tools := resp[0]["result"].(map[string]any)["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["name"] != "echo" {
+		t.Fatalf("unexpected tools %v", tools)
+	}
+
+	ok := resp[1]["result"].(map[string]any)
+	if ok["isError"] != nil || ok["content"].([]any)[0].(map[string]any)["text"] != "hi" {
+		t.Fatalf("unexpected result %v", ok)
+	}
+	if ok["structuredContent"].(map[string]any)["text"] != "hi" {
+		t.Fatalf("unexpected structured content %v", ok)
+	}
+
+	failed := resp[2]["result"].(map[string]any)
+	if failed["isError"] != true || failed["content"].([]any)[0].(map[string]any)["text"] != "text is required" {
+		t.Fatalf("expected a failed tool call, got %v", failed)
+	}
+
+	for i, code := range map[int]float64{3: CodeInvalidParams, 4: CodeMethodNotFound, 5: CodeParseError} {
+		e, _ := resp[i]["error"].(map[string]any)
+		if e == nil || e["code"] != code {
+			t.Fatalf("response %d: expected error %v, got %v", i, code, resp[i])
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package semantic
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// goAnalyzer lists the exported functions, methods and types of a Go file.
+type goAnalyzer struct{}
+
+func (goAnalyzer) Language() string { return "go" }
+
+func (goAnalyzer) Match(path string) bool { return strings.HasSuffix(path, ".go") }
+
+func (goAnalyzer) Declarations(src []byte) ([]Decl, error) {
+	fset := token.NewFileSet()
+	// Without comments, edits to doc comments do not count as changes.
+	f, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	print := func(node any) string {
+		var b bytes.Buffer
+		_ = printer.Fprint(&b, fset, node)
+		return b.String()
+	}
+
+	var decls []Decl
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			d := Decl{Kind: "func", Name: decl.Name.Name}
+			header := &ast.FuncDecl{Name: decl.Name, Type: decl.Type}
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				recv := receiverType(decl.Recv.List[0].Type)
+				if !ast.IsExported(recv) {
+					continue
+				}
+				d.Kind, d.Name = "method", recv+"."+decl.Name.Name
+				// Leave out the receiver's name, which callers never see.
+				header.Recv = &ast.FieldList{List: []*ast.Field{{Type: decl.Recv.List[0].Type}}}
+			}
+			d.Signature = oneLine(print(header))
+			if decl.Body != nil {
+				d.Body = print(decl.Body)
+			}
+			decls = append(decls, d)
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				if !spec.Name.IsExported() {
+					continue
+				}
+				decls = append(decls, Decl{
+					Kind:      "type",
+					Name:      spec.Name.Name,
+					Signature: "type " + oneLine(print(&ast.TypeSpec{Name: spec.Name, TypeParams: spec.TypeParams, Assign: spec.Assign, Type: typeSummary(spec.Type)})),
+					Body:      print(spec.Type),
+				})
+			}
+		}
+	}
+	return decls, nil
+}
+
+// receiverType returns the name of a method's receiver type, without
+// pointers and type parameters.
+func receiverType(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// typeSummary stands in for struct and interface types, whose members are
+// compared as the body instead of being spelled out in the signature.
+func typeSummary(expr ast.Expr) ast.Expr {
+	switch expr.(type) {
+	case *ast.StructType:
+		return ast.NewIdent("struct")
+	case *ast.InterfaceType:
+		return ast.NewIdent("interface")
+	}
+	return expr
+}
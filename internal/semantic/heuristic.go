@@ -0,0 +1,259 @@
+package semantic
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// The Python and TypeScript analyzers read declarations line by line rather
+// than parsing the language: a declaration must start on its own line, and
+// strings or comments that hold brackets can mislead them. That is enough
+// for the common shape of source files and keeps diffscribe free of
+// language toolchains.
+
+// pythonAnalyzer lists the public functions, classes and methods of a
+// Python file: those not starting with an underscore, plus dunder methods
+// such as __init__.
+type pythonAnalyzer struct{}
+
+var (
+	pythonDef   = regexp.MustCompile(`^(\s*)(?:async\s+)?def\s+([A-Za-z_]\w*)\s*\(`)
+	pythonClass = regexp.MustCompile(`^class\s+([A-Za-z_]\w*)`)
+)
+
+func (pythonAnalyzer) Language() string { return "python" }
+
+func (pythonAnalyzer) Match(name string) bool {
+	ext := path.Ext(name)
+	return ext == ".py" || ext == ".pyi"
+}
+
+func (pythonAnalyzer) Declarations(src []byte) ([]Decl, error) {
+	lines := strings.Split(string(src), "\n")
+	var decls []Decl
+	// class is the enclosing top-level class, and classIndent the
+	// indentation of its members.
+	class, classIndent := "", ""
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if indent == "" {
+			class = ""
+		} else if class != "" && classIndent == "" {
+			classIndent = indent
+		}
+
+		if m := pythonClass.FindStringSubmatch(line); m != nil {
+			class, classIndent = m[1], ""
+			if pythonPublic(m[1]) {
+				// Methods are listed on their own, so only the header counts.
+				decls = append(decls, Decl{Kind: "class", Name: m[1], Signature: header(lines, i, ":")})
+			}
+			continue
+		}
+		m := pythonDef.FindStringSubmatch(line)
+		if m == nil || !pythonPublic(m[2]) {
+			continue
+		}
+		d := Decl{Kind: "func", Name: m[2], Signature: header(lines, i, ":"), Body: indentedBlock(lines, i)}
+		switch {
+		case m[1] == "":
+		case class != "" && m[1] == classIndent && pythonPublic(class):
+			d.Kind, d.Name = "method", class+"."+m[2]
+		default:
+			// A nested function or a method of a private class.
+			continue
+		}
+		decls = append(decls, d)
+	}
+	return decls, nil
+}
+
+func pythonPublic(name string) bool {
+	return !strings.HasPrefix(name, "_") || (len(name) > 4 && strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__"))
+}
+
+// indentedBlock returns the lines from start up to the next line that is
+// indented no deeper than it, on one line so that reflowing does not count
+// as a change.
+func indentedBlock(lines []string, start int) string {
+	depth := len(lines[start]) - len(strings.TrimLeft(lines[start], " \t"))
+	block := []string{strings.TrimSpace(lines[start])}
+	for _, line := range lines[start+1:] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if len(line)-len(strings.TrimLeft(line, " \t")) <= depth {
+			break
+		}
+		block = append(block, trimmed)
+	}
+	return oneLine(strings.Join(block, " "))
+}
+
+// typeScriptAnalyzer lists the top-level functions, classes, interfaces and
+// type aliases of a TypeScript or JavaScript file, exported or not, and the
+// methods of its top-level classes that are not private.
+type typeScriptAnalyzer struct{}
+
+var (
+	tsFunction = regexp.MustCompile(`^(?:export\s+(?:default\s+)?)?(?:declare\s+)?(?:async\s+)?function\b\s*\*?\s*([A-Za-z_$][\w$]*)`)
+	tsArrow    = regexp.MustCompile(`^(?:export\s+)?(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*(?::[^=]*)?=\s*(?:async\b\s*)?(?:function\b|\(|<|[A-Za-z_$][\w$]*\s*=>)`)
+	tsClass    = regexp.MustCompile(`^(?:export\s+(?:default\s+)?)?(?:declare\s+)?(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`)
+	tsType     = regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?(interface|type)\s+([A-Za-z_$][\w$]*)`)
+	tsMethod   = regexp.MustCompile(`^\s+((?:(?:public|protected|static|async|readonly|override|abstract|get|set)\s+)*)\*?\s*([A-Za-z_$][\w$]*)\s*(?:<[^>]*>)?\s*\(`)
+)
+
+// tsKeywords start statements that look like method declarations.
+var tsKeywords = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "function": true, "with": true}
+
+func (typeScriptAnalyzer) Language() string { return "typescript" }
+
+func (typeScriptAnalyzer) Match(name string) bool {
+	switch path.Ext(name) {
+	case ".ts", ".tsx", ".mts", ".cts", ".js", ".jsx", ".mjs", ".cjs":
+		return true
+	}
+	return false
+}
+
+func (typeScriptAnalyzer) Declarations(src []byte) ([]Decl, error) {
+	lines := strings.Split(string(src), "\n")
+	var decls []Decl
+	class, depth := "", 0
+	for i, line := range lines {
+		switch {
+		case depth == 0:
+			// A class's opening brace may follow on the next line.
+			if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+				class = ""
+			}
+			if m := tsFunction.FindStringSubmatch(line); m != nil {
+				decls = append(decls, Decl{Kind: "function", Name: m[1], Signature: header(lines, i, "{;"), Body: bracedBlock(lines, i)})
+			} else if m := tsArrow.FindStringSubmatch(line); m != nil {
+				decls = append(decls, Decl{Kind: "function", Name: m[1], Signature: arrowHeader(lines, i), Body: bracedBlock(lines, i)})
+			} else if m := tsClass.FindStringSubmatch(line); m != nil {
+				class = m[1]
+				decls = append(decls, Decl{Kind: "class", Name: m[1], Signature: header(lines, i, "{")})
+			} else if m := tsType.FindStringSubmatch(line); m != nil {
+				decls = append(decls, Decl{Kind: m[1], Name: m[2], Signature: header(lines, i, "{="), Body: bracedBlock(lines, i)})
+			}
+		case depth == 1 && class != "":
+			m := tsMethod.FindStringSubmatch(line)
+			if m == nil || tsKeywords[m[2]] {
+				break
+			}
+			modifiers := strings.Fields(m[1])
+			if containsWord(modifiers, "get") || containsWord(modifiers, "set") {
+				m[2] = modifiers[len(modifiers)-1] + " " + m[2]
+			}
+			decls = append(decls, Decl{Kind: "method", Name: class + "." + m[2], Signature: header(lines, i, "{;"), Body: bracedBlock(lines, i)})
+		}
+		depth = max(depth+braceDelta(line), 0)
+	}
+	return decls, nil
+}
+
+func containsWord(words []string, w string) bool {
+	for _, x := range words {
+		if x == w {
+			return true
+		}
+	}
+	return false
+}
+
+// arrowHeader is the header of a function assigned to a variable, up to
+// and including its arrow.
+func arrowHeader(lines []string, start int) string {
+	text := strings.Join(lines[start:min(start+maxHeaderLines, len(lines))], "\n")
+	if i := strings.Index(text, "=>"); i >= 0 {
+		return oneLine(text[:i+2])
+	}
+	return header(lines, start, "{;")
+}
+
+// maxHeaderLines bounds how far a declaration's header is followed.
+const maxHeaderLines = 20
+
+// header joins the lines from start up to the first of the stop characters
+// found outside brackets, excluding it.
+func header(lines []string, start int, stop string) string {
+	var b strings.Builder
+	depth, prev := 0, rune(0)
+	for _, line := range lines[start:min(start+maxHeaderLines, len(lines))] {
+		for _, r := range line {
+			switch {
+			case r == '(' || r == '[' || r == '<' && depth > 0:
+				depth++
+			// The > of an arrow (=> or ->) closes nothing.
+			case r == ')' || r == ']' || r == '>' && depth > 0 && prev != '=' && prev != '-':
+				depth--
+			case depth <= 0 && strings.ContainsRune(stop, r):
+				return oneLine(b.String())
+			}
+			b.WriteRune(r)
+			prev = r
+		}
+		b.WriteByte('\n')
+	}
+	return oneLine(b.String())
+}
+
+// bracedBlock returns the lines from start until its braces balance, on one
+// line like indentedBlock. When no brace opens, the block ends with the first
+// line that does not end in an operator or open bracket continuing the
+// statement.
+func bracedBlock(lines []string, start int) string {
+	var block []string
+	depth, opened := 0, false
+	for _, line := range lines[start:] {
+		trimmed := strings.TrimSpace(line)
+		block = append(block, trimmed)
+		depth += braceDelta(line)
+		if strings.Contains(line, "{") {
+			opened = true
+		}
+		if opened && depth <= 0 || !opened && !continued(trimmed) {
+			break
+		}
+	}
+	return oneLine(strings.Join(block, " "))
+}
+
+func continued(line string) bool {
+	return line == "" || strings.ContainsAny(line[len(line)-1:], "=(,|&<:?+-*/") || strings.HasSuffix(line, "=>")
+}
+
+// braceDelta counts the braces a line opens minus those it closes, skipping
+// string literals and line comments.
+func braceDelta(line string) int {
+	delta := 0
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '/' && strings.HasPrefix(line[i:], "//"):
+			return delta
+		case r == '{':
+			delta++
+		case r == '}':
+			delta--
+		}
+	}
+	return delta
+}
@@ -0,0 +1,182 @@
+// Package semantic summarizes how the declarations in a changed source file
+// changed, such as an exported function gaining a parameter, so the model
+// sees more than diff hunks without context. Each language is handled by an
+// Analyzer: Go files are parsed with go/parser, while Python and TypeScript
+// are read with line-based heuristics.
+package semantic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change statuses.
+const (
+	StatusAdded   = "added"
+	StatusRemoved = "removed"
+	// StatusChanged means the signature changed.
+	StatusChanged = "changed"
+	// StatusModified means only the body changed.
+	StatusModified = "modified"
+)
+
+// Decl is a declaration found in a source file.
+type Decl struct {
+	// Kind is what is declared, such as func, method, type or class.
+	Kind string
+	// Name identifies the declaration within the file; methods are
+	// qualified by their type, as in Client.Close.
+	Name string
+	// Signature is the declaration's header on one line, such as
+	// "func Parse(s string) (Config, error)".
+	Signature string
+	// Body is compared to notice changes that keep the signature.
+	Body string
+}
+
+// Change describes how one declaration changed.
+type Change struct {
+	Path   string
+	Status string
+	Kind   string
+	Name   string
+	// Old and New are the signatures before and after; Old is empty for
+	// additions and New for removals.
+	Old string
+	New string
+}
+
+// Analyzer finds the declarations in one language's source files.
+type Analyzer interface {
+	// Language names the language, as listed in semantic.languages.
+	Language() string
+	// Match reports whether path is a source file in the language.
+	Match(path string) bool
+	// Declarations lists the declarations in src that other code can use,
+	// in source order.
+	Declarations(src []byte) ([]Decl, error)
+}
+
+var analyzers []Analyzer
+
+// Register adds an analyzer. Analyzers registered later are consulted
+// first, so they can take over extensions handled by the built-in ones.
+func Register(a Analyzer) {
+	analyzers = append([]Analyzer{a}, analyzers...)
+}
+
+func init() {
+	Register(typeScriptAnalyzer{})
+	Register(pythonAnalyzer{})
+	Register(goAnalyzer{})
+}
+
+// Languages lists the registered languages, sorted.
+func Languages() []string {
+	var names []string
+	for _, a := range analyzers {
+		names = append(names, a.Language())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the analyzers for the named languages, or all of them when
+// none are named.
+func Select(languages ...string) ([]Analyzer, error) {
+	if len(languages) == 0 {
+		return analyzers, nil
+	}
+	var selected []Analyzer
+	for _, name := range languages {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, a := range analyzers {
+			if a.Language() == name {
+				selected = append(selected, a)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown language %q (want %s)", name, strings.Join(Languages(), ", "))
+		}
+	}
+	return selected, nil
+}
+
+// For returns the first of analyzers that handles path, or nil.
+func For(analyzers []Analyzer, path string) Analyzer {
+	for _, a := range analyzers {
+		if a.Match(path) {
+			return a
+		}
+	}
+	return nil
+}
+
+// Diff compares the declarations in two versions of the file at path; a
+// nil version stands for a file that does not exist. Changes follow the
+// order of the new version, with removals last.
+func Diff(a Analyzer, path string, before, after []byte) ([]Change, error) {
+	var old, cur []Decl
+	var err error
+	if before != nil {
+		if old, err = a.Declarations(before); err != nil {
+			return nil, fmt.Errorf("%s (before): %w", path, err)
+		}
+	}
+	if after != nil {
+		if cur, err = a.Declarations(after); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	key := func(d Decl) string { return d.Kind + " " + d.Name }
+	byKey := map[string]Decl{}
+	for _, d := range old {
+		byKey[key(d)] = d
+	}
+	var changes []Change
+	seen := map[string]bool{}
+	for _, d := range cur {
+		k := key(d)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		c := Change{Path: path, Kind: d.Kind, Name: d.Name, New: d.Signature}
+		prev, ok := byKey[k]
+		switch {
+		case !ok:
+			c.Status = StatusAdded
+		case prev.Signature != d.Signature:
+			c.Status, c.Old = StatusChanged, prev.Signature
+		case prev.Body != d.Body:
+			c.Status, c.Old = StatusModified, prev.Signature
+		default:
+			continue
+		}
+		changes = append(changes, c)
+	}
+	for _, d := range old {
+		k := key(d)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		changes = append(changes, Change{Path: path, Status: StatusRemoved, Kind: d.Kind, Name: d.Name, Old: d.Signature})
+	}
+	return changes, nil
+}
+
+var (
+	bracketSpace  = strings.NewReplacer("( ", "(", " )", ")", "[ ", "[", " ]", "]")
+	trailingComma = strings.NewReplacer(",)", ")", ",]", "]")
+)
+
+// oneLine collapses runs of white space, joining a header that spans lines
+// the way it would be written on one.
+func oneLine(s string) string {
+	return trailingComma.Replace(bracketSpace.Replace(strings.Join(strings.Fields(s), " ")))
+}
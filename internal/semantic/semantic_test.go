@@ -0,0 +1,256 @@
+package semantic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// summarize lists changes as "status name: old -> new".
+func summarize(changes []Change) []string {
+	var out []string
+	for _, c := range changes {
+		out = append(out, c.Status+" "+c.Name+": "+strings.TrimSpace(c.Old+" -> "+c.New))
+	}
+	return out
+}
+
+func diff(t *testing.T, path, before, after string) []string {
+	t.Helper()
+	analyzers, err := Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := For(analyzers, path)
+	if a == nil {
+		t.Fatalf("no analyzer for %s", path)
+	}
+	var old, cur []byte
+	if before != "" {
+		old = []byte(before)
+	}
+	if after != "" {
+		cur = []byte(after)
+	}
+	changes, err := Diff(a, path, old, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range changes {
+		if c.Path != path {
+			t.Errorf("change %+v has path %q, want %q", c, c.Path, path)
+		}
+	}
+	return summarize(changes)
+}
+
+func TestGo(t *testing.T) {
+	before := `package p
+
+// Run runs.
+func Run(n int) error { return nil }
+
+func Keep() {}
+
+func Body() int { return 1 }
+
+func helper() {}
+
+type Client struct{ url string }
+
+func (c *Client) Close() error { return nil }
+
+func (c *client) Hidden() {}
+
+type Mode int
+`
+	after := `package p
+
+// Run runs n times, as documented now.
+func Run(ctx context.Context, n int) error { return nil }
+
+func Keep() {}
+
+func Body() int { return 2 }
+
+func helper(x int) {}
+
+type Client struct {
+	url     string
+	timeout int
+}
+
+type Mode string
+
+type List[T any] []T
+
+func (l *List[T]) Push(v T) {}
+
+func New(
+	url string,
+) *Client {
+	return nil
+}
+`
+	got := diff(t, "p/p.go", before, after)
+	want := []string{
+		"changed Run: func Run(n int) error -> func Run(ctx context.Context, n int) error",
+		"modified Body: func Body() int -> func Body() int",
+		"modified Client: type Client struct -> type Client struct",
+		"changed Mode: type Mode int -> type Mode string",
+		"added List: -> type List[T any] []T",
+		"added List.Push: -> func (*List[T]) Push(v T)",
+		"added New: -> func New(url string) *Client",
+		"removed Client.Close: func (*Client) Close() error ->",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if got := diff(t, "new.go", "", "package p\n\nfunc A() {}\n"); !reflect.DeepEqual(got, []string{"added A: -> func A()"}) {
+		t.Errorf("new file: %v", got)
+	}
+
+	analyzers, _ := Select("go")
+	if _, err := Diff(For(analyzers, "bad.go"), "bad.go", nil, []byte("package p\nfunc (")); err == nil {
+		t.Errorf("expected a syntax error")
+	}
+}
+
+func TestPython(t *testing.T) {
+	before := `import os
+
+def load(path):
+    return open(path)
+
+def _private():
+    pass
+
+class Loader(Base):
+    def __init__(self, root):
+        self.root = root
+
+    def read(self, name):
+        def inner():
+            pass
+        return name
+
+    def _cache(self):
+        pass
+
+def unchanged(a,
+              b=1):
+    return a
+`
+	after := `import os
+
+async def load(path: str, *, strict: bool = False) -> Dict[str, int]:
+    return open(path)
+
+class Loader(Base):
+    def __init__(self, root):
+        self.root = root.strip()
+
+    @property
+    def size(self):
+        return 0
+
+def unchanged(a, b=1):
+    return a
+`
+	got := diff(t, "pkg/loader.py", before, after)
+	want := []string{
+		"changed load: def load(path) -> async def load(path: str, *, strict: bool = False) -> Dict[str, int]",
+		"modified Loader.__init__: def __init__(self, root) -> def __init__(self, root)",
+		"added Loader.size: -> def size(self)",
+		"removed Loader.read: def read(self, name) ->",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTypeScript(t *testing.T) {
+	before := `import { x } from "y";
+
+export function parse(s: string): Config {
+  return { s };
+}
+
+export const format = (c: Config): string => {
+  return "{" + c.s;
+};
+
+export interface Config {
+  s: string;
+}
+
+export class Store
+{
+  constructor(private root: string) {}
+
+  get(key: string): string {
+    if (key) {
+      return "";
+    }
+    return key;
+  }
+
+  private secret() {}
+}
+`
+	after := `import { x } from "y";
+
+export function parse(s: string, strict = false): Config {
+  return { s };
+}
+
+export const format = (c: Config): string => {
+  return "}" + c.s;
+};
+
+export interface Config {
+  s: string;
+  strict?: boolean;
+}
+
+export type Handler = (c: Config) => void;
+
+export class Store
+{
+  constructor(private root: string) {}
+
+  async put(key: string, cb: (err: Error) => void): Promise<void> {}
+
+  private secret() {}
+}
+`
+	got := diff(t, "src/store.ts", before, after)
+	want := []string{
+		"changed parse: export function parse(s: string): Config -> export function parse(s: string, strict = false): Config",
+		"modified format: export const format = (c: Config): string => -> export const format = (c: Config): string =>",
+		"modified Config: export interface Config -> export interface Config",
+		"added Handler: -> export type Handler",
+		"added Store.put: -> async put(key: string, cb: (err: Error) => void): Promise<void>",
+		"removed Store.get: get(key: string): string ->",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSelect(t *testing.T) {
+	if got := Languages(); !reflect.DeepEqual(got, []string{"go", "python", "typescript"}) {
+		t.Errorf("languages = %v", got)
+	}
+	analyzers, err := Select("Python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if For(analyzers, "a.py") == nil || For(analyzers, "a.go") != nil {
+		t.Errorf("python selection should only match .py files")
+	}
+	if _, err := Select("cobol"); err == nil || !strings.Contains(err.Error(), "go, python, typescript") {
+		t.Errorf("expected an unknown language error, got %v", err)
+	}
+}
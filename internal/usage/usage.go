@@ -0,0 +1,207 @@
+// Package usage records token consumption in an append-only JSONL ledger and
+// summarizes it for budgeting.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is one line of the ledger.
+type Entry struct {
+	Time             time.Time `json:"time"`
+	Command          string    `json:"command"`
+	Repo             string    `json:"repo,omitempty"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	Requests         int       `json:"requests"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	// Cost is the estimated cost in USD at the time of the request, or nil
+	// when the model has no price.
+	Cost *float64 `json:"cost_usd,omitempty"`
+}
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Input  float64 `mapstructure:"input" json:"input"`
+	Output float64 `mapstructure:"output" json:"output"`
+}
+
+// DefaultPrices are list prices for common models. They go stale; override or
+// extend them with the usage.prices config block.
+var DefaultPrices = map[string]Price{
+	"gpt-4o-mini":  {Input: 0.15, Output: 0.60},
+	"gpt-4o":       {Input: 2.50, Output: 10.00},
+	"gpt-4.1":      {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini": {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano": {Input: 0.10, Output: 0.40},
+}
+
+// EstimateCost prices prompt and completion tokens for model. Lookups ignore
+// case and fall back to the longest price key that prefixes the model, so
+// dated snapshots such as gpt-4o-2024-08-06 use the gpt-4o price.
+func EstimateCost(prices map[string]Price, model string, promptTokens, completionTokens int) (float64, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	price, ok := Price{}, false
+	best := -1
+	for name, p := range prices {
+		name = strings.ToLower(name)
+		if name == model {
+			price, ok = p, true
+			break
+		}
+		if strings.HasPrefix(model, name+"-") && len(name) > best {
+			price, ok, best = p, true, len(name)
+		}
+	}
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6, true
+}
+
+// Append writes e as a single line at the end of the ledger at path, creating
+// the file and its directory when needed.
+func Append(path string, e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns the ledger entries at or after since. A missing ledger is
+// empty; malformed lines are skipped.
+func Read(path string, since time.Time) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decode(f, since)
+}
+
+func decode(r io.Reader, since time.Time) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		if e.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// Total aggregates entries sharing a key.
+type Total struct {
+	Key              string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Cost             float64
+	// Unpriced counts entries without a cost estimate.
+	Unpriced int
+}
+
+func (t *Total) add(e Entry) {
+	t.Requests += e.Requests
+	t.PromptTokens += e.PromptTokens
+	t.CompletionTokens += e.CompletionTokens
+	t.TotalTokens += e.TotalTokens
+	if e.Cost != nil {
+		t.Cost += *e.Cost
+	} else {
+		t.Unpriced++
+	}
+}
+
+// Summarize groups entries by key, sorted by descending cost, then tokens,
+// then key. The overall total is returned separately.
+func Summarize(entries []Entry, key func(Entry) string) ([]Total, Total) {
+	groups := map[string]*Total{}
+	var all Total
+	for _, e := range entries {
+		k := key(e)
+		t, ok := groups[k]
+		if !ok {
+			t = &Total{Key: k}
+			groups[k] = t
+		}
+		t.add(e)
+		all.add(e)
+	}
+
+	totals := make([]Total, 0, len(groups))
+	for _, t := range groups {
+		totals = append(totals, *t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		a, b := totals[i], totals[j]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		if a.TotalTokens != b.TotalTokens {
+			return a.TotalTokens > b.TotalTokens
+		}
+		return a.Key < b.Key
+	})
+	return totals, all
+}
+
+// ParseSince accepts a date (2006-01-02), an RFC 3339 timestamp, or a
+// duration back from now such as 12h, 7d or 4w.
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if n := len(value); n > 1 {
+		if days, err := strconv.Atoi(value[:n-1]); err == nil && days >= 0 {
+			switch value[n-1] {
+			case 'd':
+				return now.AddDate(0, 0, -days), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*days), nil
+			}
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("usage: invalid --since %q (want a date, RFC 3339 time, or duration like 7d)", value)
+}
@@ -0,0 +1,83 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEstimateCost(t *testing.T) {
+	cost, ok := EstimateCost(DefaultPrices, "gpt-4o-mini", 1_000_000, 1_000_000)
+	if !ok || cost != 0.75 {
+		t.Fatalf("expected 0.75, got %v (%v)", cost, ok)
+	}
+	cost, ok = EstimateCost(DefaultPrices, "GPT-4o-2024-08-06", 1_000_000, 0)
+	if !ok || cost != 2.5 {
+		t.Fatalf("expected snapshot to use gpt-4o price, got %v (%v)", cost, ok)
+	}
+	if _, ok := EstimateCost(DefaultPrices, "llama3.1", 10, 10); ok {
+		t.Fatalf("expected unknown model to be unpriced")
+	}
+}
+
+func TestAppendReadSummarize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "usage.jsonl")
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	cost := 0.01
+	entries := []Entry{
+		{Time: now.AddDate(0, 0, -40), Model: "gpt-4o", Repo: "/a", TotalTokens: 1000, Requests: 1, Cost: &cost},
+		{Time: now.AddDate(0, 0, -1), Model: "gpt-4o", Repo: "/a", TotalTokens: 100, Requests: 1, Cost: &cost},
+		{Time: now, Model: "llama", Repo: "/b", TotalTokens: 50, Requests: 2},
+	}
+	for _, e := range entries {
+		if err := Append(path, e); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	_, _ = f.WriteString("not json\n")
+	f.Close()
+
+	got, err := Read(path, now.AddDate(0, 0, -7))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 recent entries, got %d", len(got))
+	}
+
+	byModel, all := Summarize(got, func(e Entry) string { return e.Model })
+	if len(byModel) != 2 || byModel[0].Key != "gpt-4o" || byModel[1].Unpriced != 1 {
+		t.Fatalf("unexpected totals: %+v", byModel)
+	}
+	if all.TotalTokens != 150 || all.Requests != 3 || all.Cost != 0.01 {
+		t.Fatalf("unexpected overall total: %+v", all)
+	}
+
+	if entries, err := Read(filepath.Join(t.TempDir(), "missing"), time.Time{}); err != nil || entries != nil {
+		t.Fatalf("expected missing ledger to be empty, got %v, %v", entries, err)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"2026-10-01":           time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		"7d":                   now.AddDate(0, 0, -7),
+		"2w":                   now.AddDate(0, 0, -14),
+		"12h":                  now.Add(-12 * time.Hour),
+		"2026-10-18T08:00:00Z": time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC),
+	}
+	for in, want := range cases {
+		got, err := ParseSince(in, now)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("ParseSince(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "yesterday", "1.5d", "-3d"} {
+		if _, err := ParseSince(bad, now); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
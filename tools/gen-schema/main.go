@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rogwilco/diffscribe/internal/config"
+)
+
+func main() {
+	out := filepath.Join("contrib", "schema", "diffscribe.schema.json")
+	if len(os.Args) > 1 {
+		out = os.Args[1]
+	}
+	schema, err := config.JSONSchema()
+	if err != nil {
+		log.Fatalf("unable to render schema: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		log.Fatalf("unable to create schema dir: %v", err)
+	}
+	if err := os.WriteFile(out, schema, 0o644); err != nil {
+		log.Fatalf("unable to write schema: %v", err)
+	}
+
+	fmt.Printf("wrote JSON schema to %s\n", out)
+}